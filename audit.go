@@ -0,0 +1,119 @@
+package rejson
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// DefaultAuditStream is the stream of the audit entries when no stream is
+// configured, see AuditWrites
+const DefaultAuditStream = "rejson:audit"
+
+// AuditOptions configures the audit of the writes, see AuditWrites
+type AuditOptions struct {
+	// Stream is the key of the stream of the entries, DefaultAuditStream if not
+	// set. It is not prefixed with the key prefix of the handler.
+	Stream string
+
+	// StreamFor returns the stream of the entries of the document at key,
+	// including the key prefix of the handler, e.g. to keep the stream in the
+	// hash slot of the document on a cluster. Stream is used if not set.
+	StreamFor func(key string) string
+
+	// MaxLen caps the stream to about this many entries with XADD MAXLEN ~,
+	// unbounded if not set
+	MaxLen int64
+
+	// OldValue records the json value at the path before the write as well
+	OldValue bool
+
+	// Caller returns the identity of the caller of the write from the context of
+	// the command, e.g. the user of the request. No caller is recorded if it is
+	// not set or returns an empty string.
+	Caller func(ctx context.Context) string
+}
+
+// AuditWrites records every write of the handler in a Redis stream, adding an
+// entry with XADD in the Lua script running the write, so that an entry is
+// added if and only if the write is applied. The fields of an entry are
+//
+//	key      the key of the document
+//	path     the path of the write
+//	command  the ReJSON command, e.g. JSON.SET
+//	new      the json value at the path after the write, if any
+//	old      the json value at the path before the write, with OldValue
+//	caller   the identity returned by Caller, if any
+//	version  the version of the document after a versioned write
+//
+// Writes skipping the document, as JSON.SET with NX or XX can, add no entry. It
+// appends a middleware to the handler, see Use.
+//
+//	rh.AuditWrites(rejson.AuditOptions{
+//		Stream: "orders:audit",
+//		Caller: func(ctx context.Context) string { return userFrom(ctx) },
+//	})
+//
+// The Invocation of an audited write is the same command, with the JSON.AUDITED
+// script. The writes running their own Lua script cannot be audited:
+// JSONSetWithTTL, JSONSetIf, JSONNumIncrByGet, JSONArrAppendCapped and
+// JSONArrPrependCapped fail with rjs.ErrAuditing, and the writes of a Lock are
+// sent without adding an entry. On a cluster, the stream must be in the hash
+// slot of the document. A write retried after its reply was lost may be
+// recorded twice, see SetRetryPolicy.
+func (r *Handler) AuditWrites(opts AuditOptions) {
+	if opts.Stream == "" {
+		opts.Stream = DefaultAuditStream
+	}
+	r.Use(func(next Invoker) Invoker {
+		return func(inv *Invocation) (interface{}, error) {
+			if !inv.Command.IsWrite() || inv.failed != nil {
+				return next(inv)
+			}
+			switch inv.Script {
+			case "", rjs.ScriptVersioned.Name():
+			case rjs.ScriptLock.Name(), rjs.ScriptLockRenew.Name(), rjs.ScriptUnlock.Name():
+				return next(inv)
+			default:
+				return nil, fmt.Errorf("%w: %s runs its own script", rjs.ErrAuditing, inv.Script)
+			}
+
+			stream := opts.Stream
+			if opts.StreamFor != nil {
+				stream = opts.StreamFor(inv.Key)
+			}
+			var caller string
+			if opts.Caller != nil {
+				caller = opts.Caller(inv.Context)
+			}
+			inv.Script = rjs.ScriptAudited.Name()
+			inv.call = func(c ReJSON, inv *Invocation) (interface{}, error) {
+				return sendAudited(c, inv, stream, caller, opts)
+			}
+			return next(inv)
+		}
+	})
+}
+
+// sendAudited sends inv with ScriptAudited
+func sendAudited(c ReJSON, inv *Invocation, stream, caller string, opts AuditOptions) (interface{}, error) {
+	name, args, err := writeArgs(inv)
+	if err != nil {
+		return nil, err
+	}
+	var maxLen, old string
+	if opts.MaxLen > 0 {
+		maxLen = strconv.FormatInt(opts.MaxLen, 10)
+	}
+	if opts.OldValue {
+		old = "1"
+	}
+	res, err := eval(c, rjs.ScriptAudited, []string{inv.Key, stream},
+		append([]interface{}{maxLen, old, caller, inv.versionPath, expectedVersion(inv), name}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return writeReply(inv, res)
+}
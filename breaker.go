@@ -0,0 +1,270 @@
+package rejson
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// Defaults of the BreakerOptions
+const (
+	DefaultBreakerWindow      = 10 * time.Second
+	DefaultBreakerMinRequests = 20
+	DefaultBreakerErrorRate   = 0.5
+	DefaultBreakerOpenTimeout = 5 * time.Second
+)
+
+// breakerBuckets is the number of buckets of the rolling window of a breaker
+const breakerBuckets = 10
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every command through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every command with rjs.ErrCircuitOpen
+	BreakerOpen
+	// BreakerHalfOpen lets a few probe commands through, closing the breaker
+	// if they succeed and opening it again otherwise
+	BreakerHalfOpen
+)
+
+// String returns the name of the state
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerOptions configures the circuit breaker of a handler, see SetCircuitBreaker
+type BreakerOptions struct {
+	// Window is the rolling window the error and slow call rates are computed
+	// over, DefaultBreakerWindow if not set
+	Window time.Duration
+
+	// MinRequests is the number of commands in the window below which the
+	// breaker does not open, DefaultBreakerMinRequests if not set
+	MinRequests int
+
+	// ErrorRate is the rate of failed commands in the window, between 0 and 1,
+	// opening the breaker. DefaultBreakerErrorRate if not set.
+	ErrorRate float64
+
+	// SlowCallDuration is the latency from which a command is slow, slow
+	// commands being ignored if not set
+	SlowCallDuration time.Duration
+
+	// SlowCallRate is the rate of slow commands in the window, between 0 and 1,
+	// opening the breaker. DefaultBreakerErrorRate if not set.
+	SlowCallRate float64
+
+	// OpenTimeout is how long the breaker stays open before letting probe
+	// commands through, DefaultBreakerOpenTimeout if not set
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of probe commands that must succeed to
+	// close the breaker, 1 if not set
+	HalfOpenRequests int
+
+	// IsFailure reports whether an error counts as a failure of the backend,
+	// DefaultBreakerFailure if not set
+	IsFailure func(err error) bool
+
+	// OnStateChange is called on every transition of the breaker, e.g. to
+	// report it to a health endpoint. It is called synchronously by the
+	// command causing the transition, and must not block.
+	OnStateChange func(from, to BreakerState)
+}
+
+// SetCircuitBreaker sets a circuit breaker failing the commands of the handler
+// fast with rjs.ErrCircuitOpen while the backend is degraded, i.e. when too many
+// commands failed or were slow in the recent window. The breaker wraps the
+// retries of a command, see SetRetryPolicy, and runs below the middlewares.
+func (r *Handler) SetCircuitBreaker(opts BreakerOptions) {
+	if opts.Window <= 0 {
+		opts.Window = DefaultBreakerWindow
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = DefaultBreakerMinRequests
+	}
+	if opts.ErrorRate <= 0 {
+		opts.ErrorRate = DefaultBreakerErrorRate
+	}
+	if opts.SlowCallRate <= 0 {
+		opts.SlowCallRate = DefaultBreakerErrorRate
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = DefaultBreakerOpenTimeout
+	}
+	if opts.HalfOpenRequests <= 0 {
+		opts.HalfOpenRequests = 1
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = DefaultBreakerFailure
+	}
+	r.breaker = &circuitBreaker{opts: opts, now: time.Now}
+}
+
+// CircuitBreakerState returns the state of the circuit breaker of the handler,
+// BreakerClosed if none is set
+func (r *Handler) CircuitBreakerState() BreakerState {
+	if r.breaker == nil {
+		return BreakerClosed
+	}
+	r.breaker.mu.Lock()
+	defer r.breaker.notify()
+	r.breaker.expire()
+	return r.breaker.state
+}
+
+// DefaultBreakerFailure reports whether err is a transient error, see
+// DefaultRetryable, or a timeout. Error replies caused by the command itself,
+// e.g. WRONGTYPE, and missing keys are not failures of the backend.
+func DefaultBreakerFailure(err error) bool {
+	return DefaultRetryable(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+type breakerBucket struct {
+	epoch    int64
+	requests int
+	failures int
+	slow     int
+}
+
+// circuitBreaker counts the outcome of the commands in a rolling window of
+// buckets, indexed by the epoch of the command, i.e. its time divided by the
+// width of a bucket
+type circuitBreaker struct {
+	opts BreakerOptions
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	openedAt time.Time
+	// probes is the number of probe commands in flight, successes the number
+	// of those which succeeded, while half-open
+	probes    int
+	successes int
+	buckets   [breakerBuckets]breakerBucket
+	// transitions are the state changes to report once the lock is released
+	transitions []BreakerState
+}
+
+// allow reports whether a command may be sent, and if it is a probe command
+func (b *circuitBreaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.notify()
+	b.expire()
+	switch b.state {
+	case BreakerOpen:
+		return false, rjs.ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probes+b.successes >= b.opts.HalfOpenRequests {
+			return false, rjs.ErrCircuitOpen
+		}
+		b.probes++
+		return true, nil
+	}
+	return false, nil
+}
+
+// record counts the outcome of a command let through by allow
+func (b *circuitBreaker) record(probe bool, err error, duration time.Duration) {
+	failed := err != nil && b.opts.IsFailure(err)
+	slow := b.opts.SlowCallDuration > 0 && duration >= b.opts.SlowCallDuration
+
+	b.mu.Lock()
+	defer b.notify()
+	if probe {
+		if b.state != BreakerHalfOpen {
+			// another probe already decided the state
+			return
+		}
+		b.probes--
+		if failed || slow {
+			b.open()
+			return
+		}
+		if b.successes++; b.successes >= b.opts.HalfOpenRequests {
+			b.buckets = [breakerBuckets]breakerBucket{}
+			b.transition(BreakerClosed)
+		}
+		return
+	}
+	if b.state != BreakerClosed {
+		return
+	}
+
+	width := int64(b.opts.Window) / breakerBuckets
+	if width == 0 {
+		width = 1
+	}
+	epoch := b.now().UnixNano() / width
+	bucket := &b.buckets[epoch%breakerBuckets]
+	if bucket.epoch != epoch {
+		*bucket = breakerBucket{epoch: epoch}
+	}
+	bucket.requests++
+	if failed {
+		bucket.failures++
+	}
+	if slow {
+		bucket.slow++
+	}
+
+	var requests, failures, slowCalls int
+	for _, bucket := range b.buckets {
+		if epoch-bucket.epoch < breakerBuckets {
+			requests += bucket.requests
+			failures += bucket.failures
+			slowCalls += bucket.slow
+		}
+	}
+	if requests < b.opts.MinRequests {
+		return
+	}
+	if float64(failures)/float64(requests) >= b.opts.ErrorRate ||
+		(b.opts.SlowCallDuration > 0 && float64(slowCalls)/float64(requests) >= b.opts.SlowCallRate) {
+		b.open()
+	}
+}
+
+// expire lets probe commands through once the breaker was open long enough
+func (b *circuitBreaker) expire() {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.opts.OpenTimeout {
+		b.probes, b.successes = 0, 0
+		b.transition(BreakerHalfOpen)
+	}
+}
+
+func (b *circuitBreaker) open() {
+	b.openedAt = b.now()
+	b.transition(BreakerOpen)
+}
+
+func (b *circuitBreaker) transition(to BreakerState) {
+	if b.opts.OnStateChange != nil {
+		b.transitions = append(b.transitions, b.state, to)
+	}
+	b.state = to
+}
+
+// notify releases the lock and reports the pending transitions
+func (b *circuitBreaker) notify() {
+	transitions := b.transitions
+	b.transitions = nil
+	b.mu.Unlock()
+	for i := 0; i < len(transitions); i += 2 {
+		b.opts.OnStateChange(transitions[i], transitions[i+1])
+	}
+}
@@ -0,0 +1,239 @@
+package rejson
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nitishm/go-rejson/v4/clients"
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// DefaultCacheMaxEntries bounds the JSONGet cache when no size is configured
+const DefaultCacheMaxEntries = 1024
+
+// CacheOptions configures the read-through cache of JSONGet, see EnableCache
+type CacheOptions struct {
+	// TTL is the maximum age of a cached reply, replies are kept until they are
+	// invalidated or evicted if not set
+	TTL time.Duration
+
+	// MaxEntries bounds the number of cached replies, the least recently used
+	// ones being evicted first. DefaultCacheMaxEntries if not set.
+	MaxEntries int
+
+	// Tracker, if set, invalidates the replies of the keys modified by other
+	// clients, see clients.NewRedigoTracker and clients.NewGoRedisTracker.
+	// Without it only the writes made through the handler invalidate the cache.
+	Tracker clients.Tracker
+}
+
+// EnableCache enables a local read-through cache of the JSONGet replies, keyed by
+// key, path and options. Every write through the handler invalidates the cached
+// replies of its key, and so do the writes of other clients when a Tracker is set.
+//
+// The cache is shared, like the client, by the handlers derived from one another
+// with WithPrefix, IfVersion or SetContext: it is enabled for all of them, and
+// the writes through any of them invalidate it.
+//
+// The Trackers use the RESP2 redirect mode of CLIENT TRACKING rather than the
+// RESP3 push messages, which the redigo and go-redis adapters cannot receive: a
+// connection of the Tracker subscribed to the invalidation channel receives the
+// invalidations of the keys matching its prefixes, see clients.Tracker.
+//
+// The replies served from the cache go through the middlewares of the handler,
+// with Invocation.Cached set, but skip the circuit breaker and the retries.
+//
+// Cached replies are shared, the returned []byte must not be modified.
+func (r *Handler) EnableCache(opts CacheOptions) error {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultCacheMaxEntries
+	}
+	cache := &documentCache{
+		ttl:      opts.TTL,
+		max:      opts.MaxEntries,
+		lru:      list.New(),
+		entries:  make(map[cacheKey]*list.Element),
+		paths:    make(map[string]map[cacheKey]struct{}),
+		fetching: make(map[string]map[*pendingFetch]struct{}),
+		tracker:  opts.Tracker,
+		now:      time.Now,
+	}
+	if opts.Tracker != nil {
+		if err := opts.Tracker.Start(cache.invalidate); err != nil {
+			return err
+		}
+	}
+	r.DisableCache()
+	r.shared().cache.Store(cache)
+	return nil
+}
+
+// DisableCache drops the JSONGet cache and closes its Tracker, if any
+func (r *Handler) DisableCache() {
+	cache := r.cache()
+	if cache == nil {
+		return
+	}
+	r.state.cache.Store((*documentCache)(nil))
+	if cache.tracker != nil {
+		_ = cache.tracker.Close()
+	}
+}
+
+// cache returns the JSONGet cache of r, nil if disabled
+func (r *Handler) cache() *documentCache {
+	if r.state == nil {
+		return nil
+	}
+	cache, _ := r.state.cache.Load().(*documentCache)
+	return cache
+}
+
+// cacheKey returns the key of the cached reply of inv, a JSON.GET
+func (inv *Invocation) cacheKey() cacheKey {
+	opts := make([]rjs.GetOption, 0, len(inv.Args))
+	for _, arg := range inv.Args {
+		opts = append(opts, arg.(rjs.GetOption))
+	}
+	return newCacheKey(inv.Key, inv.Path, opts)
+}
+
+// invalidate drops the cached replies of key after a write through the handler
+func (r *Handler) invalidate(key string) {
+	if cache := r.cache(); cache != nil {
+		cache.invalidate([]string{key})
+	}
+}
+
+type cacheKey struct {
+	key  string
+	path string
+	opts string
+}
+
+type cacheEntry struct {
+	ck      cacheKey
+	res     interface{}
+	expires time.Time
+}
+
+// documentCache is a LRU cache of JSON.GET replies
+type documentCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	lru     *list.List
+	entries map[cacheKey]*list.Element
+	// paths indexes the cached entries of every key
+	paths map[string]map[cacheKey]struct{}
+	// fetching indexes the replies being fetched for every key, so that a reply
+	// fetched while its key was being modified is not cached
+	fetching map[string]map[*pendingFetch]struct{}
+	tracker  clients.Tracker
+	now      func() time.Time
+}
+
+// pendingFetch is a JSON.GET in flight, stale once its key was invalidated
+type pendingFetch struct {
+	stale bool
+}
+
+func newCacheKey(key, path string, opts []rjs.GetOption) cacheKey {
+	var b strings.Builder
+	for _, op := range opts {
+		for _, v := range op.Value() {
+			b.WriteString(v.(string))
+			b.WriteByte(0)
+		}
+	}
+	return cacheKey{key: key, path: path, opts: b.String()}
+}
+
+// get returns the cached reply for ck, or fetches and caches it
+func (c *documentCache) get(ck cacheKey, fetch func() (interface{}, error)) (res interface{}, hit bool, err error) {
+	c.mu.Lock()
+	if e, ok := c.entries[ck]; ok {
+		entry := e.Value.(*cacheEntry)
+		if c.ttl == 0 || c.now().Before(entry.expires) {
+			c.lru.MoveToFront(e)
+			c.mu.Unlock()
+			return entry.res, true, nil
+		}
+		c.remove(e)
+	}
+	pending := &pendingFetch{}
+	if c.fetching[ck.key] == nil {
+		c.fetching[ck.key] = make(map[*pendingFetch]struct{})
+	}
+	c.fetching[ck.key][pending] = struct{}{}
+	c.mu.Unlock()
+
+	res, err = fetch()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.fetching[ck.key], pending)
+	if len(c.fetching[ck.key]) == 0 {
+		delete(c.fetching, ck.key)
+	}
+	if err == nil && res != nil && !pending.stale {
+		c.add(ck, res)
+	}
+	return res, false, err
+}
+
+func (c *documentCache) add(ck cacheKey, res interface{}) {
+	if e, ok := c.entries[ck]; ok {
+		c.remove(e)
+	}
+	entry := &cacheEntry{ck: ck, res: res}
+	if c.ttl > 0 {
+		entry.expires = c.now().Add(c.ttl)
+	}
+	c.entries[ck] = c.lru.PushFront(entry)
+	if c.paths[ck.key] == nil {
+		c.paths[ck.key] = make(map[cacheKey]struct{})
+	}
+	c.paths[ck.key][ck] = struct{}{}
+
+	for c.lru.Len() > c.max {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *documentCache) remove(e *list.Element) {
+	ck := e.Value.(*cacheEntry).ck
+	c.lru.Remove(e)
+	delete(c.entries, ck)
+	delete(c.paths[ck.key], ck)
+	if len(c.paths[ck.key]) == 0 {
+		delete(c.paths, ck.key)
+	}
+}
+
+// invalidate drops the cached replies of keys, or every reply if keys is nil
+func (c *documentCache) invalidate(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if keys == nil {
+		for _, pending := range c.fetching {
+			for p := range pending {
+				p.stale = true
+			}
+		}
+		c.lru.Init()
+		c.entries = make(map[cacheKey]*list.Element)
+		c.paths = make(map[string]map[cacheKey]struct{})
+		return
+	}
+	for _, key := range keys {
+		for p := range c.fetching[key] {
+			p.stale = true
+		}
+		for ck := range c.paths[key] {
+			c.remove(c.entries[ck])
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package clients
+
+import (
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// clusterMGet splits a JSON.MGET into one command per hash slot, as a single
+// command cannot span slots on Redis Cluster (CROSSSLOT), even on a single node.
+// The commands are pipelined: go-redis sends the commands of every node in one
+// round trip, to the nodes concurrently, and the replies are reassembled in the
+// order of keys.
+func (r *GoRedis) clusterMGet(cluster *goredis.ClusterClient, path string, keys []string) (res interface{}, err error) {
+	slots := make(map[int][]int)
+	order := make([]int, 0)
+	for i, key := range keys {
+		slot := rjs.KeySlot(key)
+		if _, ok := slots[slot]; !ok {
+			order = append(order, slot)
+		}
+		slots[slot] = append(slots[slot], i)
+	}
+
+	pipe := cluster.Pipeline()
+	cmds := make([]*goredis.Cmd, 0, len(order))
+	for _, slot := range order {
+		args := make([]interface{}, 0, len(slots[slot])+1)
+		for _, i := range slots[slot] {
+			args = append(args, keys[i])
+		}
+		args = append(args, path)
+		name, args, err := rjs.CommandBuilder(rjs.ReJSONCommandMGET, args...)
+		if err != nil {
+			return nil, err
+		}
+		args = append([]interface{}{name}, args...)
+		cmds = append(cmds, pipe.Do(r.ctx, args...))
+	}
+	if _, err = pipe.Exec(r.ctx); err != nil {
+		return nil, err
+	}
+
+	nres := make([]interface{}, len(keys))
+	for n, slot := range order {
+		values, err := cmds[n].Slice()
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range slots[slot] {
+			if values[j] != nil {
+				nres[i] = rjs.StringToBytes(values[j])
+			}
+		}
+	}
+	return nres, nil
+}
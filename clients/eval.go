@@ -0,0 +1,106 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// ScriptRunner runs Lua scripts. It is not part of the ReJSON interface, so
+// that its implementations outside this package keep satisfying it: the Handler
+// methods running a script fail with rjs.ErrNotSupported with clients that do
+// not implement it.
+type ScriptRunner interface {
+	Eval(script *rjs.Script, keys []string, args ...interface{}) (res interface{}, err error)
+}
+
+// ScriptLoader loads scripts into the script cache of the server, so that
+// their first EVALSHA does not fail with NOSCRIPT
+type ScriptLoader interface {
+	LoadScript(script *rjs.Script) error
+}
+
+// checkScriptHash checks the digest returned by SCRIPT LOAD
+func checkScriptHash(script *rjs.Script, res interface{}) error {
+	hash, err := replyString(res)
+	if err != nil {
+		return err
+	}
+	if hash != script.Hash() {
+		return fmt.Errorf("error: script %s loaded as %s, want %s", script.Name(), hash, script.Hash())
+	}
+	return nil
+}
+
+// Eval runs script with EVALSHA, falling back to EVAL if the server does not
+// have it cached
+//
+// Redis syntax:
+//
+//	EVALSHA <sha1> <numkeys> [key ...] [arg ...]
+func (r *Redigo) Eval(script *rjs.Script, keys []string, args ...interface{}) (res interface{}, err error) {
+	evalArgs := append([]interface{}{script.Hash()}, rjs.EvalArgs(keys, args)...)
+	res, err = r.Conn.Do("EVALSHA", evalArgs...)
+	if rjs.IsNoScript(err) {
+		evalArgs[0] = script.Source()
+		res, err = r.Conn.Do("EVAL", evalArgs...)
+	}
+	return
+}
+
+// LoadScript loads script into the script cache of the server
+//
+// Redis syntax:
+//
+//	SCRIPT LOAD <script>
+func (r *Redigo) LoadScript(script *rjs.Script) error {
+	res, err := r.Conn.Do("SCRIPT", "LOAD", script.Source())
+	if err != nil {
+		return err
+	}
+	return checkScriptHash(script, res)
+}
+
+// Eval runs script with EVALSHA, falling back to EVAL if the server does not
+// have it cached
+//
+// Redis syntax:
+//
+//	EVALSHA <sha1> <numkeys> [key ...] [arg ...]
+func (r *GoRedis) Eval(script *rjs.Script, keys []string, args ...interface{}) (res interface{}, err error) {
+	evalArgs := append([]interface{}{"EVALSHA", script.Hash()}, rjs.EvalArgs(keys, args)...)
+	res, err = r.Conn.Do(r.ctx, evalArgs...).Result()
+	if rjs.IsNoScript(err) {
+		evalArgs[0], evalArgs[1] = "EVAL", script.Source()
+		res, err = r.Conn.Do(r.ctx, evalArgs...).Result()
+	}
+	if err != nil && err.Error() == rjs.ErrGoRedisNil.Error() {
+		err = nil
+	}
+	return
+}
+
+// LoadScript loads script into the script cache of the server, or of every
+// shard of a ClusterClient or Ring
+//
+// Redis syntax:
+//
+//	SCRIPT LOAD <script>
+func (r *GoRedis) LoadScript(script *rjs.Script) error {
+	load := func(ctx context.Context, conn GoRedisClientConn) error {
+		res, err := conn.Do(ctx, "SCRIPT", "LOAD", script.Source()).Result()
+		if err != nil {
+			return err
+		}
+		return checkScriptHash(script, res)
+	}
+	if shards, ok := r.Conn.(goRedisShards); ok {
+		return shards.ForEachShard(r.ctx, func(ctx context.Context, client *goredis.Client) error {
+			return load(ctx, client)
+		})
+	}
+	return load(r.ctx, r.Conn)
+}
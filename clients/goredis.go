@@ -36,6 +36,11 @@ func NewGoRedisClient(ctx context.Context, conn GoRedisClientConn) *GoRedis {
 	}
 }
 
+// Context returns the context the commands are issued with
+func (r *GoRedis) Context() context.Context {
+	return r.ctx
+}
+
 // JSONSet used to set a json object
 //
 // ReJSON syntax:
@@ -100,7 +105,8 @@ func (r *GoRedis) JSONGet(key, path string, opts ...rjs.GetOption) (res interfac
 	return rjs.StringToBytes(res), err
 }
 
-// JSONMGet used to get path values from multiple keys
+// JSONMGet used to get path values from multiple keys. With a goredis.ClusterClient
+// the keys are grouped by hash slot and fetched with one command per slot.
 //
 // ReJSON syntax:
 //
@@ -109,6 +115,9 @@ func (r *GoRedis) JSONMGet(path string, keys ...string) (res interface{}, err er
 	if len(keys) == 0 {
 		return nil, rjs.ErrNeedAtLeastOneArg
 	}
+	if cluster, ok := r.Conn.(*goredis.ClusterClient); ok {
+		return r.clusterMGet(cluster, path, keys)
+	}
 	args := make([]interface{}, 0)
 	for _, key := range keys {
 		args = append(args, key)
@@ -175,6 +184,16 @@ func (r *GoRedis) JSONType(key, path string) (res interface{}, err error) {
 //
 //	JSON.NUMINCRBY <key> <path> <number>
 func (r *GoRedis) JSONNumIncrBy(key, path string, number int) (res interface{}, err error) {
+	return r.JSONNumIncrByNumber(key, path, number)
+}
+
+// JSONNumIncrByNumber to increment a number by an arbitrary precision amount,
+// such as a json.Number, *big.Int or *big.Float
+//
+// ReJSON syntax:
+//
+//	JSON.NUMINCRBY <key> <path> <number>
+func (r *GoRedis) JSONNumIncrByNumber(key, path string, number interface{}) (res interface{}, err error) {
 	name, args, err := rjs.CommandBuilder(rjs.ReJSONCommandNUMINCRBY, key, path, number)
 	if err != nil {
 		return nil, err
@@ -193,6 +212,16 @@ func (r *GoRedis) JSONNumIncrBy(key, path string, number int) (res interface{},
 //
 //	JSON.NUMMULTBY <key> <path> <number>
 func (r *GoRedis) JSONNumMultBy(key, path string, number int) (res interface{}, err error) {
+	return r.JSONNumMultByNumber(key, path, number)
+}
+
+// JSONNumMultByNumber to multiply a number by an arbitrary precision amount,
+// such as a json.Number, *big.Int or *big.Float
+//
+// ReJSON syntax:
+//
+//	JSON.NUMMULTBY <key> <path> <number>
+func (r *GoRedis) JSONNumMultByNumber(key, path string, number interface{}) (res interface{}, err error) {
 	name, args, err := rjs.CommandBuilder(rjs.ReJSONCommandNUMMULTBY, key, path, number)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,18 @@
+package clients
+
+// NumberUpdater increments and multiplies numbers by arbitrary precision
+// amounts, e.g. json.Number or *big.Int values. It is not part of the ReJSON
+// interface, so that its implementations outside this package keep satisfying
+// it: JSONNumIncrByNumber and JSONNumMultByNumber fail with
+// rjs.ErrNotSupported with clients that do not implement it.
+type NumberUpdater interface {
+	JSONNumIncrByNumber(key, path string, number interface{}) (res interface{}, err error)
+	JSONNumMultByNumber(key, path string, number interface{}) (res interface{}, err error)
+}
+
+var (
+	_ ScriptRunner  = (*Redigo)(nil)
+	_ ScriptRunner  = (*GoRedis)(nil)
+	_ NumberUpdater = (*Redigo)(nil)
+	_ NumberUpdater = (*GoRedis)(nil)
+)
@@ -140,6 +140,16 @@ func (r *Redigo) JSONType(key, path string) (res interface{}, err error) {
 //
 //	JSON.NUMINCRBY <key> <path> <number>
 func (r *Redigo) JSONNumIncrBy(key, path string, number int) (res interface{}, err error) {
+	return r.JSONNumIncrByNumber(key, path, number)
+}
+
+// JSONNumIncrByNumber used to increment a number by an arbitrary precision amount,
+// such as a json.Number, *big.Int or *big.Float
+//
+// ReJSON syntax:
+//
+//	JSON.NUMINCRBY <key> <path> <number>
+func (r *Redigo) JSONNumIncrByNumber(key, path string, number interface{}) (res interface{}, err error) {
 	name, args, err := rjs.CommandBuilder(rjs.ReJSONCommandNUMINCRBY, key, path, number)
 	if err != nil {
 		return nil, err
@@ -153,6 +163,16 @@ func (r *Redigo) JSONNumIncrBy(key, path string, number int) (res interface{}, e
 //
 //	JSON.NUMMULTBY <key> <path> <number>
 func (r *Redigo) JSONNumMultBy(key, path string, number int) (res interface{}, err error) {
+	return r.JSONNumMultByNumber(key, path, number)
+}
+
+// JSONNumMultByNumber to multiply a number by an arbitrary precision amount,
+// such as a json.Number, *big.Int or *big.Float
+//
+// ReJSON syntax:
+//
+//	JSON.NUMMULTBY <key> <path> <number>
+func (r *Redigo) JSONNumMultByNumber(key, path string, number interface{}) (res interface{}, err error) {
 	name, args, err := rjs.CommandBuilder(rjs.ReJSONCommandNUMMULTBY, key, path, number)
 	if err != nil {
 		return nil, err
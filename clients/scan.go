@@ -0,0 +1,144 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// KeyScanner is implemented by the clients able to walk the key space with SCAN
+type KeyScanner interface {
+	// ScanNodes returns a ScanNode for every node holding a part of the key
+	// space, i.e. every master of a cluster or every shard of a ring
+	ScanNodes() ([]ScanNode, error)
+}
+
+// ScanNode walks the key space of a single redis node
+type ScanNode interface {
+	// Scan issues SCAN <cursor> [MATCH match] [COUNT count] [TYPE keyType]
+	Scan(cursor uint64, match string, count int64, keyType string) (next uint64, keys []string, err error)
+}
+
+// goRedisMasters is implemented by goredis.ClusterClient
+type goRedisMasters interface {
+	ForEachMaster(ctx context.Context, fn func(ctx context.Context, client *goredis.Client) error) error
+}
+
+// goRedisShards is implemented by goredis.Ring
+type goRedisShards interface {
+	ForEachShard(ctx context.Context, fn func(ctx context.Context, client *goredis.Client) error) error
+}
+
+// ScanNodes returns the connection itself, redigo connections are bound to a single node
+func (r *Redigo) ScanNodes() ([]ScanNode, error) {
+	return []ScanNode{r}, nil
+}
+
+// Scan walks the key space of the connected node
+func (r *Redigo) Scan(cursor uint64, match string, count int64, keyType string) (
+	next uint64, keys []string, err error,
+) {
+	res, err := r.Conn.Do("SCAN", scanArgs(cursor, match, count, keyType)...)
+	if err != nil {
+		return 0, nil, err
+	}
+	return parseScanReply(res)
+}
+
+// ScanNodes returns a ScanNode for every master of a goredis.ClusterClient, every
+// shard of a goredis.Ring, or the connection itself for the other clients
+func (r *GoRedis) ScanNodes() ([]ScanNode, error) {
+	var (
+		mu    sync.Mutex
+		nodes []ScanNode
+	)
+	collect := func(ctx context.Context, client *goredis.Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+		nodes = append(nodes, NewGoRedisClient(r.ctx, client))
+		return nil
+	}
+
+	switch conn := r.Conn.(type) {
+	case goRedisMasters:
+		if err := conn.ForEachMaster(r.ctx, collect); err != nil {
+			return nil, err
+		}
+	case goRedisShards:
+		if err := conn.ForEachShard(r.ctx, collect); err != nil {
+			return nil, err
+		}
+	default:
+		nodes = append(nodes, r)
+	}
+	return nodes, nil
+}
+
+// Scan walks the key space of the connected node
+func (r *GoRedis) Scan(cursor uint64, match string, count int64, keyType string) (
+	next uint64, keys []string, err error,
+) {
+	args := append([]interface{}{"SCAN"}, scanArgs(cursor, match, count, keyType)...)
+	res, err := r.Conn.Do(r.ctx, args...).Result()
+	if err != nil {
+		return 0, nil, err
+	}
+	return parseScanReply(res)
+}
+
+func scanArgs(cursor uint64, match string, count int64, keyType string) []interface{} {
+	args := []interface{}{cursor}
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	if keyType != "" {
+		args = append(args, "TYPE", keyType)
+	}
+	return args
+}
+
+// parseScanReply parses the [cursor, [key ...]] reply of SCAN, as bulk strings
+// are returned as []byte by redigo and as string by go-redis
+func parseScanReply(res interface{}) (next uint64, keys []string, err error) {
+	reply, ok := res.([]interface{})
+	if !ok || len(reply) != 2 {
+		return 0, nil, fmt.Errorf("error: unexpected SCAN reply %v", res)
+	}
+	cursor, err := replyString(reply[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	next, err = strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return 0, nil, err
+	}
+	list, ok := reply[1].([]interface{})
+	if !ok {
+		return 0, nil, fmt.Errorf("error: unexpected SCAN reply %v", res)
+	}
+	keys = make([]string, 0, len(list))
+	for _, k := range list {
+		key, err := replyString(k)
+		if err != nil {
+			return 0, nil, err
+		}
+		keys = append(keys, key)
+	}
+	return next, keys, nil
+}
+
+func replyString(res interface{}) (string, error) {
+	switch v := res.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("type returned not expected %T", res)
+}
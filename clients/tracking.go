@@ -0,0 +1,360 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// InvalidateChannel is the channel invalidation messages are published on when
+// CLIENT TRACKING redirects them to a RESP2 connection
+const InvalidateChannel = "__redis__:invalidate"
+
+// trackerRetryInterval is the delay between two attempts to re-establish tracking
+const trackerRetryInterval = time.Second
+
+// InvalidationFunc is called with the keys invalidated by the server, or with nil
+// when every key must be considered invalid, e.g. after a FLUSHALL or when the
+// tracking connection was lost
+type InvalidationFunc func(keys []string)
+
+// Tracker listens for server-assisted client side caching invalidations, using
+// CLIENT TRACKING in broadcasting mode (Redis 6.0 or later)
+type Tracker interface {
+	// Start enables tracking and calls invalidate from a background goroutine
+	// for every invalidation until the tracker is closed
+	Start(invalidate InvalidationFunc) error
+
+	// Close disables tracking and releases the connections of the tracker
+	Close() error
+}
+
+// trackingArgs returns the arguments of CLIENT TRACKING redirecting the
+// invalidations of the keys starting with prefixes to the client id
+func trackingArgs(id int64, prefixes []string) []interface{} {
+	args := []interface{}{"TRACKING", "ON", "REDIRECT", id, "BCAST"}
+	for _, prefix := range prefixes {
+		args = append(args, "PREFIX", prefix)
+	}
+	return args
+}
+
+// RedigoTracker implements Tracker with two dedicated redigo connections, one
+// subscribed to the invalidation channel and one redirecting its invalidations
+// to it
+type RedigoTracker struct {
+	dial     func() (redigo.Conn, error)
+	prefixes []string
+
+	mu       sync.Mutex
+	listener redigo.Conn
+	tracking redigo.Conn
+	closed   bool
+}
+
+// NewRedigoTracker returns a Tracker for the keys starting with prefixes, or for
+// every key if none is given. dial is used to open the tracker's connections.
+func NewRedigoTracker(dial func() (redigo.Conn, error), prefixes ...string) *RedigoTracker {
+	return &RedigoTracker{dial: dial, prefixes: prefixes}
+}
+
+// Start enables tracking and listens for invalidations in the background
+func (t *RedigoTracker) Start(invalidate InvalidationFunc) error {
+	listener, err := t.connect()
+	if err != nil {
+		return err
+	}
+	go t.listen(listener, invalidate)
+	return nil
+}
+
+// Close disables tracking and closes the tracker's connections
+func (t *RedigoTracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return t.release()
+}
+
+func (t *RedigoTracker) connect() (redigo.Conn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, fmt.Errorf("error: tracker closed")
+	}
+	_ = t.release()
+
+	listener, err := t.dial()
+	if err != nil {
+		return nil, err
+	}
+	t.listener = listener
+	id, err := redigo.Int64(listener.Do("CLIENT", "ID"))
+	if err != nil {
+		return nil, err
+	}
+	if err = listener.Send("SUBSCRIBE", InvalidateChannel); err != nil {
+		return nil, err
+	}
+	if err = listener.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err = listener.Receive(); err != nil {
+		return nil, err
+	}
+
+	tracking, err := t.dial()
+	if err != nil {
+		return nil, err
+	}
+	t.tracking = tracking
+	if _, err = tracking.Do("CLIENT", trackingArgs(id, t.prefixes)...); err != nil {
+		return nil, err
+	}
+	return listener, nil
+}
+
+func (t *RedigoTracker) release() (err error) {
+	for _, conn := range []redigo.Conn{t.listener, t.tracking} {
+		if conn != nil {
+			if cerr := conn.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	t.listener, t.tracking = nil, nil
+	return
+}
+
+func (t *RedigoTracker) listen(listener redigo.Conn, invalidate InvalidationFunc) {
+	for {
+		reply, err := listener.Receive()
+		if err == nil {
+			invalidateReply(reply, invalidate)
+			continue
+		}
+
+		// invalidations may have been missed, and tracking must be re-established
+		invalidate(nil)
+		for {
+			if listener, err = t.connect(); err == nil {
+				break
+			}
+			if t.isClosed() {
+				return
+			}
+			time.Sleep(trackerRetryInterval)
+		}
+	}
+}
+
+func (t *RedigoTracker) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+// invalidateReply handles a ["message", channel, payload] reply, where payload
+// is the array of invalidated keys, or nil when the whole database was flushed
+func invalidateReply(reply interface{}, invalidate InvalidationFunc) {
+	msg, ok := reply.([]interface{})
+	if !ok || len(msg) != 3 {
+		return
+	}
+	if kind, _ := replyString(msg[0]); kind != "message" {
+		return
+	}
+	payload, ok := msg[2].([]interface{})
+	if !ok {
+		invalidate(nil)
+		return
+	}
+	keys := make([]string, 0, len(payload))
+	for _, k := range payload {
+		if key, err := replyString(k); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	invalidate(keys)
+}
+
+// GoRedisTracker implements Tracker with a dedicated go-redis client, one of
+// its connections subscribed to the invalidation channel and one redirecting
+// its invalidations to it
+type GoRedisTracker struct {
+	// generation counts the subscriptions, conns the connections of client, both
+	// part of the name of the connections. They come first to be 64-bit aligned
+	// for the atomic operations.
+	generation int64
+	conns      int64
+
+	client   *goredis.Client
+	name     string
+	prefixes []string
+
+	mu       sync.Mutex
+	pubsub   *goredis.PubSub
+	tracking *goredis.Conn
+	closed   bool
+}
+
+// NewGoRedisTracker returns a Tracker for the keys starting with prefixes, or for
+// every key if none is given. A dedicated client is created from opts.
+func NewGoRedisTracker(opts *goredis.Options, prefixes ...string) *GoRedisTracker {
+	t := &GoRedisTracker{
+		name:     fmt.Sprintf("rejson-tracker-%d-%d", os.Getpid(), time.Now().UnixNano()),
+		prefixes: prefixes,
+	}
+	o := *opts
+	// the subscribed connection is found by its name to learn its client id:
+	// every connection is named after the current subscription, uniquely, so that
+	// the connection of a previous one is never mistaken for it
+	onConnect := o.OnConnect
+	o.OnConnect = func(ctx context.Context, cn *goredis.Conn) error {
+		if onConnect != nil {
+			if err := onConnect(ctx, cn); err != nil {
+				return err
+			}
+		}
+		name := fmt.Sprintf("%s-%d", t.connName(), atomic.AddInt64(&t.conns, 1))
+		return cn.ClientSetName(ctx, name).Err()
+	}
+	t.client = goredis.NewClient(&o)
+	return t
+}
+
+// connName returns the prefix of the names of the connections of the current
+// subscription
+func (t *GoRedisTracker) connName() string {
+	return fmt.Sprintf("%s-%d", t.name, atomic.LoadInt64(&t.generation))
+}
+
+// Start enables tracking and listens for invalidations in the background
+func (t *GoRedisTracker) Start(invalidate InvalidationFunc) error {
+	pubsub, err := t.connect()
+	if err != nil {
+		return err
+	}
+	go t.listen(pubsub, invalidate)
+	return nil
+}
+
+// Close disables tracking and closes the tracker's client
+func (t *GoRedisTracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	t.release()
+	return t.client.Close()
+}
+
+func (t *GoRedisTracker) connect() (*goredis.PubSub, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, fmt.Errorf("error: tracker closed")
+	}
+	t.release()
+
+	ctx := context.Background()
+	atomic.AddInt64(&t.generation, 1)
+	t.pubsub = t.client.Subscribe(ctx, InvalidateChannel)
+	if _, err := t.pubsub.Receive(ctx); err != nil {
+		return nil, err
+	}
+	id, err := t.subscriberID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t.tracking = t.client.Conn()
+	cmd := goredis.NewCmd(ctx, append([]interface{}{"CLIENT"}, trackingArgs(id, t.prefixes)...)...)
+	if err = t.tracking.Process(ctx, cmd); err != nil {
+		return nil, err
+	}
+	return t.pubsub, nil
+}
+
+// subscriberID finds the client id of the subscribed connection in CLIENT LIST,
+// the last one of the current subscription if go-redis reconnected it
+func (t *GoRedisTracker) subscriberID(ctx context.Context) (int64, error) {
+	list, err := t.client.Do(ctx, "CLIENT", "LIST", "TYPE", "pubsub").Text()
+	if err != nil {
+		return 0, err
+	}
+	prefix := t.connName() + "-"
+	var id int64
+	for _, line := range strings.Split(list, "\n") {
+		fields := make(map[string]string)
+		for _, field := range strings.Fields(line) {
+			if kv := strings.SplitN(field, "=", 2); len(kv) == 2 {
+				fields[kv[0]] = kv[1]
+			}
+		}
+		if !strings.HasPrefix(fields["name"], prefix) {
+			continue
+		}
+		n, err := strconv.ParseInt(fields["id"], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if n > id {
+			id = n
+		}
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("error: tracker connection not found in CLIENT LIST")
+	}
+	return id, nil
+}
+
+func (t *GoRedisTracker) release() {
+	if t.pubsub != nil {
+		_ = t.pubsub.Close()
+	}
+	if t.tracking != nil {
+		_ = t.tracking.Close()
+	}
+	t.pubsub, t.tracking = nil, nil
+}
+
+func (t *GoRedisTracker) listen(pubsub *goredis.PubSub, invalidate InvalidationFunc) {
+	ctx := context.Background()
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err == nil {
+			if m, ok := msg.(*goredis.Message); ok {
+				invalidate(m.PayloadSlice)
+			}
+			continue
+		}
+
+		// a flush is published with a nil payload that go-redis fails to parse,
+		// and after a lost connection invalidations may have been missed:
+		// drop everything and re-establish tracking
+		invalidate(nil)
+		for {
+			if pubsub, err = t.connect(); err == nil {
+				break
+			}
+			if t.isClosed() {
+				return
+			}
+			time.Sleep(trackerRetryInterval)
+		}
+	}
+}
+
+func (t *GoRedisTracker) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
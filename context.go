@@ -2,29 +2,20 @@ package rejson
 
 import (
 	"context"
-	"github.com/nitishm/go-rejson/v4/clients"
-	"github.com/nitishm/go-rejson/v4/rjs"
 )
 
 // SetContext helps redis-clients, provide use of command level context
-// in the ReJSON commands.
-// Currently, only go-redis@v8 supports command level context, therefore
-// a separate method is added to support it, maintaining the support for
-// other clients and for backward compatibility. (nitishm/go-rejson#46)
+// in the ReJSON commands. It returns a handler sharing the client and the
+// configuration of r, whose commands run with ctx, see Invocation.Context.
+// go-redis issues the commands with ctx; with every client the middlewares see
+// it, e.g. to nest the spans of the otel package in the span of the caller.
+// (nitishm/go-rejson#46)
 func (r *Handler) SetContext(ctx context.Context) *Handler {
 	if r == nil {
 		return r // nil
 	}
 
-	if r.clientName == rjs.ClientGoRedis {
-		if old, ok := r.implementation.(*clients.GoRedis); ok {
-			return &Handler{
-				clientName:     r.clientName,
-				implementation: clients.NewGoRedisClient(ctx, old.Conn),
-			}
-		}
-	}
-
-	// for other clients, context is of no use, hence return same
-	return r
+	h := &Handler{state: r.shared(), handlerConfig: r.handlerConfig}
+	h.callCtx = ctx
+	return h
 }
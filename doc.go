@@ -46,5 +46,10 @@ Similarly, one can set client for Go-Redis
 And now, one can directly use ReJSON commands using the handler
 
 	res, err := rh.JSONSet("str", ".", "string")
+
+Pre-encoded JSON can be stored as-is, without being marshaled into a JSON string, using rjs.RawJSON
+or json.RawMessage
+
+	res, err := rh.JSONSet("obj", ".", rjs.RawJSON(`{"name":"foo"}`))
 */
 package rejson
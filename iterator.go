@@ -0,0 +1,233 @@
+package rejson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultArrayPageSize is the number of elements fetched per page by an
+// ArrayIterator when no page size is configured
+const DefaultArrayPageSize = 500
+
+// ArrayIteratorOptions configures an ArrayIterator
+type ArrayIteratorOptions struct {
+	// PageSize is the number of elements fetched per JSON.GET,
+	// DefaultArrayPageSize if not set
+	PageSize int
+
+	// Prefetch fetches the next page in the background while the current one
+	// is consumed. The handler's client must then be safe for concurrent use,
+	// as a go-redis client or a redigo pool connection per command are, but a
+	// single redigo.Conn is not.
+	Prefetch bool
+}
+
+// ArrayIterator pages through a json array using slice paths, e.g. $.items[0:500],
+// so that large arrays are never fetched at once.
+//
+// The length of the array is read with JSON.ARRLEN when the iteration starts and
+// bounds it: elements appended later are not yielded, and if the array shrinks
+// the iteration ends at its new end. Elements shifted by concurrent inserts or
+// deletes before the current position may be skipped or yielded twice.
+//
+// Slice paths require JSONPath support, i.e. RedisJSON 2.0 or later.
+//
+//	it := rh.ArrayIterator("doc", ".items", rejson.ArrayIteratorOptions{PageSize: 100})
+//	for it.Next() {
+//		var item Item
+//		if err := it.Decode(&item); err != nil {
+//			...
+//		}
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ArrayIterator struct {
+	handler  *Handler
+	key      string
+	path     string
+	pageSize int
+	prefetch bool
+
+	started bool
+	length  int
+	next    int
+	page    []json.RawMessage
+	pos     int
+	index   int
+	current json.RawMessage
+	pending chan arrayPage
+	err     error
+}
+
+type arrayPage struct {
+	elements []json.RawMessage
+	err      error
+}
+
+// ArrayIterator returns an iterator over the elements of the json array at path
+func (r *Handler) ArrayIterator(key, path string, opts ArrayIteratorOptions) *ArrayIterator {
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultArrayPageSize
+	}
+	return &ArrayIterator{
+		handler:  r,
+		key:      key,
+		path:     path,
+		pageSize: opts.PageSize,
+		prefetch: opts.Prefetch,
+		index:    -1,
+	}
+}
+
+// Next advances the iterator to the next element, returning false when the
+// array is exhausted or an error occurred
+func (it *ArrayIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		if it.err = it.start(); it.err != nil {
+			return false
+		}
+	}
+	if it.pos >= len(it.page) && !it.nextPage() {
+		return false
+	}
+	it.current = it.page[it.pos]
+	it.pos++
+	it.index++
+	return true
+}
+
+// Index returns the array index of the current element
+func (it *ArrayIterator) Index() int {
+	return it.index
+}
+
+// Raw returns the json encoding of the current element
+func (it *ArrayIterator) Raw() json.RawMessage {
+	return it.current
+}
+
+// Decode decodes the current element into v, see JSONGetInto
+func (it *ArrayIterator) Decode(v interface{}) error {
+	return it.handler.decode([]byte(it.current), v)
+}
+
+// Err returns the error that ended the iteration, if any
+func (it *ArrayIterator) Err() error {
+	return it.err
+}
+
+// Len returns the length of the array observed when the iteration started
+func (it *ArrayIterator) Len() int {
+	return it.length
+}
+
+func (it *ArrayIterator) start() error {
+	res, err := it.handler.JSONArrLen(it.key, it.path)
+	if err != nil {
+		return err
+	}
+	it.length, err = arrayLen(res)
+	if err != nil {
+		return err
+	}
+	it.path = jsonPath(it.path)
+	return nil
+}
+
+func (it *ArrayIterator) nextPage() bool {
+	if it.next >= it.length {
+		return false
+	}
+
+	var page arrayPage
+	if it.pending != nil {
+		page = <-it.pending
+		it.pending = nil
+	} else {
+		page = it.fetch(it.next, it.pageEnd(it.next))
+	}
+	if page.err != nil {
+		it.err = page.err
+		return false
+	}
+
+	start := it.next
+	it.next += it.pageSize
+	if len(page.elements) < it.pageSize && start+len(page.elements) < it.length {
+		// the array shrank since the iteration started
+		it.length = start + len(page.elements)
+	}
+	if len(page.elements) == 0 {
+		return false
+	}
+	it.page, it.pos = page.elements, 0
+
+	if it.prefetch && it.next < it.length {
+		it.pending = make(chan arrayPage, 1)
+		go func(pending chan<- arrayPage, start, end int) {
+			pending <- it.fetch(start, end)
+		}(it.pending, it.next, it.pageEnd(it.next))
+	}
+	return true
+}
+
+func (it *ArrayIterator) pageEnd(start int) int {
+	if end := start + it.pageSize; end < it.length {
+		return end
+	}
+	return it.length
+}
+
+func (it *ArrayIterator) fetch(start, end int) (page arrayPage) {
+	path := fmt.Sprintf("%s[%d:%d]", it.path, start, end)
+	res, err := it.handler.JSONGet(it.key, path)
+	if err != nil || res == nil {
+		page.err = err
+		return
+	}
+	reply, ok := res.([]byte)
+	if !ok {
+		page.err = fmt.Errorf("error: unexpected JSON.GET reply %T", res)
+		return
+	}
+	// the reply of a slice path is the array of the elements of the slice
+	page.err = json.Unmarshal(reply, &page.elements)
+	return
+}
+
+// arrayLen reads a JSON.ARRLEN reply, which is an integer for legacy paths
+// and an array with one integer per match for JSONPath ($) paths
+func arrayLen(res interface{}) (int, error) {
+	switch v := res.(type) {
+	case int64:
+		return int(v), nil
+	case []interface{}:
+		if len(v) == 1 {
+			return arrayLen(v[0])
+		}
+		return 0, fmt.Errorf("error: path must match exactly one array, matched %d", len(v))
+	case nil:
+		return 0, fmt.Errorf("error: no array at path")
+	}
+	return 0, fmt.Errorf("error: unexpected JSON.ARRLEN reply %T", res)
+}
+
+// jsonPath converts a legacy path (`.`, `.a.b`, `a.b`, `[0]`) into the
+// equivalent JSONPath, leaving JSONPaths unchanged
+func jsonPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, "$"):
+		return path
+	case path == "" || path == ".":
+		return "$"
+	case strings.HasPrefix(path, ".") || strings.HasPrefix(path, "["):
+		return "$" + path
+	}
+	return "$." + path
+}
@@ -0,0 +1,111 @@
+// Package jsonschema validates the writes of a rejson.Handler with JSON Schema
+// draft 2020-12, or the draft of the $schema keyword of a schema.
+//
+//	schema, err := jsonschema.Compile([]byte(`{
+//		"type": "object",
+//		"required": ["status"],
+//		"properties": {"status": {"enum": ["packed", "shipped"]}}
+//	}`))
+//	if err != nil {
+//		...
+//	}
+//	rh.RegisterSchema("order:*", schema)
+//
+// Remote $ref are not loaded, schemas referenced by url must be compiled
+// together with a Compiler.
+package jsonschema
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/nitishm/go-rejson/v4"
+	js "github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Schema is a compiled JSON Schema, implementing rejson.Schema
+type Schema struct {
+	schema *js.Schema
+}
+
+var _ rejson.Schema = (*Schema)(nil)
+
+// Compiler compiles schemas referencing each other by url
+type Compiler struct {
+	compiler *js.Compiler
+}
+
+// NewCompiler returns a Compiler of draft 2020-12 schemas, unless they declare
+// another draft with $schema. Remote references are not loaded.
+func NewCompiler() *Compiler {
+	c := js.NewCompiler()
+	c.Draft = js.Draft2020
+	c.LoadURL = func(url string) (_ io.ReadCloser, err error) {
+		return nil, fmt.Errorf("error: schema %s is not added to the compiler", url)
+	}
+	return &Compiler{compiler: c}
+}
+
+// AddSchema adds the schema at url, e.g. https://example.com/order.json, to be
+// compiled or referenced by other schemas
+func (c *Compiler) AddSchema(url string, schema []byte) error {
+	return c.compiler.AddResource(url, bytes.NewReader(schema))
+}
+
+// Compile compiles the schema at url, added with AddSchema
+func (c *Compiler) Compile(url string) (*Schema, error) {
+	schema, err := c.compiler.Compile(url)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{schema: schema}, nil
+}
+
+// Compile compiles a standalone schema
+func Compile(schema []byte) (*Schema, error) {
+	const url = "schema.json"
+	c := NewCompiler()
+	if err := c.AddSchema(url, schema); err != nil {
+		return nil, err
+	}
+	return c.Compile(url)
+}
+
+// MustCompile is like Compile but panics if the schema is invalid, e.g. to
+// initialize global variables
+func MustCompile(schema []byte) *Schema {
+	s, err := Compile(schema)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Validate returns the violations of doc, the most specific ones: a value
+// failing both branches of an anyOf is reported by the failing keywords of
+// the branches rather than by anyOf itself
+func (s *Schema) Validate(doc interface{}) ([]rejson.SchemaViolation, error) {
+	err := s.schema.Validate(doc)
+	if err == nil {
+		return nil, nil
+	}
+	verr, ok := err.(*js.ValidationError)
+	if !ok {
+		return nil, err
+	}
+	var violations []rejson.SchemaViolation
+	var leaves func(e *js.ValidationError)
+	leaves = func(e *js.ValidationError) {
+		if len(e.Causes) == 0 {
+			violations = append(violations, rejson.SchemaViolation{
+				Path: e.InstanceLocation, Keyword: e.KeywordLocation, Message: e.Message,
+			})
+		}
+		for _, cause := range e.Causes {
+			leaves(cause)
+		}
+	}
+	leaves(verr)
+	return violations, nil
+}
@@ -0,0 +1,98 @@
+package jsonschema
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/nitishm/go-rejson/v4"
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// fakeConn is a redigo connection replying with reply to every command
+type fakeConn struct {
+	reply interface{}
+}
+
+func (f *fakeConn) Do(string, ...interface{}) (interface{}, error) {
+	return f.reply, nil
+}
+
+var orderSchema = []byte(`{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["status", "items"],
+	"properties": {
+		"status": {"enum": ["packed", "shipped"]},
+		"items": {
+			"type": "array",
+			"prefixItems": [{"$ref": "#/$defs/item"}],
+			"items": {"$ref": "#/$defs/item"}
+		}
+	},
+	"$defs": {
+		"item": {
+			"type": "object",
+			"properties": {"qty": {"type": "integer", "minimum": 1}}
+		}
+	}
+}`)
+
+func TestSchema(t *testing.T) {
+	conn := &fakeConn{reply: []byte(`{"status":"packed","items":[{"qty":1}]}`)}
+	rh := rejson.NewReJSONHandler()
+	rh.SetRedigoClient(conn)
+	rh.RegisterSchema("order:*", MustCompile(orderSchema))
+
+	if _, err := rh.JSONArrAppend("order:1", ".items", map[string]int{"qty": 2}); err != nil {
+		t.Errorf("JSONArrAppend() error = %v", err)
+	}
+	if _, err := rh.JSONSet("order:1", "$.status", "shipped"); err != nil {
+		t.Errorf("JSONSet() error = %v", err)
+	}
+
+	_, err := rh.JSONArrAppend("order:1", ".items", map[string]interface{}{"qty": 1.5}, map[string]int{"qty": 0})
+	var verr *rejson.ValidationError
+	if !errors.As(err, &verr) || !errors.Is(err, rjs.ErrSchemaValidation) {
+		t.Fatalf("JSONArrAppend() error = %v, want a *rejson.ValidationError", err)
+	}
+	want := []rejson.SchemaViolation{
+		{Path: "/items/1/qty", Keyword: "/properties/items/items/$ref/properties/qty/type",
+			Message: "expected integer, but got number"},
+		{Path: "/items/2/qty", Keyword: "/properties/items/items/$ref/properties/qty/minimum",
+			Message: "must be >= 1 but found 0"},
+	}
+	if !reflect.DeepEqual(verr.Violations, want) {
+		t.Errorf("Violations = %+v, want %+v", verr.Violations, want)
+	}
+
+	_, err = rh.JSONSet("order:2", ".", map[string]string{"status": "lost"})
+	if !errors.As(err, &verr) || len(verr.Violations) != 2 {
+		t.Errorf("JSONSet() error = %v, want a missing items and an invalid status", err)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	if _, err := Compile([]byte(`{"type": 1}`)); err == nil {
+		t.Error("Compile() of an invalid schema, want an error")
+	}
+	if _, err := Compile([]byte(`{"$ref": "https://example.com/item.json"}`)); err == nil {
+		t.Error("Compile() with a remote reference, want an error")
+	}
+
+	c := NewCompiler()
+	if err := c.AddSchema("https://example.com/item.json", []byte(`{"type": "object"}`)); err != nil {
+		t.Fatalf("AddSchema() error = %v", err)
+	}
+	if err := c.AddSchema("https://example.com/order.json",
+		[]byte(`{"items": {"$ref": "item.json"}}`)); err != nil {
+		t.Fatalf("AddSchema() error = %v", err)
+	}
+	schema, err := c.Compile("https://example.com/order.json")
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if violations, err := schema.Validate([]interface{}{"a"}); err != nil || len(violations) != 1 {
+		t.Errorf("Validate() = %v %v, want 1 violation", violations, err)
+	}
+}
@@ -0,0 +1,235 @@
+package rejson
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+const (
+	// DefaultLockPath is the path of the lock in its document when no path is
+	// configured
+	DefaultLockPath = ".lock"
+
+	// DefaultLockTTL is the duration of a lease when no TTL is configured
+	DefaultLockTTL = 30 * time.Second
+)
+
+// LockOptions configures a Lock
+type LockOptions struct {
+	// Path is the legacy path of the lock object in the document,
+	// DefaultLockPath if not set. Its parent must exist. JSONPath paths, starting
+	// with $, are rejected by Acquire.
+	Path string
+
+	// TTL is the duration of a lease, from its acquisition or last renewal,
+	// DefaultLockTTL if not set
+	TTL time.Duration
+
+	// Owner identifies the holder of the lock, a random id if not set. Locks with
+	// the same owner are the same holder.
+	Owner string
+}
+
+// Lock is a lease on a json document, stored in the document itself as
+//
+//	{"owner": "8f1c...", "expires": 1700000030000, "token": 42}
+//
+// so that the lock metadata of a work item lives with the item. It is acquired,
+// renewed and released atomically with Lua scripts, expires being checked with
+// the time of the server, in unix milliseconds.
+//
+// Every acquisition increments the token with JSON.NUMINCRBY, it is never reset,
+// even on release. It is a fencing token: the writes of a holder whose lease
+// expired while it was paused can be rejected by storage that saw a greater one.
+// The writes of a lock are neither versioned nor audited, see EnableVersioning
+// and AuditWrites.
+//
+//	lock := rh.NewLock("job:1", rejson.LockOptions{TTL: 10 * time.Second})
+//	if err := lock.Acquire(); errors.Is(err, rjs.ErrLockHeld) {
+//		return
+//	}
+//	defer lock.Release()
+//	process(lock.Token())
+type Lock struct {
+	handler *Handler
+	key     string
+	path    string
+	owner   string
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	token   int64
+	expires time.Time
+}
+
+// NewLock returns a lock of the document at key. The document must exist when
+// the lock is acquired.
+func (r *Handler) NewLock(key string, opts LockOptions) *Lock {
+	if opts.Path == "" {
+		opts.Path = DefaultLockPath
+	}
+	if opts.TTL == 0 {
+		opts.TTL = DefaultLockTTL
+	}
+	if opts.Owner == "" {
+		opts.Owner = randomOwner()
+	}
+	return &Lock{handler: r, key: key, path: opts.Path, owner: opts.Owner, ttl: opts.TTL}
+}
+
+func randomOwner() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Owner returns the owner of the lock
+func (l *Lock) Owner() string {
+	return l.owner
+}
+
+// Token returns the fencing token of the last acquisition, 0 if the lock was
+// never acquired
+func (l *Lock) Token() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.token
+}
+
+// Expires returns the expiry of the lease as set by the server, the zero time if
+// the lock is not held
+func (l *Lock) Expires() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.expires
+}
+
+// Acquire acquires the lock if it is free, expired or already held by the owner,
+// with a new token. It returns an error wrapping rjs.ErrLockHeld if another
+// owner holds it, or rjs.ErrInvalidPath if the path of the lock is not a legacy
+// path, see LockOptions.
+//
+// The Invocation of the command is a JSON.NUMINCRBY, which is not retried.
+func (l *Lock) Acquire() error {
+	if strings.HasPrefix(l.path, "$") {
+		// JSON.NUMINCRBY would reply with an array, and the lock stay held
+		return fmt.Errorf("%w: %s is not a legacy path", rjs.ErrInvalidPath, l.path)
+	}
+	inv := &Invocation{
+		Command: rjs.ReJSONCommandNUMINCRBY, Script: rjs.ScriptLock.Name(), Key: l.key, Path: l.path,
+		Args: []interface{}{l.owner, l.ttl},
+	}
+	res, err := l.handler.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		args, err := rjs.LockArgs(inv.Path, l.owner, l.ttl)
+		if err != nil {
+			return nil, err
+		}
+		return eval(c, rjs.ScriptLock, []string{inv.Key}, args...)
+	})
+	if err != nil {
+		return err
+	}
+
+	reply, ok := res.([]interface{})
+	if !ok || len(reply) != 3 {
+		return fmt.Errorf("error: unexpected lock reply %v", res)
+	}
+	expires, _ := reply[2].(int64)
+	if reply[0] != int64(1) {
+		owner, _ := replyText(reply[1])
+		return fmt.Errorf("%w: %s until %v", rjs.ErrLockHeld, owner, unixMilli(expires))
+	}
+	text, _ := replyText(reply[1])
+	token, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("error: unexpected lock token %v", reply[1])
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.token, l.expires = token, unixMilli(expires)
+	return nil
+}
+
+// Renew extends the lease by the TTL of the lock from now. It returns
+// rjs.ErrLockNotHeld if the lease expired or the lock was acquired again since.
+//
+// The Invocation of the command is a JSON.SET.
+func (l *Lock) Renew() error {
+	token := l.Token()
+	inv := &Invocation{
+		Command: rjs.ReJSONCommandSET, Script: rjs.ScriptLockRenew.Name(), Key: l.key, Path: l.path,
+		Args: []interface{}{l.owner, token, l.ttl},
+	}
+	res, err := l.handler.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		args, err := rjs.LockRenewArgs(inv.Path, l.owner, token, l.ttl)
+		if err != nil {
+			return nil, err
+		}
+		return eval(c, rjs.ScriptLockRenew, []string{inv.Key}, args...)
+	})
+	if err != nil {
+		return err
+	}
+
+	expires, _ := res.(int64)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if expires == 0 {
+		l.expires = time.Time{}
+		return rjs.ErrLockNotHeld
+	}
+	l.expires = unixMilli(expires)
+	return nil
+}
+
+// Release releases the lock, keeping its token. It returns rjs.ErrLockNotHeld
+// if the lock was acquired again since, which may happen once the lease expired.
+//
+// The Invocation of the command is a JSON.SET, which is not retried as a retry
+// would report the lock as not held.
+func (l *Lock) Release() error {
+	token := l.Token()
+	inv := &Invocation{
+		Command: rjs.ReJSONCommandSET, Script: rjs.ScriptUnlock.Name(), Key: l.key, Path: l.path,
+		Args: []interface{}{l.owner, token},
+	}
+	res, err := l.handler.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return eval(c, rjs.ScriptUnlock, []string{inv.Key}, rjs.UnlockArgs(inv.Path, l.owner, token)...)
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expires = time.Time{}
+	if res != int64(1) {
+		return rjs.ErrLockNotHeld
+	}
+	return nil
+}
+
+// replyText returns the text of a bulk string reply of either client
+func replyText(reply interface{}) (string, bool) {
+	switch v := reply.(type) {
+	case []byte:
+		return string(v), true
+	case string:
+		return v, true
+	}
+	return "", false
+}
+
+// unixMilli returns the time of ms unix milliseconds, as time.UnixMilli does
+// since go 1.17
+func unixMilli(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
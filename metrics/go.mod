@@ -0,0 +1,29 @@
+module github.com/nitishm/go-rejson/v4/metrics
+
+go 1.20
+
+// The root module is replaced by the working tree for local development only:
+// consumers resolve the required version, the first release with the APIs used
+// here, tagged before this module, see CONTRIBUTING.md.
+replace github.com/nitishm/go-rejson/v4 => ../
+
+require (
+	github.com/gomodule/redigo v1.8.3
+	github.com/nitishm/go-rejson/v4 v4.3.0
+	github.com/prometheus/client_golang v1.17.0
+	github.com/redis/go-redis/v9 v9.0.2
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
+	github.com/prometheus/client_model v0.4.1-0.20230718164431-9a2bf3000d16 // indirect
+	github.com/prometheus/common v0.44.0 // indirect
+	github.com/prometheus/procfs v0.11.1 // indirect
+	golang.org/x/sys v0.11.0 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
+)
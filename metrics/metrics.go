@@ -0,0 +1,202 @@
+// Package metrics exports Prometheus metrics of the commands of a rejson.Handler.
+//
+//	collector := metrics.NewCollector(metrics.Options{})
+//	prometheus.MustRegister(collector)
+//	rh.Use(collector.Middleware())
+//
+// Every metric is labelled with the command name, e.g. JSON.SET, and the client
+// adapter, redigo or goredis:
+//
+//   - rejson_command_duration_seconds, the latency of the commands
+//   - rejson_command_errors_total, the failed commands by error class, see ErrorClass
+//   - rejson_payload_size_bytes, the size of the documents sent by JSON.SET and
+//     received from JSON.GET
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/nitishm/go-rejson/v4"
+	"github.com/nitishm/go-rejson/v4/rjs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Error classes of the rejson_command_errors_total counter
+const (
+	// ClassClient is an invalid use of the client, e.g. ErrTooManyOptionals
+	ClassClient = "client"
+	// ClassServer is an error reply of the server, e.g. a wrong type
+	ClassServer = "server"
+	// ClassTimeout is a timed out command or an expired context
+	ClassTimeout = "timeout"
+	// ClassCanceled is a command whose context was canceled
+	ClassCanceled = "canceled"
+	// ClassNetwork is a failed connection
+	ClassNetwork = "network"
+	// ClassCircuitOpen is a command failed fast by the circuit breaker of the handler
+	ClassCircuitOpen = "circuit_open"
+	// ClassConflict is a write conflicting with the version of its document, see
+	// rejson.Handler.IfVersion
+	ClassConflict = "conflict"
+	// ClassOther is any other error
+	ClassOther = "other"
+)
+
+var (
+	// DefaultLatencyBuckets are the buckets of the latency histogram, in seconds,
+	// from 100µs to about 1.6s
+	DefaultLatencyBuckets = prometheus.ExponentialBuckets(0.0001, 2, 15)
+
+	// DefaultPayloadBuckets are the buckets of the payload size histogram, in
+	// bytes, from 64B to 16MiB
+	DefaultPayloadBuckets = prometheus.ExponentialBuckets(64, 4, 10)
+
+	clientErrors = []error{
+		rjs.ErrNoClientSet, rjs.ErrTooManyOptionals, rjs.ErrNeedAtLeastOneArg, rjs.ErrInvalidRawJSON,
+		rjs.ErrInvalidNumber, rjs.ErrScanNotSupported, rjs.ErrNotSupported, rjs.ErrCrossSlot, rjs.ErrInvalidTTL,
+		rjs.ErrInvalidMaxLen, rjs.ErrSchemaValidation, rjs.ErrVersioning, rjs.ErrAuditing,
+	}
+)
+
+// Options configures a Collector
+type Options struct {
+	// Namespace prefixes the metric names, e.g. myapp_rejson_command_duration_seconds
+	Namespace string
+
+	// ConstLabels are added to every metric, e.g. the name of the instance
+	ConstLabels prometheus.Labels
+
+	// LatencyBuckets are the buckets of the latency histogram, in seconds,
+	// DefaultLatencyBuckets if not set
+	LatencyBuckets []float64
+
+	// PayloadBuckets are the buckets of the payload size histogram, in bytes,
+	// DefaultPayloadBuckets if not set
+	PayloadBuckets []float64
+}
+
+// Collector is a prometheus.Collector of the metrics recorded by its middleware
+type Collector struct {
+	latency *prometheus.HistogramVec
+	errors  *prometheus.CounterVec
+	payload *prometheus.HistogramVec
+}
+
+// NewCollector returns a Collector, to be registered with a prometheus.Registerer
+// and added to handlers with Middleware
+func NewCollector(opts Options) *Collector {
+	if opts.LatencyBuckets == nil {
+		opts.LatencyBuckets = DefaultLatencyBuckets
+	}
+	if opts.PayloadBuckets == nil {
+		opts.PayloadBuckets = DefaultPayloadBuckets
+	}
+	labels := []string{"command", "client"}
+	return &Collector{
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   "rejson",
+			Name:        "command_duration_seconds",
+			Help:        "Latency of the ReJSON commands.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.LatencyBuckets,
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   "rejson",
+			Name:        "command_errors_total",
+			Help:        "Failed ReJSON commands by error class.",
+			ConstLabels: opts.ConstLabels,
+		}, append(labels, "class")),
+		payload: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   "rejson",
+			Name:        "payload_size_bytes",
+			Help:        "Size of the documents sent by JSON.SET and received from JSON.GET.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.PayloadBuckets,
+		}, labels),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.latency.Describe(ch)
+	c.errors.Describe(ch)
+	c.payload.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.latency.Collect(ch)
+	c.errors.Collect(ch)
+	c.payload.Collect(ch)
+}
+
+// Middleware returns the rejson.Middleware recording the metrics of the commands
+// of a handler. The same collector may be used by several handlers.
+func (c *Collector) Middleware() rejson.Middleware {
+	return func(next rejson.Invoker) rejson.Invoker {
+		return func(inv *rejson.Invocation) (interface{}, error) {
+			res, err := next(inv)
+
+			command := inv.Command.String()
+			if inv.Duration > 0 {
+				// commands short-circuited by an inner middleware were not sent
+				c.latency.WithLabelValues(command, inv.Client).Observe(inv.Duration.Seconds())
+			}
+			if class := ErrorClass(err); class != "" {
+				c.errors.WithLabelValues(command, inv.Client, class).Inc()
+			}
+			if inv.Command == rjs.ReJSONCommandSET || inv.Command == rjs.ReJSONCommandGET {
+				if size := inv.PayloadSize(); size > 0 {
+					c.payload.WithLabelValues(command, inv.Client).Observe(float64(size))
+				}
+			}
+			return res, err
+		}
+	}
+}
+
+// ErrorClass returns the class of an error returned by a command, or an empty
+// string if err is nil or reports a missing key
+func ErrorClass(err error) string {
+	if err == nil || err.Error() == rjs.ErrGoRedisNil.Error() || errors.Is(err, rjs.ErrNilReply) {
+		return ""
+	}
+	if errors.Is(err, rjs.ErrCircuitOpen) {
+		return ClassCircuitOpen
+	}
+	if errors.Is(err, rjs.ErrVersionConflict) {
+		return ClassConflict
+	}
+	for _, e := range clientErrors {
+		if errors.Is(err, e) {
+			return ClassClient
+		}
+	}
+
+	var netErr net.Error
+	var redigoErr redigo.Error
+	var goredisErr interface{ RedisError() }
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ClassTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ClassTimeout
+		}
+		return ClassNetwork
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ClassNetwork
+	case errors.As(err, &redigoErr), errors.As(err, &goredisErr):
+		return ClassServer
+	}
+	return ClassOther
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/nitishm/go-rejson/v4"
+	"github.com/nitishm/go-rejson/v4/rjs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// fakeConn is a redigo connection replying with reply to every command
+type fakeConn struct {
+	reply interface{}
+	err   error
+}
+
+func (f *fakeConn) Do(string, ...interface{}) (interface{}, error) {
+	return f.reply, f.err
+}
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector(Options{})
+	conn := &fakeConn{reply: "OK"}
+	rh := rejson.NewReJSONHandler()
+	rh.SetRedigoClient(conn)
+	rh.Use(collector.Middleware())
+
+	if _, err := rh.JSONSet("key", ".", map[string]int{"a": 1}); err != nil {
+		t.Fatalf("JSONSet() error = %v", err)
+	}
+	conn.reply = []byte(`{"a":1,"b":2}`)
+	if _, err := rh.JSONGet("key", "."); err != nil {
+		t.Fatalf("JSONGet() error = %v", err)
+	}
+	conn.reply, conn.err = nil, redigo.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	_, _ = rh.JSONType("key", ".")
+	_, _ = rh.JSONArrAppend("key", ".", rjs.RawJSON("{"))
+
+	want := `
+# HELP rejson_command_errors_total Failed ReJSON commands by error class.
+# TYPE rejson_command_errors_total counter
+rejson_command_errors_total{class="client",client="redigo",command="JSON.ARRAPPEND"} 1
+rejson_command_errors_total{class="server",client="redigo",command="JSON.TYPE"} 1
+# HELP rejson_payload_size_bytes Size of the documents sent by JSON.SET and received from JSON.GET.
+# TYPE rejson_payload_size_bytes histogram
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(want+payloadHistogram("JSON.GET", 13)+
+		payloadHistogram("JSON.SET", 7)), "rejson_command_errors_total", "rejson_payload_size_bytes")
+	if err != nil {
+		t.Error(err)
+	}
+	// JSON.ARRAPPEND failed without being sent
+	if n := testutil.CollectAndCount(collector, "rejson_command_duration_seconds"); n != 3 {
+		t.Errorf("got %d latency histograms, want 3", n)
+	}
+}
+
+func payloadHistogram(command string, size int) string {
+	var b strings.Builder
+	for _, le := range DefaultPayloadBuckets {
+		count := 0
+		if float64(size) <= le {
+			count = 1
+		}
+		fmt.Fprintf(&b, "rejson_payload_size_bytes_bucket{client=\"redigo\",command=%q,le=\"%g\"} %d\n", command, le, count)
+	}
+	fmt.Fprintf(&b, "rejson_payload_size_bytes_bucket{client=\"redigo\",command=%q,le=\"+Inf\"} 1\n", command)
+	fmt.Fprintf(&b, "rejson_payload_size_bytes_sum{client=\"redigo\",command=%q} %d\n", command, size)
+	fmt.Fprintf(&b, "rejson_payload_size_bytes_count{client=\"redigo\",command=%q} 1\n", command)
+	return b.String()
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"Nil", nil, ""},
+		{"GoRedisNil", goredis.Nil, ""},
+		{"NilReply", rjs.ErrNilReply, ""},
+		{"Client", rjs.ErrTooManyOptionals, ClassClient},
+		{"WrappedClient", fmt.Errorf("%w: %q and %q", rjs.ErrCrossSlot, "a", "b"), ClassClient},
+		{"CircuitOpen", rjs.ErrCircuitOpen, ClassCircuitOpen},
+		{"Conflict", &rejson.VersionConflictError{Key: "a", Expected: 1, Actual: 2}, ClassConflict},
+		{"RedigoServer", redigo.Error("ERR unknown command"), ClassServer},
+		{"GoRedisServer", goredisError("ERR unknown command"), ClassServer},
+		{"Canceled", context.Canceled, ClassCanceled},
+		{"Deadline", context.DeadlineExceeded, ClassTimeout},
+		{"NetTimeout", &net.OpError{Op: "read", Err: timeoutError{}}, ClassTimeout},
+		{"Network", &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}, ClassNetwork},
+		{"EOF", io.EOF, ClassNetwork},
+		{"Other", fmt.Errorf("boom"), ClassOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorClass(tt.err); got != tt.want {
+				t.Errorf("ErrorClass(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// goredisError implements the goredis.Error interface of the error replies
+type goredisError string
+
+func (e goredisError) Error() string { return string(e) }
+func (goredisError) RedisError()     {}
+
+var _ goredis.Error = goredisError("")
@@ -0,0 +1,339 @@
+package rejson
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nitishm/go-rejson/v4/clients"
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// Invocation describes a single ReJSON command flowing through the middleware
+// chain of a Handler, see Handler.Use
+type Invocation struct {
+	// Context is the context of the command, the one set with SetContext,
+	// SetGoRedisClientWithContext or WithContext, context.Background otherwise.
+	// A middleware may replace it, e.g. to start a span; go-redis commands are
+	// issued with it.
+	Context context.Context
+
+	// Command is the id of the ReJSON command
+	Command rjs.ReJSONCommandID
+
+	// Script is the name of the Lua script running the command along with other
+	// ones atomically, e.g. JSON.SET+TTL for JSONSetWithTTL, empty otherwise
+	Script string
+
+	// Client is the name of the client adapter, rjs.ClientRedigo or rjs.ClientGoRedis
+	Client string
+
+	// Key is the key of the command, including the key prefix of the handler,
+	// empty for JSON.MGET and JSON.DEBUG HELP
+	Key string
+
+	// Keys are the keys of JSON.MGET, including the key prefix of the handler
+	Keys []string
+
+	// Path is the path of the command
+	Path string
+
+	// Args are the other arguments of the command, in order, e.g. the value and
+	// the options of JSON.SET. They are informational and must not be modified.
+	Args []interface{}
+
+	// Result, Err and Duration are set once the command was sent, Duration
+	// including the backoff between retries
+	Result   interface{}
+	Err      error
+	Duration time.Duration
+
+	// Attempts is the number of times the command was sent, more than one if it
+	// was retried, see SetRetryPolicy
+	Attempts int
+
+	// Cached is set when the reply of JSON.GET was served from the local cache
+	// without sending the command, see EnableCache. Duration and Attempts are 0.
+	Cached bool
+
+	call func(c ReJSON, inv *Invocation) (res interface{}, err error)
+	impl ReJSON
+	// cacheable is set on the JSON.GET of JSONGet, whose replies are cached
+	cacheable bool
+	// sent are the Args as sent, their json values encoded once, see encodeValues
+	sent []interface{}
+	// versionPath and ifVersion are the version path and the version required
+	// by a versioned write, see EnableVersioning
+	versionPath string
+	ifVersion   *int64
+	// failed is the error of a command that cannot be sent, returned once inv
+	// went through the middleware chain
+	failed error
+}
+
+// PayloadSize returns the size in bytes of the json carried by the command: the
+// values sent by JSON.SET, JSON.ARRAPPEND, JSON.ARRINSERT, JSON.ARRINDEX and
+// JSON.STRAPPEND, or the reply of JSON.GET, JSON.MGET and JSON.ARRPOP once it
+// was received. It is 0 for the other commands.
+//
+// The values are measured from their encoding as sent, without being marshaled
+// again, unless the command was not sent.
+func (inv *Invocation) PayloadSize() int {
+	switch inv.Command {
+	case rjs.ReJSONCommandSET, rjs.ReJSONCommandARRINDEX:
+		return valuesSize(inv.sentArgs()[:1])
+	case rjs.ReJSONCommandARRAPPEND, rjs.ReJSONCommandARRINSERT:
+		from, to := inv.values()
+		return valuesSize(inv.sentArgs()[from:to])
+	case rjs.ReJSONCommandSTRAPPEND:
+		return len(inv.Args[0].(string))
+	case rjs.ReJSONCommandGET, rjs.ReJSONCommandMGET, rjs.ReJSONCommandARRPOP:
+		return replySize(inv.Result)
+	}
+	return 0
+}
+
+// values returns the bounds of the json values in the Args of inv
+func (inv *Invocation) values() (from, to int) {
+	switch inv.Command {
+	case rjs.ReJSONCommandSET:
+		if inv.Script == rjs.ScriptSetIf.Name() {
+			// the new value and the expected one
+			return 0, 2
+		}
+		return 0, 1
+	case rjs.ReJSONCommandARRINDEX:
+		return 0, 1
+	case rjs.ReJSONCommandARRAPPEND:
+		if inv.Script == rjs.ScriptArrAppendCapped.Name() {
+			return 1, len(inv.Args)
+		}
+		return 0, len(inv.Args)
+	case rjs.ReJSONCommandARRINSERT:
+		// after the index, or the max length of JSONArrPrependCapped
+		return 1, len(inv.Args)
+	}
+	return 0, 0
+}
+
+// encodeValues checks the raw json values of the Args of inv and encodes the
+// json values once, as rjs.RawJSON, so that they are sent and measured without
+// being marshaled again
+func (r *Handler) encodeValues(inv *Invocation) error {
+	from, to := inv.values()
+	if from == to {
+		return nil
+	}
+	if err := r.validRawJSON(inv.Args[from:to]); err != nil {
+		return err
+	}
+	sent := append([]interface{}(nil), inv.Args...)
+	for i := from; i < to; i++ {
+		b, err := rjs.MarshalValue(sent[i])
+		if err != nil {
+			return err
+		}
+		sent[i] = rjs.RawJSON(b)
+	}
+	inv.sent = sent
+	return nil
+}
+
+// sentArgs returns the Args of inv as sent
+func (inv *Invocation) sentArgs() []interface{} {
+	if inv.sent != nil {
+		return inv.sent
+	}
+	return inv.Args
+}
+
+func valuesSize(values []interface{}) (size int) {
+	for _, v := range values {
+		switch b := v.(type) {
+		case rjs.RawJSON:
+			size += len(b)
+		case json.RawMessage:
+			size += len(b)
+		default:
+			if b, err := rjs.MarshalValue(v); err == nil {
+				size += len(b)
+			}
+		}
+	}
+	return
+}
+
+func replySize(reply interface{}) (size int) {
+	switch v := reply.(type) {
+	case []byte:
+		return len(v)
+	case string:
+		return len(v)
+	case []interface{}:
+		for _, e := range v {
+			size += replySize(e)
+		}
+	}
+	return
+}
+
+// Invoker executes an invocation, the next step of a middleware chain
+type Invoker func(inv *Invocation) (res interface{}, err error)
+
+// Middleware wraps an Invoker with extra behavior, such as logging, metrics or
+// authorization checks. It must call next to send the command, or return
+// without calling it to short-circuit the command.
+type Middleware func(next Invoker) Invoker
+
+// Use appends middlewares to the chain wrapped around every ReJSON command of
+// the handler. The first middleware is the outermost one.
+//
+//	rh.Use(func(next rejson.Invoker) rejson.Invoker {
+//		return func(inv *rejson.Invocation) (interface{}, error) {
+//			res, err := next(inv)
+//			log.Printf("%v %s %s took %v: %v", inv.Command, inv.Key, inv.Path, inv.Duration, err)
+//			return res, err
+//		}
+//	})
+func (r *Handler) Use(middlewares ...Middleware) {
+	// never append in place, handlers returned by SetContext share the chain
+	r.middlewares = append(r.middlewares[:len(r.middlewares):len(r.middlewares)], middlewares...)
+}
+
+// invoke sends inv through the middleware chain, call issuing the command with
+// the client once every middleware ran
+func (r *Handler) invoke(inv *Invocation, call func(c ReJSON, inv *Invocation) (interface{}, error)) (
+	res interface{}, err error,
+) {
+	client := r.active()
+	if client.name == rjs.ClientInactive {
+		return nil, rjs.ErrNoClientSet
+	}
+	inv.Client, inv.impl = client.name, client.impl
+	inv.Context = r.ctx
+	if inv.Context == nil {
+		inv.Context = context.Background()
+	}
+	if r.prefix != "" {
+		inv.Key = prefixKey(r.prefix, inv.Key)
+		if inv.Keys != nil {
+			keys := make([]string, len(inv.Keys))
+			for i, key := range inv.Keys {
+				keys[i] = r.prefix + key
+			}
+			inv.Keys = keys
+		}
+	}
+	if g, ok := inv.impl.(*clients.GoRedis); ok {
+		inv.Context = g.Context()
+	}
+	if r.callCtx != nil {
+		inv.Context = r.callCtx
+	}
+	inv.call = call
+	if err := r.encodeValues(inv); err != nil {
+		// the error of the command, as when the client encodes the values
+		inv.failed = err
+	} else if (r.versionPath != "" || r.ifVersion != nil) && inv.Command.IsWrite() {
+		if err := r.versioned(inv); err != nil {
+			inv.failed = err
+		}
+	}
+
+	return r.chain(inv)
+}
+
+// chain sends inv, ready to be sent, through the middleware chain
+func (r *Handler) chain(inv *Invocation) (res interface{}, err error) {
+	invoker := r.send
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		invoker = r.middlewares[i](invoker)
+	}
+	return invoker(inv)
+}
+
+// send is the last Invoker of every chain, serving JSON.GET from the cache when
+// enabled, or issuing the command with the client
+func (r *Handler) send(inv *Invocation) (res interface{}, err error) {
+	if cache := r.cache(); inv.cacheable && cache != nil {
+		var hit bool
+		res, hit, err = cache.get(inv.cacheKey(), func() (interface{}, error) {
+			return r.sendCommand(inv)
+		})
+		if hit {
+			inv.Result, inv.Err, inv.Duration, inv.Attempts, inv.Cached = res, nil, 0, 0, true
+		}
+		return res, err
+	}
+	return r.sendCommand(inv)
+}
+
+// sendCommand issues the command of inv with the client
+func (r *Handler) sendCommand(inv *Invocation) (res interface{}, err error) {
+	impl := inv.impl
+	if g, ok := impl.(*clients.GoRedis); ok && inv.Context != g.Context() {
+		impl = clients.NewGoRedisClient(inv.Context, g.Conn)
+	}
+
+	inv.Attempts = 0
+	if inv.failed != nil {
+		inv.Result, inv.Err, inv.Duration = nil, inv.failed, 0
+		return nil, inv.failed
+	}
+	if len(r.schemas) > 0 {
+		if err = r.validateWrite(inv); err != nil {
+			inv.Result, inv.Err, inv.Duration = nil, err, 0
+			return nil, err
+		}
+	}
+
+	var probe bool
+	if r.breaker != nil {
+		if probe, err = r.breaker.allow(); err != nil {
+			inv.Result, inv.Err, inv.Duration = nil, err, 0
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	for {
+		res, err = inv.call(impl, inv)
+		inv.Attempts++
+		if err == nil || r.retry == nil || !r.retry.shouldRetry(inv, err) || !r.retry.wait(inv.Context, inv.Attempts) {
+			break
+		}
+	}
+	inv.Result, inv.Err, inv.Duration = res, err, time.Since(start)
+	if r.breaker != nil {
+		r.breaker.record(probe, err, inv.Duration)
+	}
+
+	if inv.Command.IsWrite() {
+		r.invalidate(inv.Key)
+	}
+	return
+}
+
+func setOptionArgs(opts []rjs.SetOption) []interface{} {
+	args := make([]interface{}, 0, len(opts))
+	for _, op := range opts {
+		args = append(args, op)
+	}
+	return args
+}
+
+func getOptionArgs(opts []rjs.GetOption) []interface{} {
+	args := make([]interface{}, 0, len(opts))
+	for _, op := range opts {
+		args = append(args, op)
+	}
+	return args
+}
+
+func intArgs(values []int) []interface{} {
+	args := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
@@ -0,0 +1,290 @@
+package rejson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nitishm/go-rejson/v4/clients"
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// Codec encodes the values sent by a handler and decodes the documents it
+// reads, e.g. to use a faster json library than encoding/json. rjs.RawJSON and
+// json.RawMessage values are sent as they are.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Option configures the handler returned by New
+type Option func(o *options)
+
+type options struct {
+	clients     []func(r *Handler, ctx context.Context)
+	ctx         context.Context
+	codec       Codec
+	middlewares []Middleware
+	retry       *RetryPolicy
+	getOptions  []rjs.GetOption
+	prefix      string
+	schemas     []schemaRule
+	skipRawJSON bool
+	errs        []error
+}
+
+func (o *options) invalid(format string, args ...interface{}) {
+	o.errs = append(o.errs, fmt.Errorf("%w: "+format, append([]interface{}{rjs.ErrInvalidOption}, args...)...))
+}
+
+// WithRedigoClient sets the redigo connection of the handler
+func WithRedigoClient(conn clients.RedigoClientConn) Option {
+	return func(o *options) {
+		if conn == nil {
+			o.invalid("nil redigo connection")
+			return
+		}
+		o.clients = append(o.clients, func(r *Handler, _ context.Context) {
+			r.SetRedigoClient(conn)
+		})
+	}
+}
+
+// WithGoRedisClient sets the go-redis client of the handler, issuing its
+// commands with the context of WithContext
+func WithGoRedisClient(conn clients.GoRedisClientConn) Option {
+	return func(o *options) {
+		if conn == nil {
+			o.invalid("nil go-redis client")
+			return
+		}
+		o.clients = append(o.clients, func(r *Handler, ctx context.Context) {
+			r.SetGoRedisClientWithContext(ctx, conn)
+		})
+	}
+}
+
+// WithContext sets the default context of the commands, see Invocation.Context,
+// context.Background if not set. Handlers with a command level context can be
+// derived with SetContext.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		if ctx == nil {
+			o.invalid("nil context")
+			return
+		}
+		o.ctx = ctx
+	}
+}
+
+// WithCodec sets the codec encoding the values sent by JSONSet, JSONArrAppend,
+// JSONArrInsert and JSONArrIndex, and decoding the documents of JSONGetInto and
+// of the iterators. Values are encoded before the middlewares run, which see
+// them as rjs.RawJSON.
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		if codec == nil {
+			o.invalid("nil codec")
+			return
+		}
+		o.codec = codec
+	}
+}
+
+// WithRawJSONValidation enables or disables the check of the rjs.RawJSON and
+// json.RawMessage values sent by the handler with json.Valid, enabled by
+// default. Disable it when the payloads are known to be well-formed and
+// validating them is too costly: invalid ones are then rejected by the server.
+func WithRawJSONValidation(enabled bool) Option {
+	return func(o *options) {
+		o.skipRawJSON = !enabled
+	}
+}
+
+// WithMiddleware adds middlewares to the handler, see Use
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(o *options) {
+		for _, m := range middlewares {
+			if m == nil {
+				o.invalid("nil middleware")
+				return
+			}
+		}
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// WithRetryPolicy sets the retry policy of the handler, see SetRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		if policy.MaxAttempts < 0 || policy.MinBackoff < 0 || policy.MaxBackoff < 0 {
+			o.invalid("negative retry policy")
+			return
+		}
+		if policy.MaxBackoff > 0 && policy.MinBackoff > policy.MaxBackoff {
+			o.invalid("retry MinBackoff %v above MaxBackoff %v", policy.MinBackoff, policy.MaxBackoff)
+			return
+		}
+		o.retry = &policy
+	}
+}
+
+// WithGetOptions sets the options of the JSON.GET commands called without any
+func WithGetOptions(opts ...rjs.GetOption) Option {
+	return func(o *options) {
+		if len(opts) > 4 {
+			o.errs = append(o.errs, rjs.ErrTooManyOptionals)
+			return
+		}
+		seen := make(map[interface{}]bool)
+		for _, op := range opts {
+			name := op.Value()[0]
+			if seen[name] {
+				o.invalid("duplicate GET option %v", name)
+				return
+			}
+			seen[name] = true
+		}
+		o.getOptions = opts
+	}
+}
+
+// WithKeyPrefix prefixes the keys of every command of the handler, e.g. with
+// the name of a tenant, see WithPrefix
+func WithKeyPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithSchema validates the writes of the keys matching pattern against schema,
+// see RegisterSchema
+func WithSchema(pattern string, schema Schema) Option {
+	return func(o *options) {
+		if schema == nil {
+			o.invalid("nil schema")
+			return
+		}
+		o.schemas = append(o.schemas, schemaRule{pattern: pattern, schema: schema})
+	}
+}
+
+// New returns a handler configured with opts. Exactly one client must be set,
+// with WithRedigoClient or WithGoRedisClient.
+//
+//	rh, err := rejson.New(
+//		rejson.WithGoRedisClient(cli),
+//		rejson.WithRetryPolicy(rejson.RetryPolicy{MaxAttempts: 3}),
+//		rejson.WithKeyPrefix("tenant42:"),
+//	)
+func New(opts ...Option) (*Handler, error) {
+	o := &options{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	switch {
+	case len(o.errs) > 0:
+		return nil, o.errs[0]
+	case len(o.clients) == 0:
+		return nil, rjs.ErrNoClientSet
+	case len(o.clients) > 1:
+		return nil, rjs.ErrMultipleClients
+	}
+
+	r := NewReJSONHandler()
+	o.clients[0](r, o.ctx)
+	r.ctx = o.ctx
+	r.codec = o.codec
+	r.getOptions = o.getOptions
+	r.prefix = o.prefix
+	r.skipRawJSON = o.skipRawJSON
+	for _, rule := range o.schemas {
+		r.RegisterSchema(rule.pattern, rule.schema)
+	}
+	r.Use(o.middlewares...)
+	if o.retry != nil {
+		r.SetRetryPolicy(*o.retry)
+	}
+	return r, nil
+}
+
+// encode encodes a value sent by a command with the codec of the handler
+func (r *Handler) encode(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case rjs.RawJSON, json.RawMessage:
+		return v, nil
+	}
+	if r.codec == nil {
+		return v, nil
+	}
+	b, err := r.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return rjs.RawJSON(b), nil
+}
+
+// encodeAll encodes the values sent by a command with the codec of the handler
+func (r *Handler) encodeAll(values []interface{}) ([]interface{}, error) {
+	if r.codec == nil {
+		return values, nil
+	}
+	encoded := make([]interface{}, len(values))
+	for i, v := range values {
+		var err error
+		if encoded[i], err = r.encode(v); err != nil {
+			return nil, err
+		}
+	}
+	return encoded, nil
+}
+
+// validRawJSON checks the rjs.RawJSON and json.RawMessage values among values
+// with json.Valid, unless disabled with WithRawJSONValidation
+func (r *Handler) validRawJSON(values []interface{}) error {
+	if r.skipRawJSON {
+		return nil
+	}
+	for _, v := range values {
+		var b []byte
+		switch raw := v.(type) {
+		case rjs.RawJSON:
+			b = raw
+		case json.RawMessage:
+			b = raw
+		default:
+			continue
+		}
+		if !json.Valid(b) {
+			return rjs.ErrInvalidRawJSON
+		}
+	}
+	return nil
+}
+
+// decode decodes a json reply into v, with the codec of the handler if set and
+// with rjs.Unmarshal otherwise
+func (r *Handler) decode(reply interface{}, v interface{}) error {
+	if r.codec == nil {
+		return rjs.Unmarshal(reply, v)
+	}
+	switch b := reply.(type) {
+	case []byte:
+		return r.codec.Unmarshal(b, v)
+	case string:
+		return r.codec.Unmarshal([]byte(b), v)
+	case json.RawMessage:
+		return r.codec.Unmarshal(b, v)
+	case nil:
+		return rjs.ErrNilReply
+	}
+	return fmt.Errorf("error: cannot decode reply of type %T", reply)
+}
+
+// getOptionsOrDefault returns opts, or the default GET options if there are none
+func (r *Handler) getOptionsOrDefault(opts []rjs.GetOption) []rjs.GetOption {
+	if len(opts) == 0 {
+		return r.getOptions
+	}
+	return opts
+}
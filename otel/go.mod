@@ -0,0 +1,26 @@
+module github.com/nitishm/go-rejson/v4/otel
+
+go 1.20
+
+// The root module is replaced by the working tree for local development only:
+// consumers resolve the required version, the first release with the APIs used
+// here, tagged before this module, see CONTRIBUTING.md.
+replace github.com/nitishm/go-rejson/v4 => ../
+
+require (
+	github.com/nitishm/go-rejson/v4 v4.3.0
+	go.opentelemetry.io/otel v1.19.0
+	go.opentelemetry.io/otel/sdk v1.19.0
+	go.opentelemetry.io/otel/trace v1.19.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/go-logr/logr v1.2.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/gomodule/redigo v1.8.3 // indirect
+	github.com/redis/go-redis/v9 v9.0.2 // indirect
+	go.opentelemetry.io/otel/metric v1.19.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+)
@@ -0,0 +1,111 @@
+// Package otel traces the commands of a rejson.Handler with OpenTelemetry.
+//
+//	rh := rejson.NewReJSONHandler()
+//	rh.SetGoRedisClientWithContext(ctx, cli)
+//	rh.Use(otel.Middleware())
+//
+// Every command is recorded as a client span, child of the span of the
+// handler's context, see rejson.Handler.SetContext. With go-redis the span is
+// also propagated to the client, so that spans of go-redis hooks are nested in it.
+package otel
+
+import (
+	"github.com/nitishm/go-rejson/v4"
+	"github.com/nitishm/go-rejson/v4/rjs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the tracer of the middleware
+const instrumentationName = "github.com/nitishm/go-rejson/v4/otel"
+
+// Attribute keys of the spans, besides the db.system and db.operation
+// semantic conventions
+const (
+	KeyKey         = attribute.Key("db.rejson.key")
+	KeysKey        = attribute.Key("db.rejson.keys")
+	PathKey        = attribute.Key("db.rejson.path")
+	ClientKey      = attribute.Key("db.rejson.client")
+	PayloadSizeKey = attribute.Key("db.rejson.payload_size")
+)
+
+type config struct {
+	provider   trace.TracerProvider
+	attributes []attribute.KeyValue
+	keys       bool
+}
+
+// Option configures the tracing middleware
+type Option func(c *config)
+
+// WithTracerProvider sets the provider of the tracer, the global one if not set
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = provider
+	}
+}
+
+// WithAttributes adds attributes to every span, e.g. net.peer.name
+func WithAttributes(attributes ...attribute.KeyValue) Option {
+	return func(c *config) {
+		c.attributes = append(c.attributes, attributes...)
+	}
+}
+
+// WithoutKeys leaves the keys out of the spans, when they hold sensitive data
+func WithoutKeys() Option {
+	return func(c *config) {
+		c.keys = false
+	}
+}
+
+// Middleware returns a rejson.Middleware creating a span per command, named
+// after the command, e.g. JSON.SET
+func Middleware(opts ...Option) rejson.Middleware {
+	c := &config{keys: true}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.provider == nil {
+		c.provider = otel.GetTracerProvider()
+	}
+	tracer := c.provider.Tracer(instrumentationName)
+
+	return func(next rejson.Invoker) rejson.Invoker {
+		return func(inv *rejson.Invocation) (interface{}, error) {
+			attrs := append([]attribute.KeyValue{
+				semconv.DBSystemRedis,
+				semconv.DBOperation(inv.Command.String()),
+				ClientKey.String(inv.Client),
+				PathKey.String(inv.Path),
+			}, c.attributes...)
+			if c.keys {
+				if inv.Key != "" {
+					attrs = append(attrs, KeyKey.String(inv.Key))
+				}
+				if len(inv.Keys) > 0 {
+					attrs = append(attrs, KeysKey.StringSlice(inv.Keys))
+				}
+			}
+
+			ctx, span := tracer.Start(inv.Context, inv.Command.String(),
+				trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+			defer span.End()
+			inv.Context = ctx
+
+			res, err := next(inv)
+			if size := inv.PayloadSize(); size > 0 {
+				span.SetAttributes(PayloadSizeKey.Int(size))
+			}
+			// a missing key is not a failure of the command
+			if err != nil && err.Error() != rjs.ErrGoRedisNil.Error() {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return res, err
+		}
+	}
+}
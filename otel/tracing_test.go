@@ -0,0 +1,117 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nitishm/go-rejson/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeConn is a redigo connection replying with reply to every command
+type fakeConn struct {
+	reply interface{}
+	err   error
+}
+
+func (f *fakeConn) Do(string, ...interface{}) (interface{}, error) {
+	return f.reply, f.err
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	conn := &fakeConn{reply: "OK"}
+	rh := rejson.NewReJSONHandler()
+	rh.SetRedigoClient(conn)
+	var spanCtx trace.SpanContext
+	rh.Use(func(next rejson.Invoker) rejson.Invoker {
+		return func(inv *rejson.Invocation) (interface{}, error) {
+			inv.Context = ctx
+			return next(inv)
+		}
+	}, Middleware(WithTracerProvider(provider)), func(next rejson.Invoker) rejson.Invoker {
+		return func(inv *rejson.Invocation) (interface{}, error) {
+			spanCtx = trace.SpanContextFromContext(inv.Context)
+			return next(inv)
+		}
+	})
+
+	if _, err := rh.JSONSet("key", ".", map[string]int{"a": 1}); err != nil {
+		t.Fatalf("JSONSet() error = %v", err)
+	}
+	conn.reply, conn.err = nil, errors.New("ERR wrong type")
+	if _, err := rh.JSONGet("key", ".a"); err == nil {
+		t.Fatalf("JSONGet() error = nil, want an error")
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	set, get := spans[0], spans[1]
+	if set.Name() != "JSON.SET" || set.SpanKind() != trace.SpanKindClient {
+		t.Errorf("span = %s %v, want JSON.SET client span", set.Name(), set.SpanKind())
+	}
+	if set.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("JSON.SET span is not a child of the context's span")
+	}
+	if spanCtx.SpanID() != get.SpanContext().SpanID() {
+		t.Errorf("span not propagated to the next invoker's context")
+	}
+
+	want := map[attribute.Key]attribute.Value{
+		"db.system":    attribute.StringValue("redis"),
+		"db.operation": attribute.StringValue("JSON.SET"),
+		KeyKey:         attribute.StringValue("key"),
+		PathKey:        attribute.StringValue("."),
+		ClientKey:      attribute.StringValue("redigo"),
+		PayloadSizeKey: attribute.IntValue(len(`{"a":1}`)),
+	}
+	got := make(map[attribute.Key]attribute.Value)
+	for _, kv := range set.Attributes() {
+		got[kv.Key] = kv.Value
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("attribute %s = %v, want %v", k, got[k].Emit(), v.Emit())
+		}
+	}
+	if set.Status().Code != codes.Unset {
+		t.Errorf("JSON.SET status = %v, want unset", set.Status())
+	}
+	if get.Status().Code != codes.Error || len(get.Events()) != 1 {
+		t.Errorf("JSON.GET status = %v, events = %v, want an error", get.Status(), get.Events())
+	}
+}
+
+func TestMiddlewareSetContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	rh := rejson.NewReJSONHandler()
+	rh.SetRedigoClient(&fakeConn{reply: "OK"})
+	rh.Use(Middleware(WithTracerProvider(provider)))
+
+	if _, err := rh.SetContext(ctx).JSONSet("key", ".", 1); err != nil {
+		t.Fatalf("JSONSet() error = %v", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "JSON.SET" {
+		t.Fatalf("got %d spans, want JSON.SET and its parent", len(spans))
+	}
+	if spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("JSON.SET span is not a child of the span of the redigo handler's context")
+	}
+}
@@ -0,0 +1,54 @@
+package rejson
+
+import (
+	"strings"
+)
+
+// WithPrefix returns a handler sharing the client and the configuration of r,
+// prefixing the keys of every command with prefix, after the prefix of r if
+// any. The keys returned by ScanJSON are stripped of the prefix, so that
+// callers only ever see their own key space:
+//
+//	tenant := rh.WithPrefix("tenant42:")
+//	tenant.JSONSet("user:1", ".", user) // JSON.SET tenant42:user:1 . ...
+//
+// A prefix made of a hash tag, e.g. {tenant42}:, keeps the keys of a tenant in
+// the same Redis Cluster slot, see rjs.HashTag.
+//
+// The returned handler shares the client of r: a client set on either, e.g. on
+// a failover, is used by both. It shares the JSONGet cache as well, see
+// EnableCache.
+func (r *Handler) WithPrefix(prefix string) *Handler {
+	h := &Handler{state: r.shared(), handlerConfig: r.handlerConfig}
+	h.prefix = r.prefix + prefix
+	return h
+}
+
+// Prefix returns the key prefix of the handler
+func (r *Handler) Prefix() string {
+	return r.prefix
+}
+
+// prefixKey prefixes key, unless it is empty as for JSON.DEBUG HELP
+func prefixKey(prefix, key string) string {
+	if key == "" {
+		return key
+	}
+	return prefix + key
+}
+
+// escapeGlob escapes the special characters of a SCAN MATCH pattern in s
+func escapeGlob(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
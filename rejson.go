@@ -1,19 +1,81 @@
 package rejson
 
 import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/nitishm/go-rejson/v4/clients"
 	"github.com/nitishm/go-rejson/v4/rjs"
 )
 
+// Handler sends the ReJSON commands with its client. The client can be set or
+// replaced while commands are in flight, but the rest of the configuration
+// cannot: the methods changing it, e.g. Use, SetRetryPolicy, EnableCache,
+// RegisterSchema or AuditWrites, must be called before the handler is used
+// concurrently.
 type Handler struct {
-	clientName     string
-	implementation ReJSON
+	// state is shared with the handlers derived with WithPrefix, IfVersion and
+	// SetContext
+	state *sharedState
+	handlerConfig
+}
+
+// sharedState is the state of a Handler shared with the handlers derived from
+// it, updated atomically while commands are in flight
+type sharedState struct {
+	// client holds the *activeClient of the handlers, swapped so that clients
+	// can be replaced while commands are in flight
+	client atomic.Value
+	// cache holds the *documentCache of the JSONGet replies, so that the writes
+	// through every handler invalidate it, see EnableCache
+	cache atomic.Value
+}
+
+// handlerConfig is the configuration of a Handler, copied to the handlers
+// derived from it with SetContext. It is read without synchronization by the
+// commands in flight, see Handler.
+type handlerConfig struct {
+	// ctx is the default context of the commands, see WithContext
+	ctx context.Context
+	// callCtx is the context of the commands set with SetContext, taking
+	// precedence over the context of the client
+	callCtx context.Context
+	// codec encodes the values sent and decodes the documents read, see WithCodec
+	codec Codec
+	// skipRawJSON sends the raw json values unchecked, see WithRawJSONValidation
+	skipRawJSON bool
+	// getOptions are the default options of JSON.GET, see WithGetOptions
+	getOptions []rjs.GetOption
+	// prefix prefixes the keys of every command, see WithKeyPrefix
+	prefix string
+	// validateSlots rejects multi-key commands whose keys span cluster slots
+	validateSlots bool
+	// middlewares wrap every command, see Use
+	middlewares []Middleware
+	// retry retries the commands failing with transient errors, see SetRetryPolicy
+	retry *RetryPolicy
+	// breaker fails the commands fast while the backend is degraded, see SetCircuitBreaker
+	breaker *circuitBreaker
+	// schemas validate the writes of the keys matching their pattern, see RegisterSchema
+	schemas []schemaRule
+	// versionPath is the path of the version incremented by every write, see EnableVersioning
+	versionPath string
+	// ifVersion is the version required by the writes, see IfVersion
+	ifVersion *int64
 }
 
 func NewReJSONHandler() *Handler {
-	return &Handler{clientName: rjs.ClientInactive}
+	r := &Handler{state: new(sharedState)}
+	r.SetClientInactive()
+	return r
 }
 
 // ReJSON provides an interface for various Go Redis Clients to implement ReJSON commands
+//
+// The clients of this package also implement the optional clients.ScriptRunner
+// and clients.NumberUpdater interfaces, required by the Handler methods running
+// Lua scripts and updating numbers by arbitrary precision amounts.
 type ReJSON interface {
 	JSONSet(key, path string, obj interface{}, opts ...rjs.SetOption) (res interface{}, err error)
 
@@ -56,6 +118,12 @@ type ReJSON interface {
 	JSONResp(key, path string) (res interface{}, err error)
 }
 
+// notSupported returns the error of the command of a client c not implementing
+// an optional interface
+func notSupported(c ReJSON, command string) error {
+	return fmt.Errorf("%w: %T cannot send %s", rjs.ErrNotSupported, c, command)
+}
+
 // JSONSet used to set a json object
 //
 // ReJSON syntax:
@@ -65,13 +133,19 @@ type ReJSON interface {
 func (r *Handler) JSONSet(key string, path string, obj interface{}, opts ...rjs.SetOption) (
 	res interface{}, err error,
 ) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
+	if obj, err = r.encode(obj); err != nil {
+		return nil, err
+	}
+	inv := &Invocation{
+		Command: rjs.ReJSONCommandSET, Key: key, Path: path,
+		Args: append([]interface{}{obj}, setOptionArgs(opts)...),
 	}
-	return r.implementation.JSONSet(key, path, obj, opts...)
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONSet(inv.Key, inv.Path, inv.sentArgs()[0], opts...)
+	})
 }
 
-// JSONGet used to get a json object
+// JSONGet used to get a json object, from the local cache when enabled, see EnableCache
 //
 // ReJSON syntax:
 //
@@ -82,22 +156,42 @@ func (r *Handler) JSONSet(key string, path string, obj interface{}, opts ...rjs.
 //			[NOESCAPE]
 //			[path ...]
 func (r *Handler) JSONGet(key, path string, opts ...rjs.GetOption) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
+	opts = r.getOptionsOrDefault(opts)
+	inv := &Invocation{Command: rjs.ReJSONCommandGET, Key: key, Path: path, Args: getOptionArgs(opts), cacheable: true}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONGet(inv.Key, inv.Path, opts...)
+	})
+}
+
+// JSONGetInto gets the json value at path and decodes it into v with rjs.Unmarshal,
+// so numbers beyond the float64 range of exact integers keep their precision, or
+// with the codec of the handler, see WithCodec
+func (r *Handler) JSONGetInto(key, path string, v interface{}, opts ...rjs.GetOption) error {
+	res, err := r.JSONGet(key, path, opts...)
+	if err != nil {
+		return err
 	}
-	return r.implementation.JSONGet(key, path, opts...)
+	return r.decode(res, v)
 }
 
 // JSONMGet used to get path values from multiple keys
 //
+// With slot validation enabled, see SetSlotValidation, keys that do not share
+// a cluster slot are rejected with rjs.ErrCrossSlot before the command is sent.
+//
 // ReJSON syntax:
 //
 //	JSON.MGET <key> [key ...] <path>
 func (r *Handler) JSONMGet(path string, keys ...string) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONMGet(path, keys...)
+	inv := &Invocation{Command: rjs.ReJSONCommandMGET, Keys: keys, Path: path}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		if r.validateSlots {
+			if err := rjs.ValidateSameSlot(inv.Keys...); err != nil {
+				return nil, err
+			}
+		}
+		return c.JSONMGet(inv.Path, inv.Keys...)
+	})
 }
 
 // JSONDel to delete a json object
@@ -106,10 +200,10 @@ func (r *Handler) JSONMGet(path string, keys ...string) (res interface{}, err er
 //
 //	JSON.DEL <key> <path>
 func (r *Handler) JSONDel(key string, path string) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONDel(key, path)
+	inv := &Invocation{Command: rjs.ReJSONCommandDEL, Key: key, Path: path}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONDel(inv.Key, inv.Path)
+	})
 }
 
 // JSONType to get the type of key or member at path.
@@ -118,10 +212,10 @@ func (r *Handler) JSONDel(key string, path string) (res interface{}, err error)
 //
 //	JSON.TYPE <key> [path]
 func (r *Handler) JSONType(key, path string) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONType(key, path)
+	inv := &Invocation{Command: rjs.ReJSONCommandTYPE, Key: key, Path: path}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONType(inv.Key, inv.Path)
+	})
 }
 
 // JSONNumIncrBy to increment a number by provided amount
@@ -130,10 +224,10 @@ func (r *Handler) JSONType(key, path string) (res interface{}, err error) {
 //
 //	JSON.NUMINCRBY <key> <path> <number>
 func (r *Handler) JSONNumIncrBy(key, path string, number int) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONNumIncrBy(key, path, number)
+	inv := &Invocation{Command: rjs.ReJSONCommandNUMINCRBY, Key: key, Path: path, Args: []interface{}{number}}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONNumIncrBy(inv.Key, inv.Path, number)
+	})
 }
 
 // JSONNumMultBy to increment a number by provided amount
@@ -142,10 +236,46 @@ func (r *Handler) JSONNumIncrBy(key, path string, number int) (res interface{},
 //
 //	JSON.NUMMULTBY <key> <path> <number>
 func (r *Handler) JSONNumMultBy(key, path string, number int) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONNumMultBy(key, path, number)
+	inv := &Invocation{Command: rjs.ReJSONCommandNUMMULTBY, Key: key, Path: path, Args: []interface{}{number}}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONNumMultBy(inv.Key, inv.Path, number)
+	})
+}
+
+// JSONNumIncrByNumber to increment a number by an arbitrary precision amount.
+// Besides Go's integer and float types, number may be a json.Number, *big.Int
+// or *big.Float, which are sent as their exact decimal literal
+//
+// ReJSON syntax:
+//
+//	JSON.NUMINCRBY <key> <path> <number>
+func (r *Handler) JSONNumIncrByNumber(key, path string, number interface{}) (res interface{}, err error) {
+	inv := &Invocation{Command: rjs.ReJSONCommandNUMINCRBY, Key: key, Path: path, Args: []interface{}{number}}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		updater, ok := c.(clients.NumberUpdater)
+		if !ok {
+			return nil, notSupported(c, "JSON.NUMINCRBY of an arbitrary precision amount")
+		}
+		return updater.JSONNumIncrByNumber(inv.Key, inv.Path, number)
+	})
+}
+
+// JSONNumMultByNumber to multiply a number by an arbitrary precision amount.
+// Besides Go's integer and float types, number may be a json.Number, *big.Int
+// or *big.Float, which are sent as their exact decimal literal
+//
+// ReJSON syntax:
+//
+//	JSON.NUMMULTBY <key> <path> <number>
+func (r *Handler) JSONNumMultByNumber(key, path string, number interface{}) (res interface{}, err error) {
+	inv := &Invocation{Command: rjs.ReJSONCommandNUMMULTBY, Key: key, Path: path, Args: []interface{}{number}}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		updater, ok := c.(clients.NumberUpdater)
+		if !ok {
+			return nil, notSupported(c, "JSON.NUMMULTBY of an arbitrary precision amount")
+		}
+		return updater.JSONNumMultByNumber(inv.Key, inv.Path, number)
+	})
 }
 
 // JSONStrAppend to append a jsonstring to an existing member
@@ -154,10 +284,10 @@ func (r *Handler) JSONNumMultBy(key, path string, number int) (res interface{},
 //
 //	JSON.STRAPPEND <key> [path] <json-string>
 func (r *Handler) JSONStrAppend(key, path, jsonstring string) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONStrAppend(key, path, jsonstring)
+	inv := &Invocation{Command: rjs.ReJSONCommandSTRAPPEND, Key: key, Path: path, Args: []interface{}{jsonstring}}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONStrAppend(inv.Key, inv.Path, jsonstring)
+	})
 }
 
 // JSONStrLen to return the length of a string member
@@ -166,10 +296,10 @@ func (r *Handler) JSONStrAppend(key, path, jsonstring string) (res interface{},
 //
 //	JSON.STRLEN <key> [path]
 func (r *Handler) JSONStrLen(key, path string) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONStrLen(key, path)
+	inv := &Invocation{Command: rjs.ReJSONCommandSTRLEN, Key: key, Path: path}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONStrLen(inv.Key, inv.Path)
+	})
 }
 
 // JSONArrAppend to append json value into array at path
@@ -178,10 +308,13 @@ func (r *Handler) JSONStrLen(key, path string) (res interface{}, err error) {
 //
 //	JSON.ARRAPPEND <key> <path> <json> [json ...]
 func (r *Handler) JSONArrAppend(key, path string, values ...interface{}) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
+	if values, err = r.encodeAll(values); err != nil {
+		return nil, err
 	}
-	return r.implementation.JSONArrAppend(key, path, values...)
+	inv := &Invocation{Command: rjs.ReJSONCommandARRAPPEND, Key: key, Path: path, Args: values}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONArrAppend(inv.Key, inv.Path, inv.sentArgs()...)
+	})
 }
 
 // JSONArrLen returns the length of the json array at path
@@ -190,10 +323,10 @@ func (r *Handler) JSONArrAppend(key, path string, values ...interface{}) (res in
 //
 //	JSON.ARRLEN <key> [path]
 func (r *Handler) JSONArrLen(key, path string) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONArrLen(key, path)
+	inv := &Invocation{Command: rjs.ReJSONCommandARRLEN, Key: key, Path: path}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONArrLen(inv.Key, inv.Path)
+	})
 }
 
 // JSONArrPop removes and returns element from the index in the array
@@ -203,10 +336,10 @@ func (r *Handler) JSONArrLen(key, path string) (res interface{}, err error) {
 //
 //	JSON.ARRPOP <key> [path [index]]
 func (r *Handler) JSONArrPop(key, path string, index int) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONArrPop(key, path, index)
+	inv := &Invocation{Command: rjs.ReJSONCommandARRPOP, Key: key, Path: path, Args: []interface{}{index}}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONArrPop(inv.Key, inv.Path, index)
+	})
 }
 
 // JSONArrIndex returns the index of the json element provided and return -1 if element is not present
@@ -217,10 +350,16 @@ func (r *Handler) JSONArrPop(key, path string, index int) (res interface{}, err
 func (r *Handler) JSONArrIndex(key, path string, jsonValue interface{}, optionalRange ...int) (
 	res interface{}, err error,
 ) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
+	if jsonValue, err = r.encode(jsonValue); err != nil {
+		return nil, err
+	}
+	inv := &Invocation{
+		Command: rjs.ReJSONCommandARRINDEX, Key: key, Path: path,
+		Args: append([]interface{}{jsonValue}, intArgs(optionalRange)...),
 	}
-	return r.implementation.JSONArrIndex(key, path, jsonValue, optionalRange...)
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONArrIndex(inv.Key, inv.Path, inv.sentArgs()[0], optionalRange...)
+	})
 }
 
 // JSONArrTrim trims an array so that it contains only the specified inclusive range of elements
@@ -229,10 +368,10 @@ func (r *Handler) JSONArrIndex(key, path string, jsonValue interface{}, optional
 //
 //	JSON.ARRTRIM <key> <path> <start> <stop>
 func (r *Handler) JSONArrTrim(key, path string, start, end int) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONArrTrim(key, path, start, end)
+	inv := &Invocation{Command: rjs.ReJSONCommandARRTRIM, Key: key, Path: path, Args: []interface{}{start, end}}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONArrTrim(inv.Key, inv.Path, start, end)
+	})
 }
 
 // JSONArrInsert inserts the json value(s) into the array at path before the index (shifts to the right).
@@ -241,10 +380,16 @@ func (r *Handler) JSONArrTrim(key, path string, start, end int) (res interface{}
 //
 //	JSON.ARRINSERT <key> <path> <index> <json> [json ...]
 func (r *Handler) JSONArrInsert(key, path string, index int, values ...interface{}) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
+	if values, err = r.encodeAll(values); err != nil {
+		return nil, err
+	}
+	inv := &Invocation{
+		Command: rjs.ReJSONCommandARRINSERT, Key: key, Path: path,
+		Args: append([]interface{}{index}, values...),
 	}
-	return r.implementation.JSONArrInsert(key, path, index, values...)
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONArrInsert(inv.Key, inv.Path, index, inv.sentArgs()[1:]...)
+	})
 }
 
 // JSONObjKeys returns the keys in the object that's referenced by path
@@ -253,10 +398,10 @@ func (r *Handler) JSONArrInsert(key, path string, index int, values ...interface
 //
 //	JSON.OBJKEYS <key> [path]
 func (r *Handler) JSONObjKeys(key, path string) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONObjKeys(key, path)
+	inv := &Invocation{Command: rjs.ReJSONCommandOBJKEYS, Key: key, Path: path}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONObjKeys(inv.Key, inv.Path)
+	})
 }
 
 // JSONObjLen report the number of keys in the JSON Object at path in key
@@ -265,10 +410,10 @@ func (r *Handler) JSONObjKeys(key, path string) (res interface{}, err error) {
 //
 //	JSON.OBJLEN <key> [path]
 func (r *Handler) JSONObjLen(key, path string) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONObjLen(key, path)
+	inv := &Invocation{Command: rjs.ReJSONCommandOBJLEN, Key: key, Path: path}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONObjLen(inv.Key, inv.Path)
+	})
 }
 
 // JSONDebug reports information
@@ -279,10 +424,10 @@ func (r *Handler) JSONObjLen(key, path string) (res interface{}, err error) {
 //		JSON.DEBUG MEMORY <key> [path]	- report the memory usage in bytes of a value. path defaults to root if not provided.
 //		JSON.DEBUG HELP					- reply with a helpful message
 func (r *Handler) JSONDebug(subCmd rjs.DebugSubCommand, key, path string) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONDebug(subCmd, key, path)
+	inv := &Invocation{Command: rjs.ReJSONCommandDEBUG, Key: key, Path: path, Args: []interface{}{subCmd}}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONDebug(subCmd, inv.Key, inv.Path)
+	})
 }
 
 // JSONForget is an alias for JSONDel
@@ -291,10 +436,10 @@ func (r *Handler) JSONDebug(subCmd rjs.DebugSubCommand, key, path string) (res i
 //
 //	JSON.FORGET <key> [path]
 func (r *Handler) JSONForget(key, path string) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONForget(key, path)
+	inv := &Invocation{Command: rjs.ReJSONCommandFORGET, Key: key, Path: path}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONForget(inv.Key, inv.Path)
+	})
 }
 
 // JSONResp returns the JSON in key in Redis Serialization Protocol (RESP).
@@ -303,8 +448,8 @@ func (r *Handler) JSONForget(key, path string) (res interface{}, err error) {
 //
 //	JSON.RESP <key> [path]
 func (r *Handler) JSONResp(key, path string) (res interface{}, err error) {
-	if r.clientName == rjs.ClientInactive {
-		return nil, rjs.ErrNoClientSet
-	}
-	return r.implementation.JSONResp(key, path)
+	inv := &Invocation{Command: rjs.ReJSONCommandRESP, Key: key, Path: path}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		return c.JSONResp(inv.Key, inv.Path)
+	})
 }
@@ -1,11 +1,22 @@
 package rejson
 
 import (
+	"container/list"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/nitishm/go-rejson/v4/clients"
+	"io"
+	"math/big"
+	"os"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/nitishm/go-rejson/v4/rjs"
 
@@ -20,249 +31,2462 @@ func TestUnsupportedCommand(t *testing.T) {
 	}
 }
 
-type TestClient struct {
-	*testing.T
-	name string
-	conn interface{}
-	rh   *Handler
-}
-
-type helper struct {
-	cli       interface{}
-	name      string
-	closeFunc func()
+func TestRawJSONCommandBuilder(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     rjs.ReJSONCommandID
+		args    []interface{}
+		want    []interface{}
+		wantErr bool
+	}{
+		{
+			name: "SetRawJSON",
+			cmd:  rjs.ReJSONCommandSET,
+			args: []interface{}{"key", ".", rjs.RawJSON(`{"a": 1}`)},
+			want: []interface{}{"key", ".", []byte(`{"a": 1}`)},
+		},
+		{
+			name: "SetRawMessage",
+			cmd:  rjs.ReJSONCommandSET,
+			args: []interface{}{"key", ".", json.RawMessage(`[1, 2]`), "NX"},
+			want: []interface{}{"key", ".", []byte(`[1, 2]`), "NX"},
+		},
+		{
+			name: "SetString",
+			cmd:  rjs.ReJSONCommandSET,
+			args: []interface{}{"key", ".", `{"a": 1}`},
+			want: []interface{}{"key", ".", []byte(`"{\"a\": 1}"`)},
+		},
+		{
+			name: "ArrAppendMixed",
+			cmd:  rjs.ReJSONCommandARRAPPEND,
+			args: []interface{}{"key", ".", rjs.RawJSON(`{"a":1}`), 2},
+			want: []interface{}{"key", ".", []byte(`{"a":1}`), []byte(`2`)},
+		},
+		{
+			name: "ArrInsertRawJSON",
+			cmd:  rjs.ReJSONCommandARRINSERT,
+			args: []interface{}{"key", ".", 0, rjs.RawJSON(`"x"`)},
+			want: []interface{}{"key", ".", 0, []byte(`"x"`)},
+		},
+		{
+			name: "ArrIndexRawJSON",
+			cmd:  rjs.ReJSONCommandARRINDEX,
+			args: []interface{}{"key", ".", rjs.RawJSON(`3`)},
+			want: []interface{}{"key", ".", []byte(`3`)},
+		},
+		{
+			name: "InvalidRawJSONVerbatim",
+			cmd:  rjs.ReJSONCommandSET,
+			args: []interface{}{"key", ".", rjs.RawJSON(`{"a":`)},
+			want: []interface{}{"key", ".", []byte(`{"a":`)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got, err := rjs.CommandBuilder(tt.cmd, tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CommandBuilder() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CommandBuilder() = %q, want %q", got, tt.want)
+			}
+		})
+	}
 }
 
-func (t *TestClient) init() []helper {
-	t.name = "-"
-	t.conn = "inactive"
-	t.rh = NewReJSONHandler()
+func TestRawJSONValidation(t *testing.T) {
+	conn := &fakeConn{reply: "OK"}
+	rh := NewReJSONHandler()
+	rh.SetRedigoClient(conn)
+	if _, err := rh.JSONSet("key", ".", rjs.RawJSON(`{"a":`)); err != rjs.ErrInvalidRawJSON {
+		t.Errorf("JSONSet() error = %v, want %v", err, rjs.ErrInvalidRawJSON)
+	}
+	if _, err := rh.JSONArrAppend("key", ".", 1, json.RawMessage(`[`)); err != rjs.ErrInvalidRawJSON {
+		t.Errorf("JSONArrAppend() error = %v, want %v", err, rjs.ErrInvalidRawJSON)
+	}
+	if len(conn.commands) != 0 {
+		t.Errorf("sent %v, want no command", conn.commands)
+	}
 
-	// Redigo Test Client
-	redigoCli, err := redigo.Dial("tcp", ":6379")
+	unchecked, err := New(WithRedigoClient(conn), WithRawJSONValidation(false))
 	if err != nil {
-		t.Fatalf("redigo - could not connect to redigo: %v", err)
-		return nil
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := unchecked.JSONSet("key", ".", rjs.RawJSON(`{"a":`)); err != nil {
+		t.Errorf("JSONSet() error = %v, want the value sent unchecked", err)
 	}
+	want := []interface{}{"JSON.SET", "key", ".", []byte(`{"a":`)}
+	if len(conn.commands) != 1 || !reflect.DeepEqual(conn.commands[0], want) {
+		t.Errorf("sent %q, want %q", conn.commands, want)
+	}
+}
 
-	// GoRedis Test Client
-	goredisCli := goredis.NewUniversalClient(&goredis.UniversalOptions{
-		Addrs: []string{"localhost:6379"},
-	})
+func TestLargeNumberPrecision(t *testing.T) {
+	bigInt, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	bigFloat, _, _ := big.ParseFloat("3.14159265358979323846264338327950288", 10, 128, big.ToNearestEven)
 
-	return []helper{
-		{cli: redigoCli, name: "Redigo ", closeFunc: func() {
-			_, err = redigoCli.Do("FLUSHALL")
-			if err != nil {
-				t.Fatalf("redigo - failed to flush: %v", err)
+	t.Run("JSONNumber", func(t *testing.T) {
+		_, args, err := rjs.CommandBuilder(rjs.ReJSONCommandSET, "key", ".", json.Number("9007199254740993"))
+		if err != nil {
+			t.Fatalf("CommandBuilder() error = %v", err)
+		}
+		var got json.Number
+		if err := rjs.Unmarshal(args[2], &got); err != nil || got != "9007199254740993" {
+			t.Errorf("Unmarshal() = %v %v, want 9007199254740993", got, err)
+		}
+	})
+	t.Run("BigInt", func(t *testing.T) {
+		_, args, err := rjs.CommandBuilder(rjs.ReJSONCommandSET, "key", ".", bigInt)
+		if err != nil {
+			t.Fatalf("CommandBuilder() error = %v", err)
+		}
+		got := new(big.Int)
+		if err := rjs.Unmarshal(args[2], got); err != nil || got.Cmp(bigInt) != 0 {
+			t.Errorf("Unmarshal() = %v %v, want %v", got, err, bigInt)
+		}
+	})
+	t.Run("BigFloat", func(t *testing.T) {
+		_, args, err := rjs.CommandBuilder(rjs.ReJSONCommandSET, "key", ".", bigFloat)
+		if err != nil {
+			t.Fatalf("CommandBuilder() error = %v", err)
+		}
+		got := new(big.Float).SetPrec(bigFloat.Prec())
+		if err := rjs.Unmarshal(args[2], got); err != nil || got.Cmp(bigFloat) != 0 {
+			t.Errorf("Unmarshal() = %v %v, want %v", got, err, bigFloat)
+		}
+	})
+	t.Run("NestedBigFloat", func(t *testing.T) {
+		type price struct {
+			Amount *big.Float `json:"amount"`
+		}
+		type order struct {
+			Prices []price `json:"prices"`
+		}
+		rejected := []interface{}{
+			price{Amount: bigFloat},
+			&order{Prices: []price{{}, {Amount: bigFloat}}},
+			map[string]interface{}{"total": bigFloat},
+			[]interface{}{1, *bigFloat},
+		}
+		for _, value := range rejected {
+			if _, _, err := rjs.CommandBuilder(rjs.ReJSONCommandSET, "key", ".", value); !errors.Is(err, rjs.ErrInvalidNumber) {
+				t.Errorf("CommandBuilder(%T) error = %v, want %v", value, err, rjs.ErrInvalidNumber)
 			}
-			err = redigoCli.Close()
-			if err != nil {
-				t.Fatalf("redigo - failed to close: %v", err)
+		}
+		accepted := []interface{}{
+			price{},
+			order{Prices: []price{{}}},
+			map[string]interface{}{"total": bigInt, "at": time.Unix(0, 0)},
+			struct {
+				Amount json.Number `json:"amount"`
+			}{json.Number(bigFloat.Text('g', -1))},
+		}
+		for _, value := range accepted {
+			if _, _, err := rjs.CommandBuilder(rjs.ReJSONCommandSET, "key", ".", value); err != nil {
+				t.Errorf("CommandBuilder(%T) error = %v", value, err)
 			}
-		}},
-		{cli: goredisCli, name: "GoRedis ", closeFunc: func() {
-			if err := goredisCli.FlushAll(context.Background()).Err(); err != nil {
-				t.Fatalf("goredis - failed to flush: %v", err)
+		}
+	})
+	t.Run("InterfaceUsesNumber", func(t *testing.T) {
+		var got map[string]interface{}
+		if err := rjs.Unmarshal([]byte(`{"id":12345678901234567890}`), &got); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		if got["id"] != json.Number("12345678901234567890") {
+			t.Errorf("Unmarshal() = %#v, want json.Number", got["id"])
+		}
+	})
+	t.Run("NumIncrByArgs", func(t *testing.T) {
+		_, args, err := rjs.CommandBuilder(rjs.ReJSONCommandNUMINCRBY, "key", ".", bigInt)
+		if err != nil || args[2] != bigInt.String() {
+			t.Errorf("CommandBuilder() = %v %v, want %v", args, err, bigInt)
+		}
+		_, args, err = rjs.CommandBuilder(rjs.ReJSONCommandNUMINCRBY, "key", ".", 1)
+		if err != nil || args[2] != 1 {
+			t.Errorf("CommandBuilder() = %v %v, want 1", args, err)
+		}
+		for _, number := range []interface{}{json.Number("1x"), json.Number(""), "1", nil} {
+			_, _, err = rjs.CommandBuilder(rjs.ReJSONCommandNUMINCRBY, "key", ".", number)
+			if !errors.Is(err, rjs.ErrInvalidNumber) {
+				t.Errorf("CommandBuilder(%#v) error = %v, want %v", number, err, rjs.ErrInvalidNumber)
 			}
-			if err := goredisCli.Close(); err != nil {
-				t.Fatalf("goredis - failed to communicate to redis-server: %v", err)
+		}
+	})
+	t.Run("NamedNumberArgs", func(t *testing.T) {
+		type cents int64
+		type count uint8
+		type ratio float32
+		tests := []struct {
+			number interface{}
+			want   interface{}
+		}{
+			{cents(-1250), int64(-1250)},
+			{count(3), uint64(3)},
+			{ratio(0.1), "0.1"},
+		}
+		for _, tt := range tests {
+			_, args, err := rjs.CommandBuilder(rjs.ReJSONCommandNUMMULTBY, "key", ".", tt.number)
+			if err != nil || args[2] != tt.want {
+				t.Errorf("CommandBuilder(%#v) = %v %v, want %#v", tt.number, args, err, tt.want)
 			}
-		}},
+		}
+	})
+}
+
+func TestJSONPath(t *testing.T) {
+	tests := map[string]string{
+		"":          "$",
+		".":         "$",
+		"$.items":   "$.items",
+		".items":    "$.items",
+		"items":     "$.items",
+		"a.b":       "$.a.b",
+		"[0].items": "$[0].items",
+	}
+	for path, want := range tests {
+		if got := jsonPath(path); got != want {
+			t.Errorf("jsonPath(%q) = %q, want %q", path, got, want)
+		}
 	}
 }
 
-func (t *TestClient) SetTestingClient(conn interface{}) {
-	t.conn = conn
+func TestKeySlot(t *testing.T) {
+	tests := map[string]int{
+		"":                     0,
+		"123456789":            12739,
+		"foo":                  12182,
+		"bar":                  5061,
+		"{user1000}.following": rjs.KeySlot("user1000"),
+		"foo{{bar}}zap":        rjs.KeySlot("{bar"),
+		"foo{bar}{zap}":        rjs.KeySlot("bar"),
+	}
+	for key, want := range tests {
+		if got := rjs.KeySlot(key); got != want {
+			t.Errorf("KeySlot(%q) = %v, want %v", key, got, want)
+		}
+	}
+	if rjs.KeySlot("foo{}{bar}") == rjs.KeySlot("bar") {
+		t.Errorf("KeySlot() used the hash tag after an empty one")
+	}
+}
 
-	switch conn := conn.(type) {
-	case clients.RedigoClientConn:
-		t.name = "Redigo-"
-		t.rh.SetRedigoClient(conn)
-	case clients.GoRedisClientConn:
-		t.name = "GoRedis-"
-		t.rh.SetGoRedisClient(conn)
-	default:
-		t.name = "-"
-		t.conn = "inactive"
-		t.rh.SetClientInactive()
+func TestKeyBuilder(t *testing.T) {
+	kb := rjs.NewKeyBuilder("user:42")
+	profile, orders := kb.Key("profile"), kb.Key("orders", "latest")
+	if profile != "{user:42}:profile" || orders != "{user:42}:orders:latest" {
+		t.Errorf("Key() = %v, %v, want {user:42}:profile, {user:42}:orders:latest", profile, orders)
+	}
+	if rjs.KeySlot(profile) != kb.Slot() || rjs.KeySlot(orders) != kb.Slot() {
+		t.Errorf("Slot() = %v, want %v", kb.Slot(), rjs.KeySlot(profile))
+	}
+	if err := rjs.ValidateSameSlot(profile, orders, rjs.HashTag("user:42")); err != nil {
+		t.Errorf("ValidateSameSlot() error = %v", err)
+	}
+	if err := rjs.ValidateSameSlot(profile, "foo", "bar"); !errors.Is(err, rjs.ErrCrossSlot) {
+		t.Errorf("ValidateSameSlot() error = %v, want ErrCrossSlot", err)
+	}
+	if !rjs.SameSlot() || !rjs.SameSlot("foo") || rjs.SameSlot("foo", "bar") {
+		t.Errorf("SameSlot() returned unexpected results")
 	}
 }
 
-func TestReJSON(t *testing.T) {
-	test := TestClient{T: t}
-	list := test.init()
-	for _, obj := range list {
-		t.Run(obj.name+"TestJSONSet", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONSet(test.rh, t)
+func TestDocumentCache(t *testing.T) {
+	now := time.Now()
+	cache := &documentCache{
+		ttl:      time.Minute,
+		max:      2,
+		lru:      list.New(),
+		entries:  make(map[cacheKey]*list.Element),
+		paths:    make(map[string]map[cacheKey]struct{}),
+		fetching: make(map[string]map[*pendingFetch]struct{}),
+		now:      func() time.Time { return now },
+	}
+	fetches := 0
+	get := func(key, path string) interface{} {
+		res, _, _ := cache.get(newCacheKey(key, path, nil), func() (interface{}, error) {
+			fetches++
+			return []byte(fmt.Sprint(fetches)), nil
 		})
-		t.Run(obj.name+"TestJSONGet", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONGet(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONDel", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONDel(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONMGet", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONMGet(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONType", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONType(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONNumIncrBy", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONNumIncrBy(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONNumMultBy", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONNumMultBy(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONStrAppend", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONStrAppend(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONStrLen", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONStrLen(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONArrAppend", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONArrAppend(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONArrLen", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONArrLen(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONArrPop", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONArrPop(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONArrIndex", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONArrIndex(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONArrTrim", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONArrTrim(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONArrInsert", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONArrInsert(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONObjLen", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONObjLen(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONObjKeys", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONObjKeys(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONDebug", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONDebug(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONForget", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONForget(test.rh, t)
-		})
-		t.Run(obj.name+"TestJSONResp", func(t *testing.T) {
-			test.SetTestingClient(obj.cli)
-			testJSONResp(test.rh, t)
-		})
-		obj.closeFunc()
+		return string(res.([]byte))
 	}
 
-}
+	if get("a", ".") != "1" || get("a", ".") != "1" || fetches != 1 {
+		t.Errorf("get() fetched %d times, want a cached reply", fetches)
+	}
+	if get("a", "name") != "2" || get("b", ".") != "3" || get("a", ".") != "4" {
+		t.Errorf("get() did not evict the least recently used reply")
+	}
 
-func TestReJSONWithContext(t *testing.T) {
-	ctx := context.Background()
-	ctxCn, cancel := context.WithCancel(ctx)
-	cancel()
+	cache.invalidate([]string{"a"})
+	if get("a", ".") != "5" || get("b", ".") != "3" {
+		t.Errorf("invalidate() dropped the wrong replies")
+	}
 
-	testObj := TestObject{
-		Name:   "itemName",
-		Number: 1,
+	now = now.Add(time.Hour)
+	if get("b", ".") != "6" {
+		t.Errorf("get() returned an expired reply")
 	}
-	res := []byte("{\"name\":\"itemName\",\"number\":1}")
 
-	test := TestClient{T: t}
-	list := test.init()
-	for _, obj := range list {
-		test.SetTestingClient(obj.cli)
-		rh := test.rh
+	cache.invalidate(nil)
+	if len(cache.entries) != 0 || len(cache.paths) != 0 || cache.lru.Len() != 0 {
+		t.Errorf("invalidate(nil) left %d entries", len(cache.entries))
+	}
 
-		// check with canceled context
-		ok, err := rh.SetContext(ctxCn).JSONSet("testObj#1", ".", testObj)
-		if rh.clientName == rjs.ClientGoRedis {
-			if err == nil || ok == "OK" {
-				t.Errorf("JSONSet() got = %v %v, want nil, error: context.Canceled", ok, err)
-			}
-			got, err := rh.JSONGet("testObj#1", ".")
-			if err == nil || reflect.DeepEqual(got, res) {
-				t.Errorf("JSONGet() got = %v %v, want: no key found error", got, err)
-			}
-		} else {
-			if err != nil || ok != "OK" {
-				t.Errorf("JSONSet() got = %v %v, want OK, nil", ok, err)
-			}
-			got, err := rh.JSONGet("testObj#1", ".")
-			if err != nil || !reflect.DeepEqual(got, res) {
-				t.Errorf("JSONGet() got = %v %v, want: %v", got, err, res)
-			}
-		}
+	res, _, _ := cache.get(newCacheKey("c", ".", nil), func() (interface{}, error) {
+		cache.invalidate([]string{"c"})
+		return []byte("stale"), nil
+	})
+	if string(res.([]byte)) != "stale" || len(cache.entries) != 0 {
+		t.Errorf("get() cached a reply fetched during an invalidation")
+	}
+	cache.get(newCacheKey("c", ".", nil), func() (interface{}, error) {
+		cache.invalidate([]string{"d"})
+		return []byte("fresh"), nil
+	})
+	if _, hit, _ := cache.get(newCacheKey("c", ".", nil), nil); !hit || len(cache.fetching) != 0 {
+		t.Errorf("get() did not cache a reply fetched during the invalidation of another key")
+	}
 
-		// check with normal context
-		ok, err = rh.SetContext(ctx).JSONSet("testObj#2", ".", testObj)
-		if err != nil || ok != "OK" {
-			t.Errorf("JSONSet() got = %v %v, want OK, nil", ok, err)
+	if newCacheKey("a", ".", []rjs.GetOption{rjs.GETOptionINDENT}) == newCacheKey("a", ".", nil) {
+		t.Errorf("newCacheKey() ignored the options")
+	}
+}
+
+func TestCacheHitMiddleware(t *testing.T) {
+	conn := &fakeConn{reply: []byte(`{"a":1}`)}
+	rh, seen := recordingHandler(conn)
+	if err := rh.EnableCache(CacheOptions{}); err != nil {
+		t.Fatalf("EnableCache() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if res, err := rh.JSONGet("key", "."); err != nil || string(res.([]byte)) != `{"a":1}` {
+			t.Fatalf("JSONGet() = %s %v", res, err)
 		}
-		got, err := rh.JSONGet("testObj#2", ".")
-		if err != nil || !reflect.DeepEqual(got, res) {
-			t.Errorf("JSONGet() got = %v %v, want: %v", got, err, res)
+	}
+	if len(conn.commands) != 1 || len(*seen) != 2 {
+		t.Fatalf("sent %d commands, middleware saw %d, want 1 and 2", len(conn.commands), len(*seen))
+	}
+	if inv := seen.at(0); inv.Cached || inv.Attempts != 1 {
+		t.Errorf("first Invocation = %+v, want a sent command", inv)
+	}
+	if inv := seen.at(1); !inv.Cached || inv.Attempts != 0 || inv.Duration != 0 || inv.PayloadSize() != 7 {
+		t.Errorf("second Invocation = %+v, want a cache hit", inv)
+	}
+}
+
+func TestCacheSharedByDerivedHandlers(t *testing.T) {
+	conn := &fakeConn{reply: []byte(`{"a":1}`)}
+	rh := NewReJSONHandler()
+	rh.SetRedigoClient(conn)
+	tenant := rh.WithPrefix("tenant42:")
+	if err := tenant.EnableCache(CacheOptions{}); err != nil {
+		t.Fatalf("EnableCache() error = %v", err)
+	}
+	defer tenant.DisableCache()
+
+	get := func() {
+		if _, err := tenant.JSONGet("doc", "."); err != nil {
+			t.Fatalf("JSONGet() error = %v", err)
 		}
-		got, err = rh.SetContext(ctx).JSONGet("testObj#2", ".")
-		if err != nil || !reflect.DeepEqual(got, res) {
-			t.Errorf("JSONGet() got = %v %v, want: %v", got, err, res)
+	}
+	get()
+	get()
+	conn.reply = "OK"
+	if _, err := rh.JSONSet("tenant42:doc", ".a", 2); err != nil {
+		t.Fatalf("JSONSet() error = %v", err)
+	}
+	conn.reply = []byte(`{"a":2}`)
+	get()
+	if len(conn.commands) != 3 {
+		t.Errorf("sent %v, want the JSON.GET sent again after the write of the parent handler", conn.commands)
+	}
+}
+
+// TestCacheTracker checks the server-assisted invalidation of the cache, when a
+// document is modified by another client
+func TestCacheTracker(t *testing.T) {
+	writer, err := redigo.Dial("tcp", ":6379")
+	if err != nil {
+		t.Fatalf("redigo - could not connect to redigo: %v", err)
+	}
+	defer func() {
+		_, _ = writer.Do("FLUSHALL")
+		_ = writer.Close()
+	}()
+	if _, err = writer.Do("CLIENT", "TRACKING", "OFF"); err != nil {
+		t.Skipf("client side caching not supported by the server: %v", err)
+	}
+
+	redigoCli, err := redigo.Dial("tcp", ":6379")
+	if err != nil {
+		t.Fatalf("redigo - could not connect to redigo: %v", err)
+	}
+	defer redigoCli.Close()
+	goredisCli := goredis.NewClient(&goredis.Options{Addr: "localhost:6379"})
+	defer goredisCli.Close()
+
+	trackers := map[string]func(rh *Handler) clients.Tracker{
+		"Redigo": func(rh *Handler) clients.Tracker {
+			rh.SetRedigoClient(redigoCli)
+			return clients.NewRedigoTracker(func() (redigo.Conn, error) {
+				return redigo.Dial("tcp", ":6379")
+			}, "tracked:")
+		},
+		"GoRedis": func(rh *Handler) clients.Tracker {
+			rh.SetGoRedisClient(goredisCli)
+			return clients.NewGoRedisTracker(&goredis.Options{Addr: "localhost:6379"}, "tracked:")
+		},
+	}
+	for name, newTracker := range trackers {
+		t.Run(name, func(t *testing.T) {
+			rh := NewReJSONHandler()
+			tracker := newTracker(rh)
+			if err := rh.EnableCache(CacheOptions{Tracker: tracker}); err != nil {
+				t.Fatalf("EnableCache() error = %v", err)
+			}
+			defer rh.DisableCache()
+
+			if _, err := rh.JSONSet("tracked:doc", ".", 1); err != nil {
+				t.Fatal("Failed to Set key ", err)
+			}
+			if got, err := rh.JSONGet("tracked:doc", "."); err != nil || string(got.([]byte)) != "1" {
+				t.Fatalf("JSONGet() = %v %v, want 1", got, err)
+			}
+
+			if _, err := writer.Do("JSON.SET", "tracked:doc", ".", "2"); err != nil {
+				t.Fatal("Failed to Set key ", err)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				got, err := rh.JSONGet("tracked:doc", ".")
+				if err == nil && string(got.([]byte)) == "2" {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("JSONGet() = %v %v, want 2 after invalidation", got, err)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+// fakeConn is a RedigoClientConn replying with reply to every command, once
+// the failures are exhausted
+type fakeConn struct {
+	reply    interface{}
+	err      error
+	failures []error
+	commands [][]interface{}
+}
+
+func (f *fakeConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	f.commands = append(f.commands, append([]interface{}{commandName}, args...))
+	if len(f.failures) > 0 {
+		err := f.failures[0]
+		f.failures = f.failures[1:]
+		return nil, err
+	}
+	return f.reply, f.err
+}
+
+// invocations are the invocations recorded by the middleware of recordingHandler
+type invocations []Invocation
+
+func (s invocations) at(i int) *Invocation {
+	return &s[i]
+}
+
+func (s invocations) last() *Invocation {
+	return &s[len(s)-1]
+}
+
+// recordingHandler returns a handler sending its commands to a fakeConn, and the
+// invocations seen by its middleware once the commands returned
+func recordingHandler(conn *fakeConn) (*Handler, *invocations) {
+	rh := NewReJSONHandler()
+	rh.SetRedigoClient(conn)
+	seen := &invocations{}
+	rh.Use(func(next Invoker) Invoker {
+		return func(inv *Invocation) (interface{}, error) {
+			res, err := next(inv)
+			*seen = append(*seen, *inv)
+			return res, err
 		}
+	})
+	return rh, seen
+}
 
-		// check without context
-		ok, err = rh.JSONSet("testObj#3", ".", testObj)
-		if err != nil || ok != "OK" {
-			t.Errorf("JSONSet() got = %v %v, want OK, nil", ok, err)
+func TestMiddleware(t *testing.T) {
+	conn := &fakeConn{reply: "OK"}
+	rh := NewReJSONHandler()
+	rh.SetRedigoClient(conn)
+
+	var trace []string
+	var seen []Invocation
+	record := func(name string) Middleware {
+		return func(next Invoker) Invoker {
+			return func(inv *Invocation) (interface{}, error) {
+				trace = append(trace, name+">")
+				res, err := next(inv)
+				trace = append(trace, "<"+name)
+				seen = append(seen, *inv)
+				return res, err
+			}
 		}
-		got, err = rh.JSONGet("testObj#3", ".")
-		if err != nil || !reflect.DeepEqual(got, res) {
-			t.Errorf("JSONGet() got = %v %v, want: %v", got, err, res)
+	}
+	rh.Use(record("outer"), record("inner"))
+
+	res, err := rh.JSONSet("key", ".", 1, rjs.SetOptionNX)
+	if err != nil || res != "OK" {
+		t.Fatalf("JSONSet() = %v %v, want OK", res, err)
+	}
+	if want := []string{"outer>", "inner>", "<inner", "<outer"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("middleware order = %v, want %v", trace, want)
+	}
+	inv := seen[1]
+	if inv.Command != rjs.ReJSONCommandSET || inv.Key != "key" || inv.Path != "." || inv.Client != rjs.ClientRedigo ||
+		!reflect.DeepEqual(inv.Args, []interface{}{1, rjs.SetOptionNX}) || inv.Result != "OK" || inv.Err != nil ||
+		inv.Context == nil || inv.Duration <= 0 {
+		t.Errorf("Invocation = %+v", inv)
+	}
+
+	seen = nil
+	conn.reply = []interface{}{[]byte("1"), nil}
+	if _, err = rh.JSONMGet(".", "a", "b"); err != nil {
+		t.Fatalf("JSONMGet() error = %v", err)
+	}
+	if inv := seen[0]; inv.Command != rjs.ReJSONCommandMGET || !reflect.DeepEqual(inv.Keys, []string{"a", "b"}) {
+		t.Errorf("Invocation = %+v", inv)
+	}
+
+	t.Run("RewriteKey", func(t *testing.T) {
+		rh := NewReJSONHandler()
+		conn := &fakeConn{reply: []byte("1")}
+		rh.SetRedigoClient(conn)
+		rh.Use(func(next Invoker) Invoker {
+			return func(inv *Invocation) (interface{}, error) {
+				inv.Key = "tenant:" + inv.Key
+				return next(inv)
+			}
+		})
+		if _, err := rh.JSONGet("key", "."); err != nil {
+			t.Fatalf("JSONGet() error = %v", err)
 		}
-		got, err = rh.SetContext(ctx).JSONGet("testObj#3", ".")
-		if err != nil || !reflect.DeepEqual(got, res) {
-			t.Errorf("JSONGet() got = %v %v, want: %v", got, err, res)
+		if conn.commands[0][1] != "tenant:key" {
+			t.Errorf("JSONGet() sent %v, want key tenant:key", conn.commands[0])
 		}
+	})
 
-		obj.closeFunc()
+	t.Run("ShortCircuit", func(t *testing.T) {
+		rh := NewReJSONHandler()
+		conn := &fakeConn{reply: "OK"}
+		rh.SetRedigoClient(conn)
+		denied := errors.New("denied")
+		rh.Use(func(next Invoker) Invoker {
+			return func(inv *Invocation) (interface{}, error) {
+				return nil, denied
+			}
+		})
+		if _, err := rh.JSONDel("key", "."); err != denied || len(conn.commands) != 0 {
+			t.Errorf("JSONDel() error = %v, sent %v, want denied and no command", err, conn.commands)
+		}
+	})
+
+	t.Run("SetContextSharesChain", func(t *testing.T) {
+		rh := NewReJSONHandler()
+		rh.SetGoRedisClient(goredis.NewClient(&goredis.Options{Addr: "localhost:0"}))
+		calls := 0
+		rh.Use(func(next Invoker) Invoker {
+			return func(inv *Invocation) (interface{}, error) {
+				calls++
+				if inv.Context.Value(ctxKey{}) != "value" {
+					t.Errorf("Invocation.Context = %v, want the handler's context", inv.Context)
+				}
+				return nil, nil
+			}
+		})
+		ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+		_, _ = rh.SetContext(ctx).JSONType("key", ".")
+		if calls != 1 {
+			t.Errorf("middleware called %d times, want 1", calls)
+		}
+	})
+}
+
+type ctxKey struct{}
+
+func TestRetryPolicy(t *testing.T) {
+	eof := io.EOF
+	loading := redigo.Error("LOADING Redis is loading the dataset in memory")
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		call     func(rh *Handler) (interface{}, error)
+		failures []error
+		attempts int
+		wantErr  error
+	}{
+		{
+			name:     "Get",
+			policy:   RetryPolicy{MaxAttempts: 3},
+			call:     func(rh *Handler) (interface{}, error) { return rh.JSONGet("key", ".") },
+			failures: []error{eof, loading},
+			attempts: 3,
+		},
+		{
+			name:     "MaxAttempts",
+			policy:   RetryPolicy{MaxAttempts: 2},
+			call:     func(rh *Handler) (interface{}, error) { return rh.JSONType("key", ".") },
+			failures: []error{eof, eof, eof},
+			attempts: 2,
+			wantErr:  eof,
+		},
+		{
+			name:     "NotRetryable",
+			policy:   RetryPolicy{MaxAttempts: 3},
+			call:     func(rh *Handler) (interface{}, error) { return rh.JSONGet("key", ".") },
+			failures: []error{redigo.Error("WRONGTYPE Operation against a key holding the wrong kind of value")},
+			attempts: 1,
+			wantErr:  redigo.Error("WRONGTYPE Operation against a key holding the wrong kind of value"),
+		},
+		{
+			name:     "SetXX",
+			policy:   RetryPolicy{MaxAttempts: 3},
+			call:     func(rh *Handler) (interface{}, error) { return rh.JSONSet("key", ".", 1, rjs.SetOptionXX) },
+			failures: []error{eof},
+			attempts: 2,
+		},
+		{
+			name:     "SetNX",
+			policy:   RetryPolicy{MaxAttempts: 3},
+			call:     func(rh *Handler) (interface{}, error) { return rh.JSONSet("key", ".", 1, rjs.SetOptionNX) },
+			failures: []error{eof},
+			attempts: 1,
+			wantErr:  eof,
+		},
+		{
+			name:     "NumIncrBy",
+			policy:   RetryPolicy{MaxAttempts: 3},
+			call:     func(rh *Handler) (interface{}, error) { return rh.JSONNumIncrBy("key", ".", 1) },
+			failures: []error{eof},
+			attempts: 1,
+			wantErr:  eof,
+		},
+		{
+			name:     "NumIncrByAllowed",
+			policy:   RetryPolicy{MaxAttempts: 3, AllowNonIdempotent: []rjs.ReJSONCommandID{rjs.ReJSONCommandNUMINCRBY}},
+			call:     func(rh *Handler) (interface{}, error) { return rh.JSONNumIncrBy("key", ".", 1) },
+			failures: []error{eof},
+			attempts: 2,
+		},
+		{
+			name:     "ArrAppend",
+			policy:   RetryPolicy{MaxAttempts: 3},
+			call:     func(rh *Handler) (interface{}, error) { return rh.JSONArrAppend("key", ".", 1) },
+			failures: []error{loading},
+			attempts: 1,
+			wantErr:  loading,
+		},
+		{
+			name:     "StrAppend",
+			policy:   RetryPolicy{MaxAttempts: 3},
+			call:     func(rh *Handler) (interface{}, error) { return rh.JSONStrAppend("key", ".", `"a"`) },
+			failures: []error{eof},
+			attempts: 1,
+			wantErr:  eof,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rh := NewReJSONHandler()
+			conn := &fakeConn{reply: "OK", failures: tt.failures}
+			rh.SetRedigoClient(conn)
+			tt.policy.MinBackoff = time.Microsecond
+			rh.SetRetryPolicy(tt.policy)
+			var attempts int
+			rh.Use(func(next Invoker) Invoker {
+				return func(inv *Invocation) (interface{}, error) {
+					res, err := next(inv)
+					attempts = inv.Attempts
+					return res, err
+				}
+			})
+
+			if _, err := tt.call(rh); err != tt.wantErr {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if len(conn.commands) != tt.attempts || attempts != tt.attempts {
+				t.Errorf("sent %d commands, Attempts = %d, want %d", len(conn.commands), attempts, tt.attempts)
+			}
+		})
 	}
+
+	t.Run("ContextDone", func(t *testing.T) {
+		rh := NewReJSONHandler()
+		conn := &fakeConn{reply: "OK", failures: []error{eof, eof}}
+		rh.SetRedigoClient(conn)
+		rh.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Hour, MaxBackoff: time.Hour})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		rh.Use(func(next Invoker) Invoker {
+			return func(inv *Invocation) (interface{}, error) {
+				inv.Context = ctx
+				return next(inv)
+			}
+		})
+		if _, err := rh.JSONGet("key", "."); err != eof || len(conn.commands) != 1 {
+			t.Errorf("error = %v after %d attempts, want EOF after 1", err, len(conn.commands))
+		}
+	})
 }
 
-type TestObject struct {
-	Name   string `json:"name"`
-	Number int    `json:"number"`
+func TestCircuitBreaker(t *testing.T) {
+	eof := io.EOF
+	rh := NewReJSONHandler()
+	conn := &fakeConn{reply: []byte("1")}
+	rh.SetRedigoClient(conn)
+	var transitions []string
+	rh.SetCircuitBreaker(BreakerOptions{
+		MinRequests:      4,
+		OpenTimeout:      time.Minute,
+		HalfOpenRequests: 2,
+		OnStateChange: func(from, to BreakerState) {
+			transitions = append(transitions, from.String()+">"+to.String())
+		},
+	})
+	now := time.Now()
+	rh.breaker.now = func() time.Time { return now }
+
+	get := func() error {
+		_, err := rh.JSONGet("key", ".")
+		return err
+	}
+	conn.failures = []error{eof, redigo.Error("WRONGTYPE Operation against a key holding the wrong kind of value"), eof}
+	for i := 0; i < 4; i++ {
+		_ = get()
+	}
+	if state := rh.CircuitBreakerState(); state != BreakerOpen {
+		t.Fatalf("state = %v after 2 failures out of 4, want open", state)
+	}
+	sent := len(conn.commands)
+	if err := get(); err != rjs.ErrCircuitOpen || len(conn.commands) != sent {
+		t.Errorf("JSONGet() error = %v while open, want ErrCircuitOpen and no command", err)
+	}
+
+	now = now.Add(time.Minute)
+	if state := rh.CircuitBreakerState(); state != BreakerHalfOpen {
+		t.Fatalf("state = %v after OpenTimeout, want half-open", state)
+	}
+	if err := get(); err != nil {
+		t.Errorf("JSONGet() probe error = %v", err)
+	}
+	if state := rh.CircuitBreakerState(); state != BreakerHalfOpen {
+		t.Errorf("state = %v after 1 of 2 probes, want half-open", state)
+	}
+	if err := get(); err != nil {
+		t.Errorf("JSONGet() probe error = %v", err)
+	}
+	if state := rh.CircuitBreakerState(); state != BreakerClosed {
+		t.Errorf("state = %v after 2 probes, want closed", state)
+	}
+
+	// a failed probe opens the breaker again
+	now = now.Add(time.Second)
+	conn.failures = []error{eof, eof, eof, eof}
+	for i := 0; i < 4; i++ {
+		_ = get()
+	}
+	now = now.Add(time.Minute)
+	conn.failures = []error{eof}
+	if err := get(); err != eof {
+		t.Errorf("JSONGet() probe error = %v, want EOF", err)
+	}
+	want := []string{"closed>open", "open>half-open", "half-open>closed", "closed>open", "open>half-open",
+		"half-open>open"}
+	if !reflect.DeepEqual(transitions, want) {
+		t.Errorf("transitions = %v, want %v", transitions, want)
+	}
+
+	t.Run("SlowCalls", func(t *testing.T) {
+		rh := NewReJSONHandler()
+		rh.SetRedigoClient(&fakeConn{reply: []byte("1")})
+		rh.SetCircuitBreaker(BreakerOptions{MinRequests: 2, SlowCallDuration: time.Nanosecond})
+		for i := 0; i < 2; i++ {
+			if _, err := rh.JSONGet("key", "."); err != nil {
+				t.Fatalf("JSONGet() error = %v", err)
+			}
+		}
+		if _, err := rh.JSONGet("key", "."); err != rjs.ErrCircuitOpen {
+			t.Errorf("JSONGet() error = %v after slow calls, want ErrCircuitOpen", err)
+		}
+	})
+}
+
+// countingConn is a RedigoClientConn safe for concurrent use, counting commands
+type countingConn struct {
+	commands int64
+}
+
+func (c *countingConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	atomic.AddInt64(&c.commands, 1)
+	return []byte("1"), nil
+}
+
+func TestSwapClientsUnderLoad(t *testing.T) {
+	rh := NewReJSONHandler()
+	primary, replica := &countingConn{}, &countingConn{}
+	rh.SetRedigoClient(primary)
+
+	const workers, calls = 8, 500
+	var sent, inactive int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < calls; i++ {
+				var err error
+				if i%2 == 0 {
+					_, err = rh.JSONGet("key", ".")
+				} else {
+					_, err = rh.JSONSet("key", ".", i)
+				}
+				switch err {
+				case nil:
+					atomic.AddInt64(&sent, 1)
+				case rjs.ErrNoClientSet:
+					atomic.AddInt64(&inactive, 1)
+				default:
+					t.Errorf("unexpected error %v", err)
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			switch i % 3 {
+			case 0:
+				rh.SetRedigoClient(replica)
+			case 1:
+				rh.SetClientInactive()
+			default:
+				rh.SetRedigoClient(primary)
+			}
+			_ = rh.SetContext(context.Background())
+		}
+		rh.SetRedigoClient(primary)
+	}()
+	wg.Wait()
+	<-done
+
+	if got := atomic.LoadInt64(&primary.commands) + atomic.LoadInt64(&replica.commands); got != sent {
+		t.Errorf("clients received %d commands, want %d", got, sent)
+	}
+	if sent+inactive != workers*calls {
+		t.Errorf("%d commands completed, want %d", sent+inactive, workers*calls)
+	}
+}
+
+// upperCodec is a Codec upper-casing the json it encodes
+type upperCodec struct{}
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	return []byte(strings.ToUpper(string(b))), err
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal([]byte(strings.ToLower(string(data))), v)
+}
+
+func TestNew(t *testing.T) {
+	conn := &fakeConn{}
+	middleware := func(next Invoker) Invoker { return next }
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr error
+	}{
+		{"NoClient", []Option{WithKeyPrefix("p:")}, rjs.ErrNoClientSet},
+		{"TwoClients", []Option{WithRedigoClient(conn), WithRedigoClient(conn)}, rjs.ErrMultipleClients},
+		{"NilClient", []Option{WithRedigoClient(nil)}, rjs.ErrInvalidOption},
+		{"NilContext", []Option{WithRedigoClient(conn), WithContext(nil)}, rjs.ErrInvalidOption}, // nolint: staticcheck
+		{"NilCodec", []Option{WithRedigoClient(conn), WithCodec(nil)}, rjs.ErrInvalidOption},
+		{"NilMiddleware", []Option{WithRedigoClient(conn), WithMiddleware(middleware, nil)}, rjs.ErrInvalidOption},
+		{"NegativeRetry", []Option{WithRedigoClient(conn), WithRetryPolicy(RetryPolicy{MaxAttempts: -1})},
+			rjs.ErrInvalidOption},
+		{"RetryBackoff", []Option{WithRedigoClient(conn),
+			WithRetryPolicy(RetryPolicy{MinBackoff: time.Second, MaxBackoff: time.Millisecond})}, rjs.ErrInvalidOption},
+		{"TooManyGetOptions", []Option{WithRedigoClient(conn), WithGetOptions(rjs.GETOptionINDENT,
+			rjs.GETOptionNEWLINE, rjs.GETOptionSPACE, rjs.GETOptionNOESCAPE, rjs.GETOptionINDENT)}, rjs.ErrTooManyOptionals},
+		{"DuplicateGetOptions", []Option{WithRedigoClient(conn),
+			WithGetOptions(rjs.GETOptionINDENT, rjs.GETOptionINDENT)}, rjs.ErrInvalidOption},
+		{"Redigo", []Option{WithRedigoClient(conn), WithMiddleware(middleware)}, nil},
+		{"GoRedis", []Option{WithGoRedisClient(goredis.NewClient(&goredis.Options{}))}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rh, err := New(tt.opts...)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (rh != nil) {
+				t.Errorf("New() = %v, %v, want error %v", rh, err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("Options", func(t *testing.T) {
+		conn := &fakeConn{reply: "OK", failures: []error{io.EOF}}
+		ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+		var seen []Invocation
+		rh, err := New(
+			WithRedigoClient(conn),
+			WithContext(ctx),
+			WithCodec(upperCodec{}),
+			WithMiddleware(func(next Invoker) Invoker {
+				return func(inv *Invocation) (interface{}, error) {
+					res, err := next(inv)
+					seen = append(seen, *inv)
+					return res, err
+				}
+			}),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 2, MinBackoff: time.Microsecond}),
+			WithGetOptions(rjs.GETOptionNOESCAPE),
+			WithKeyPrefix("tenant42:"),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if _, err = rh.JSONSet("doc", ".", map[string]string{"a": "b"}); err != nil {
+			t.Fatalf("JSONSet() error = %v", err)
+		}
+		want := []interface{}{"JSON.SET", "tenant42:doc", ".", []byte(`{"A":"B"}`)}
+		if !reflect.DeepEqual(conn.commands[1], want) {
+			t.Errorf("JSONSet() sent %v, want %v", conn.commands[1], want)
+		}
+		if inv := seen[0]; inv.Attempts != 2 || inv.Context != ctx || inv.Key != "tenant42:doc" {
+			t.Errorf("Invocation = %+v", inv)
+		}
+
+		conn.reply = []byte(`{"A":"B"}`)
+		var doc map[string]string
+		if err = rh.JSONGetInto("doc", ".", &doc); err != nil || doc["a"] != "b" {
+			t.Fatalf("JSONGetInto() = %v, %v", doc, err)
+		}
+		want = []interface{}{"JSON.GET", "tenant42:doc", "NOESCAPE", "."}
+		if !reflect.DeepEqual(conn.commands[2], want) {
+			t.Errorf("JSONGet() sent %v, want %v", conn.commands[2], want)
+		}
+
+		if _, err = rh.JSONMGet(".", "a", "b"); err != nil {
+			t.Fatalf("JSONMGet() error = %v", err)
+		}
+		want = []interface{}{"JSON.MGET", "tenant42:a", "tenant42:b", "."}
+		if !reflect.DeepEqual(conn.commands[3], want) {
+			t.Errorf("JSONMGet() sent %v, want %v", conn.commands[3], want)
+		}
+	})
+}
+
+func TestWithPrefix(t *testing.T) {
+	conn := &fakeConn{reply: "OK"}
+	rh := NewReJSONHandler()
+	rh.SetRedigoClient(conn)
+	tenant := rh.WithPrefix("tenant42:")
+	users := tenant.WithPrefix("users:")
+
+	if _, err := users.JSONSet("1", ".", 1); err != nil {
+		t.Fatalf("JSONSet() error = %v", err)
+	}
+	if _, err := tenant.JSONMGet(".", "a", "b"); err != nil {
+		t.Fatalf("JSONMGet() error = %v", err)
+	}
+	if _, err := rh.JSONDel("a", "."); err != nil {
+		t.Fatalf("JSONDel() error = %v", err)
+	}
+	want := [][]interface{}{
+		{"JSON.SET", "tenant42:users:1", ".", []byte("1")},
+		{"JSON.MGET", "tenant42:a", "tenant42:b", "."},
+		{"JSON.DEL", "a", "."},
+	}
+	if !reflect.DeepEqual(conn.commands, want) {
+		t.Errorf("sent %v, want %v", conn.commands, want)
+	}
+	if users.Prefix() != "tenant42:users:" {
+		t.Errorf("Prefix() = %q, want tenant42:users:", users.Prefix())
+	}
+
+	t.Run("SwappedClient", func(t *testing.T) {
+		replica := &fakeConn{reply: "OK"}
+		rh.SetRedigoClient(replica)
+		if err := rh.EnableVersioning(""); err != nil {
+			t.Fatalf("EnableVersioning() error = %v", err)
+		}
+		defer rh.DisableVersioning()
+		versioned := rh.IfVersion(1)
+		rh.SetClientInactive()
+		rh.SetRedigoClient(replica)
+
+		if _, err := users.JSONSet("2", ".", 2); err != nil {
+			t.Fatalf("JSONSet() error = %v", err)
+		}
+		replica.reply = []interface{}{int64(1), "OK", int64(2)}
+		if _, err := versioned.JSONSet("doc", ".a", 1); err != nil {
+			t.Fatalf("JSONSet() error = %v", err)
+		}
+		if len(replica.commands) != 2 || replica.commands[0][1] != "tenant42:users:2" || len(conn.commands) != 3 {
+			t.Errorf("sent %v to the new client, %v to the previous one, want the writes on the new one",
+				replica.commands, conn.commands)
+		}
+	})
+
+	t.Run("ScanJSON", func(t *testing.T) {
+		conn := &fakeConn{reply: []interface{}{[]byte("0"), []interface{}{[]byte("t*1:a"), []byte("t*1:b")}}}
+		rh := NewReJSONHandler()
+		rh.SetRedigoClient(conn)
+		it := rh.WithPrefix("t*1:").ScanJSON("*", ScanOptions{})
+		var keys []string
+		for it.Next() {
+			keys = append(keys, it.Key())
+		}
+		if it.Err() != nil || !reflect.DeepEqual(keys, []string{"a", "b"}) {
+			t.Errorf("ScanJSON() = %v %v, want [a b]", keys, it.Err())
+		}
+		if match := conn.commands[0][3]; match != `t\*1:*` {
+			t.Errorf("SCAN MATCH %v, want the escaped prefix", match)
+		}
+	})
+}
+
+func TestEvalNoScript(t *testing.T) {
+	conn := &fakeConn{reply: "OK", failures: []error{redigo.Error("NOSCRIPT No matching script.")}}
+	rh, seen := recordingHandler(conn)
+
+	res, err := rh.JSONSetWithTTL("key", ".", 1, rjs.TTLOptionEX(time.Minute), rjs.SetOptionNX)
+	if err != nil || res != "OK" {
+		t.Fatalf("JSONSetWithTTL() = %v %v, want OK", res, err)
+	}
+	script := rjs.ScriptSetWithTTL
+	want := [][]interface{}{
+		{"EVALSHA", script.Hash(), 1, "key", ".", []byte("1"), "EX", int64(60), "NX"},
+		{"EVAL", script.Source(), 1, "key", ".", []byte("1"), "EX", int64(60), "NX"},
+	}
+	if !reflect.DeepEqual(conn.commands, want) {
+		t.Errorf("sent %v, want %v", conn.commands, want)
+	}
+	if inv := seen.last(); inv.Command != rjs.ReJSONCommandSET || inv.Script != "JSON.SET+TTL" || inv.Idempotent() {
+		t.Errorf("Invocation = %+v, want a non idempotent JSON.SET+TTL", inv)
+	}
+}
+
+// scriptConn is a RedigoClientConn replying to SCRIPT LOAD with the digest of
+// the script
+type scriptConn struct {
+	loaded []string
+}
+
+func (c *scriptConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	source := args[1].(string)
+	c.loaded = append(c.loaded, source)
+	return rjs.NewScript("", source).Hash(), nil
+}
+
+func TestLoadScripts(t *testing.T) {
+	conn := &scriptConn{}
+	rh := NewReJSONHandler()
+	rh.SetRedigoClient(conn)
+	if err := rh.LoadScripts(); err != nil {
+		t.Fatalf("LoadScripts() error = %v", err)
+	}
+	var want []string
+	for _, script := range rjs.BundledScripts() {
+		want = append(want, script.Source())
+	}
+	if len(want) == 0 || !reflect.DeepEqual(conn.loaded, want) {
+		t.Errorf("LoadScripts() loaded %d scripts, want %d", len(conn.loaded), len(want))
+	}
+
+	rh.SetRedigoClient(&fakeConn{reply: "0123"})
+	if err := rh.LoadScripts(); err == nil {
+		t.Errorf("LoadScripts() error = nil, want an error for a wrong digest")
+	}
+}
+
+func TestJSONSetIf(t *testing.T) {
+	conn := &fakeConn{reply: int64(1)}
+	rh, seen := recordingHandler(conn)
+
+	swapped, err := rh.JSONSetIf("order:1", "$.status", "packed", "shipped")
+	if err != nil || !swapped {
+		t.Fatalf("JSONSetIf() = %v %v, want true", swapped, err)
+	}
+	want := []interface{}{"EVALSHA", rjs.ScriptSetIf.Hash(), 1, "order:1", "$.status", []byte(`"packed"`),
+		[]byte(`"shipped"`)}
+	if !reflect.DeepEqual(conn.commands[0], want) {
+		t.Errorf("sent %v, want %v", conn.commands[0], want)
+	}
+	if inv := seen.last(); inv.Idempotent() || inv.PayloadSize() != len(`"shipped"`) {
+		t.Errorf("Invocation = %+v, want a non idempotent JSON.SET of the new value", inv)
+	}
+
+	conn.reply = int64(0)
+	if swapped, err = rh.JSONSetIf("order:1", "$.status", "packed", "shipped"); err != nil || swapped {
+		t.Errorf("JSONSetIf() = %v %v, want false", swapped, err)
+	}
+}
+
+func TestJSONArrCapped(t *testing.T) {
+	conn := &fakeConn{reply: int64(3)}
+	rh, seen := recordingHandler(conn)
+
+	if res, err := rh.JSONArrAppendCapped("log", ".events", 3, "a", "b"); err != nil || res != int64(3) {
+		t.Fatalf("JSONArrAppendCapped() = %v %v, want 3", res, err)
+	}
+	if _, err := rh.JSONArrPrependCapped("log", ".events", 3, "c"); err != nil {
+		t.Fatalf("JSONArrPrependCapped() error = %v", err)
+	}
+	want := [][]interface{}{
+		{"EVALSHA", rjs.ScriptArrAppendCapped.Hash(), 1, "log", ".events", 3, []byte(`"a"`), []byte(`"b"`)},
+		{"EVALSHA", rjs.ScriptArrPrependCapped.Hash(), 1, "log", ".events", 3, []byte(`"c"`)},
+	}
+	if !reflect.DeepEqual(conn.commands, want) {
+		t.Errorf("sent %v, want %v", conn.commands, want)
+	}
+	if inv := seen.at(0); inv.Command != rjs.ReJSONCommandARRAPPEND || inv.PayloadSize() != 6 {
+		t.Errorf("Invocation = %+v, want a JSON.ARRAPPEND of 6 bytes", inv)
+	}
+	if inv := seen.at(1); inv.Command != rjs.ReJSONCommandARRINSERT || inv.PayloadSize() != 3 || inv.Idempotent() {
+		t.Errorf("Invocation = %+v, want a non idempotent JSON.ARRINSERT of 3 bytes", inv)
+	}
+
+	if _, err := rh.JSONArrAppendCapped("log", ".events", 0, "a"); err != rjs.ErrInvalidMaxLen {
+		t.Errorf("JSONArrAppendCapped() error = %v, want %v", err, rjs.ErrInvalidMaxLen)
+	}
+	if _, err := rh.JSONArrPrependCapped("log", ".events", 3); err != rjs.ErrNeedAtLeastOneArg {
+		t.Errorf("JSONArrPrependCapped() error = %v, want %v", err, rjs.ErrNeedAtLeastOneArg)
+	}
 }
 
-func testJSONSet(rh *Handler, t *testing.T) {
+func TestLock(t *testing.T) {
+	conn := &fakeConn{reply: []interface{}{int64(1), []byte("7"), int64(1700000030000)}}
+	rh, seen := recordingHandler(conn)
+
+	lock := rh.NewLock("job:1", LockOptions{Owner: "worker-1", TTL: 10 * time.Second})
+	if err := lock.Acquire(); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if lock.Token() != 7 || !lock.Expires().Equal(time.Unix(1700000030, 0)) {
+		t.Errorf("Token() = %d, Expires() = %v, want 7 at 1700000030", lock.Token(), lock.Expires())
+	}
+	want := []interface{}{"EVALSHA", rjs.ScriptLock.Hash(), 1, "job:1", DefaultLockPath, "worker-1", int64(10000)}
+	if !reflect.DeepEqual(conn.commands[0], want) {
+		t.Errorf("sent %v, want %v", conn.commands[0], want)
+	}
+
+	conn.reply = int64(1700000040000)
+	if err := lock.Renew(); err != nil || !lock.Expires().Equal(time.Unix(1700000040, 0)) {
+		t.Errorf("Renew() error = %v, Expires() = %v", err, lock.Expires())
+	}
+	conn.reply = int64(0)
+	if err := lock.Renew(); err != rjs.ErrLockNotHeld || !lock.Expires().IsZero() {
+		t.Errorf("Renew() error = %v, want %v", err, rjs.ErrLockNotHeld)
+	}
+	if err := lock.Release(); err != rjs.ErrLockNotHeld {
+		t.Errorf("Release() error = %v, want %v", err, rjs.ErrLockNotHeld)
+	}
+	want = []interface{}{"EVALSHA", rjs.ScriptUnlock.Hash(), 1, "job:1", DefaultLockPath, "worker-1", int64(7)}
+	if !reflect.DeepEqual(conn.commands[3], want) {
+		t.Errorf("sent %v, want %v", conn.commands[3], want)
+	}
+	if seen.at(0).Idempotent() || !seen.at(1).Idempotent() || seen.at(3).Idempotent() {
+		t.Errorf("only Renew should be idempotent: %+v", *seen)
+	}
+
+	conn.reply = []interface{}{int64(0), []byte("worker-2"), int64(1700000030000)}
+	if err := rh.NewLock("job:1", LockOptions{}).Acquire(); !errors.Is(err, rjs.ErrLockHeld) ||
+		!strings.Contains(err.Error(), "worker-2") {
+		t.Errorf("Acquire() error = %v, want %v by worker-2", err, rjs.ErrLockHeld)
+	}
+
+	sent := len(conn.commands)
+	if err := rh.NewLock("job:1", LockOptions{Path: "$.lock"}).Acquire(); !errors.Is(err, rjs.ErrInvalidPath) ||
+		len(conn.commands) != sent {
+		t.Errorf("Acquire() error = %v, want %v without sending the script", err, rjs.ErrInvalidPath)
+	}
+}
+
+func TestScanJSONMiddleware(t *testing.T) {
+	conn := &fakeConn{reply: []interface{}{[]byte("0"), []interface{}{[]byte("tenant42:a")}}, failures: []error{io.EOF}}
+	rh, seen := recordingHandler(conn)
+	rh.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, MinBackoff: time.Microsecond})
+
+	it := rh.WithPrefix("tenant42:").ScanJSON("*", ScanOptions{Count: 10})
+	if !it.Next() || it.Key() != "a" || it.Next() || it.Err() != nil {
+		t.Fatalf("ScanJSON() = %q %v, want the key a", it.Key(), it.Err())
+	}
+	want := []interface{}{"SCAN", uint64(0), "MATCH", "tenant42:*", "COUNT", int64(10), "TYPE", rjs.ReJSONKeyType}
+	if len(conn.commands) != 2 || !reflect.DeepEqual(conn.commands[1], want) {
+		t.Errorf("sent %v, want %v retried once", conn.commands, want)
+	}
+	if inv := seen.last(); len(*seen) != 1 || inv.Command != rjs.ReJSONCommandSCAN || inv.Attempts != 2 {
+		t.Errorf("Invocations = %+v, want a SCAN sent twice", *seen)
+	}
+}
+
+// schemaFunc validates documents with a function
+type schemaFunc func(doc interface{}) ([]SchemaViolation, error)
+
+func (f schemaFunc) Validate(doc interface{}) ([]SchemaViolation, error) {
+	return f(doc)
+}
+
+// positiveQuantities requires the quantities of the items of an order to be positive
+var positiveQuantities = schemaFunc(func(doc interface{}) (violations []SchemaViolation, err error) {
+	order, _ := doc.(map[string]interface{})
+	items, _ := order["items"].([]interface{})
+	for i, item := range items {
+		qty, _ := item.(map[string]interface{})["qty"].(json.Number)
+		if n, _ := qty.Int64(); n <= 0 {
+			violations = append(violations, SchemaViolation{
+				Path: fmt.Sprintf("/items/%d/qty", i), Keyword: "/properties/items/items/properties/qty/minimum",
+				Message: "must be positive",
+			})
+		}
+	}
+	return violations, nil
+})
+
+func TestRegisterSchema(t *testing.T) {
+	conn := &fakeConn{reply: []byte(`{"items":[{"qty":1},{"qty":2}]}`)}
+	rh, err := New(WithRedigoClient(conn), WithSchema("order:*", positiveQuantities))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tenant := rh.WithPrefix("t:")
+	tenant.RegisterSchema("order:*", positiveQuantities)
+
+	tests := []struct {
+		name       string
+		write      func() (interface{}, error)
+		violations []string
+		commands   []string
+	}{
+		{"ValidSet", func() (interface{}, error) {
+			return rh.JSONSet("order:1", "$.items[0].qty", 3)
+		}, nil, []string{"JSON.GET", "JSON.SET"}},
+		{"InvalidSet", func() (interface{}, error) {
+			return rh.JSONSet("order:1", "items[-1]", map[string]int{"qty": 0})
+		}, []string{"/items/1/qty"}, []string{"JSON.GET"}},
+		{"InvalidWildcardSet", func() (interface{}, error) {
+			return rh.JSONSet("order:1", "$.items[*].qty", -1)
+		}, []string{"/items/0/qty", "/items/1/qty"}, []string{"JSON.GET"}},
+		{"InvalidRootSet", func() (interface{}, error) {
+			return rh.JSONSet("order:2", ".", rjs.RawJSON(`{"items":[{"qty":-5}]}`))
+		}, []string{"/items/0/qty"}, nil},
+		{"InvalidArrAppend", func() (interface{}, error) {
+			return rh.JSONArrAppend("order:1", ".items", map[string]int{"qty": 1}, map[string]int{"qty": 0})
+		}, []string{"/items/3/qty"}, []string{"JSON.GET"}},
+		{"InvalidArrInsert", func() (interface{}, error) {
+			return rh.JSONArrInsert("order:1", `["items"]`, 0, map[string]int{})
+		}, []string{"/items/0/qty"}, []string{"JSON.GET"}},
+		{"CappedArrAppend", func() (interface{}, error) {
+			return rh.JSONArrAppendCapped("order:1", ".items", 1, map[string]int{"qty": 0}, map[string]int{"qty": 1})
+		}, nil, []string{"JSON.GET", "EVALSHA"}},
+		{"CappedArrAppendInvalidMaxLen", func() (interface{}, error) {
+			_, err := rh.JSONArrAppendCapped("order:1", ".items", -1, map[string]int{"qty": 1})
+			if !errors.Is(err, rjs.ErrInvalidMaxLen) {
+				return nil, fmt.Errorf("error = %v, want %v", err, rjs.ErrInvalidMaxLen)
+			}
+			_, err = rh.JSONArrPrependCapped("order:1", ".items", 2)
+			if !errors.Is(err, rjs.ErrNeedAtLeastOneArg) {
+				return nil, fmt.Errorf("error = %v, want %v", err, rjs.ErrNeedAtLeastOneArg)
+			}
+			return nil, nil
+		}, nil, nil},
+		{"PrefixedKey", func() (interface{}, error) {
+			return tenant.JSONArrPrependCapped("order:1", ".items", 2, map[string]int{"qty": 0})
+		}, []string{"/items/0/qty"}, []string{"JSON.GET"}},
+		{"OtherKey", func() (interface{}, error) {
+			return rh.JSONSet("customer:1", ".", map[string]int{"qty": 0})
+		}, nil, []string{"JSON.SET"}},
+		{"NotValidated", func() (interface{}, error) {
+			return rh.JSONNumIncrBy("order:1", ".items[0].qty", -5)
+		}, nil, []string{"JSON.NUMINCRBY"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn.commands = nil
+			_, err := tt.write()
+			var verr *ValidationError
+			if tt.violations == nil {
+				if err != nil {
+					t.Errorf("write error = %v", err)
+				}
+			} else if !errors.As(err, &verr) || !errors.Is(err, rjs.ErrSchemaValidation) {
+				t.Errorf("write error = %v, want a *ValidationError", err)
+			} else {
+				var paths []string
+				for _, v := range verr.Violations {
+					paths = append(paths, v.Path)
+				}
+				if !reflect.DeepEqual(paths, tt.violations) {
+					t.Errorf("violations at %v, want %v", paths, tt.violations)
+				}
+			}
+			var commands []string
+			for _, cmd := range conn.commands {
+				commands = append(commands, cmd[0].(string))
+			}
+			if !reflect.DeepEqual(commands, tt.commands) {
+				t.Errorf("sent %v, want %v", commands, tt.commands)
+			}
+		})
+	}
+
+	if _, err := rh.JSONSet("order:1", "$..qty", 1); err == nil || errors.Is(err, rjs.ErrSchemaValidation) {
+		t.Errorf("JSONSet() with recursive descent error = %v, want an unsupported path", err)
+	}
+
+	var seen []rjs.ReJSONCommandID
+	rh.Use(func(next Invoker) Invoker {
+		return func(inv *Invocation) (interface{}, error) {
+			seen = append(seen, inv.Command)
+			return next(inv)
+		}
+	})
+	if _, err := rh.JSONSet("order:1", "$.items[0].qty", 3); err != nil {
+		t.Errorf("JSONSet() error = %v", err)
+	}
+	if want := []rjs.ReJSONCommandID{rjs.ReJSONCommandSET, rjs.ReJSONCommandGET}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("middleware saw %v, want the read of the document as well %v", seen, want)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []pathSegment
+	}{
+		{".", nil},
+		{"$", nil},
+		{"", nil},
+		{"a.b", []pathSegment{{member: "a"}, {member: "b"}}},
+		{".a[0]", []pathSegment{{member: "a"}, {index: 0, isIndex: true}}},
+		{`$['a.b']["c\"d"][-1]`, []pathSegment{{member: "a.b"}, {member: `c"d`}, {index: -1, isIndex: true}}},
+		{"$.*[*].c", []pathSegment{{wildcard: true}, {wildcard: true}, {member: "c"}}},
+		{"$..a", nil},
+		{"$.a[0:2]", nil},
+		{"$.a[?(@.b)]", nil},
+	}
+	for _, tt := range tests {
+		got, err := parsePath(tt.path)
+		if tt.want == nil && strings.Trim(tt.path, ".$") != "" {
+			if err == nil {
+				t.Errorf("parsePath(%q) = %v, want an error", tt.path, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePath(%q) = %v %v, want %v", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"order:*", "order:1", true},
+		{"order:*", "orders:1", false},
+		{"*:order:?", "t:order:1", true},
+		{"order:[0-9]", "order:a", false},
+		{"order:[^a]*", "order:b/c", true},
+		{`t\*:*`, "t*:1", true},
+		{`t\*:*`, "tx:1", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestVersioning(t *testing.T) {
+	conn := &fakeConn{reply: []interface{}{int64(1), "OK", int64(4)}}
+	rh, seen := recordingHandler(conn)
+
+	if _, err := rh.IfVersion(1).JSONSet("doc", ".name", "x"); !errors.Is(err, rjs.ErrVersioning) {
+		t.Errorf("JSONSet() without versioning error = %v, want %v", err, rjs.ErrVersioning)
+	}
+	if inv := seen.last(); !errors.Is(inv.Err, rjs.ErrVersioning) || inv.Attempts != 0 || len(conn.commands) != 0 {
+		t.Errorf("Invocation = %+v, sent %v, want %v without sending the command", inv, conn.commands,
+			rjs.ErrVersioning)
+	}
+	for _, path := range []string{".meta.version", "$..version", "[0]"} {
+		if err := rh.EnableVersioning(path); !errors.Is(err, rjs.ErrVersioning) {
+			t.Errorf("EnableVersioning(%q) error = %v, want %v", path, err, rjs.ErrVersioning)
+		}
+	}
+	if err := rh.EnableVersioning(""); err != nil {
+		t.Fatalf("EnableVersioning() error = %v", err)
+	}
+
+	if res, err := rh.JSONSet("doc", ".", map[string]string{"name": "x"}, rjs.SetOptionNX); err != nil || res != "OK" {
+		t.Errorf("JSONSet() = %v %v, want OK", res, err)
+	}
+	want := []interface{}{"EVALSHA", rjs.ScriptVersioned.Hash(), 1, "doc", DefaultVersionPath, "", "JSON.SET", ".",
+		[]byte(`{"name":"x"}`), "NX"}
+	if !reflect.DeepEqual(conn.commands[0], want) {
+		t.Errorf("sent %v, want %v", conn.commands[0], want)
+	}
+	if inv := seen.last(); inv.Command != rjs.ReJSONCommandSET || inv.Script != rjs.ScriptVersioned.Name() {
+		t.Errorf("Invocation = %+v, want a versioned JSON.SET", inv)
+	}
+
+	conn.reply = []interface{}{int64(1), "5", int64(4)}
+	if res, err := rh.IfVersion(3).JSONNumIncrBy("doc", ".n", 2); err != nil || !reflect.DeepEqual(res, []byte("5")) {
+		t.Errorf("JSONNumIncrBy() = %v %v, want 5", res, err)
+	}
+	want = []interface{}{"EVALSHA", rjs.ScriptVersioned.Hash(), 1, "doc", DefaultVersionPath, "3", "JSON.NUMINCRBY",
+		".n", 2}
+	if !reflect.DeepEqual(conn.commands[1], want) {
+		t.Errorf("sent %v, want %v", conn.commands[1], want)
+	}
+	if inv := seen.last(); inv.Idempotent() {
+		t.Errorf("Invocation = %+v, want a non idempotent write", inv)
+	}
+
+	conn.reply = []interface{}{int64(0), int64(4)}
+	_, err := rh.IfVersion(3).JSONDel("doc", ".n")
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, rjs.ErrVersionConflict) || conflict.Expected != 3 ||
+		conflict.Actual != 4 {
+		t.Errorf("JSONDel() error = %v, want a conflict at version 4", err)
+	}
+
+	conn.commands = nil
+	if _, err := rh.JSONSet("doc", "$", []int{1}); !errors.Is(err, rjs.ErrVersioning) {
+		t.Errorf("JSONSet() of an array root error = %v, want %v", err, rjs.ErrVersioning)
+	}
+	_, err = rh.JSONSetWithTTL("doc", ".", map[string]int{}, rjs.TTLOptionKEEPTTL)
+	if !errors.Is(err, rjs.ErrVersioning) {
+		t.Errorf("JSONSetWithTTL() error = %v, want %v", err, rjs.ErrVersioning)
+	}
+	if _, err = rh.JSONSetIf("doc", ".status", "packed", "shipped"); !errors.Is(err, rjs.ErrVersioning) {
+		t.Errorf("JSONSetIf() error = %v, want %v", err, rjs.ErrVersioning)
+	}
+	if _, err = rh.JSONArrPrependCapped("doc", ".events", 3, "a"); !errors.Is(err, rjs.ErrVersioning) {
+		t.Errorf("JSONArrPrependCapped() error = %v, want %v", err, rjs.ErrVersioning)
+	}
+	if len(conn.commands) != 0 {
+		t.Errorf("sent %v, want no command", conn.commands)
+	}
+
+	conn.reply = []interface{}{int64(1), []byte("7"), int64(1700000030000)}
+	if err = rh.NewLock("doc", LockOptions{Owner: "worker-1"}).Acquire(); err != nil ||
+		conn.commands[0][1] != rjs.ScriptLock.Hash() {
+		t.Errorf("Acquire() error = %v, sent %v, want the lock script", err, conn.commands)
+	}
+	conn.commands = nil
+	conn.reply = []byte(`{}`)
+	if _, err := rh.IfVersion(3).JSONGet("doc", "."); err != nil || conn.commands[0][0] != "JSON.GET" {
+		t.Errorf("JSONGet() = %v, sent %v, want a plain JSON.GET", err, conn.commands)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	conn := &fakeConn{reply: "OK"}
+	rh, seen := recordingHandler(conn)
+	rh.AuditWrites(AuditOptions{
+		MaxLen:   1000,
+		OldValue: true,
+		Caller: func(ctx context.Context) string {
+			caller, _ := ctx.Value(ctxKey{}).(string)
+			return caller
+		},
+	})
+	rh = rh.SetContext(context.WithValue(context.Background(), ctxKey{}, "alice"))
+
+	if res, err := rh.JSONSet("doc", ".name", "x", rjs.SetOptionXX); err != nil || res != "OK" {
+		t.Errorf("JSONSet() = %v %v, want OK", res, err)
+	}
+	want := []interface{}{"EVALSHA", rjs.ScriptAudited.Hash(), 2, "doc", DefaultAuditStream, "1000", "1", "alice", "",
+		"", "JSON.SET", ".name", []byte(`"x"`), "XX"}
+	if !reflect.DeepEqual(conn.commands[0], want) {
+		t.Errorf("sent %v, want %v", conn.commands[0], want)
+	}
+	if inv := seen.last(); inv.Command != rjs.ReJSONCommandSET || inv.Script != rjs.ScriptAudited.Name() {
+		t.Errorf("Invocation = %+v, want an audited JSON.SET", inv)
+	}
+
+	if err := rh.EnableVersioning(""); err != nil {
+		t.Fatalf("EnableVersioning() error = %v", err)
+	}
+	conn.reply = []interface{}{int64(1), "3", int64(5)}
+	if res, err := rh.IfVersion(4).JSONNumIncrBy("doc", ".n", 1); err != nil || !reflect.DeepEqual(res, []byte("3")) {
+		t.Errorf("JSONNumIncrBy() = %v %v, want 3", res, err)
+	}
+	want = []interface{}{"EVALSHA", rjs.ScriptAudited.Hash(), 2, "doc", DefaultAuditStream, "1000", "1", "alice",
+		DefaultVersionPath, "4", "JSON.NUMINCRBY", ".n", 1}
+	if !reflect.DeepEqual(conn.commands[1], want) {
+		t.Errorf("sent %v, want %v", conn.commands[1], want)
+	}
+	conn.reply = []interface{}{int64(0), int64(5)}
+	if _, err := rh.IfVersion(4).JSONDel("doc", "."); !errors.Is(err, rjs.ErrVersionConflict) {
+		t.Errorf("JSONDel() at a stale version error = %v, want %v", err, rjs.ErrVersionConflict)
+	}
+	rh.DisableVersioning()
+
+	conn.commands = nil
+	_, err := rh.JSONSetWithTTL("doc", ".", map[string]int{}, rjs.TTLOptionKEEPTTL)
+	if !errors.Is(err, rjs.ErrAuditing) || len(conn.commands) != 0 {
+		t.Errorf("JSONSetWithTTL() error = %v, sent %v, want %v", err, conn.commands, rjs.ErrAuditing)
+	}
+	if _, err := rh.IfVersion(4).JSONSet("doc", ".n", 1); !errors.Is(err, rjs.ErrVersioning) || len(conn.commands) != 0 {
+		t.Errorf("JSONSet() without versioning error = %v, sent %v, want %v", err, conn.commands, rjs.ErrVersioning)
+	}
+	conn.reply = []byte(`{}`)
+	if _, err := rh.JSONGet("doc", "."); err != nil || conn.commands[0][0] != "JSON.GET" {
+		t.Errorf("JSONGet() = %v, sent %v, want a plain JSON.GET", err, conn.commands)
+	}
+
+	sh := NewReJSONHandler()
+	sh.SetRedigoClient(conn)
+	sh.AuditWrites(AuditOptions{StreamFor: func(key string) string { return "{" + key + "}:audit" }})
+	conn.reply = int64(1)
+	if _, err := sh.JSONDel("doc", "."); err != nil {
+		t.Errorf("JSONDel() error = %v", err)
+	}
+	want = []interface{}{"EVALSHA", rjs.ScriptAudited.Hash(), 2, "doc", "{doc}:audit", "", "", "", "", "", "JSON.DEL",
+		"."}
+	if !reflect.DeepEqual(conn.commands[1], want) {
+		t.Errorf("sent %v, want %v", conn.commands[1], want)
+	}
+}
+
+func TestOptionalClientInterfaces(t *testing.T) {
+	conn := &fakeConn{reply: "OK"}
+	rh := NewReJSONHandler()
+	// a client implementing only the ReJSON interface, as an external one could
+	rh.setClient(rjs.ClientRedigo, struct{ ReJSON }{&clients.Redigo{Conn: conn}})
+
+	if _, err := rh.JSONNumIncrByNumber("doc", ".n", json.Number("1")); !errors.Is(err, rjs.ErrNotSupported) {
+		t.Errorf("JSONNumIncrByNumber() error = %v, want %v", err, rjs.ErrNotSupported)
+	}
+	if _, err := rh.JSONNumMultByNumber("doc", ".n", 2); !errors.Is(err, rjs.ErrNotSupported) {
+		t.Errorf("JSONNumMultByNumber() error = %v, want %v", err, rjs.ErrNotSupported)
+	}
+	if _, err := rh.JSONSetIf("doc", ".n", 1, 2); !errors.Is(err, rjs.ErrNotSupported) {
+		t.Errorf("JSONSetIf() error = %v, want %v", err, rjs.ErrNotSupported)
+	}
+	if len(conn.commands) != 0 {
+		t.Errorf("sent %v, want no command", conn.commands)
+	}
+	if res, err := rh.JSONSet("doc", ".", 1); err != nil || res != "OK" {
+		t.Errorf("JSONSet() = %v %v, want OK", res, err)
+	}
+}
+
+func TestInvocationPayloadSize(t *testing.T) {
+	tests := []struct {
+		name string
+		inv  Invocation
+		want int
+	}{
+		{"Set", Invocation{Command: rjs.ReJSONCommandSET, Args: []interface{}{map[string]int{"a": 1}, rjs.SetOptionNX}}, 7},
+		{"SetRaw", Invocation{Command: rjs.ReJSONCommandSET, Args: []interface{}{rjs.RawJSON(`[1, 2]`)}}, 6},
+		{"ArrAppend", Invocation{Command: rjs.ReJSONCommandARRAPPEND, Args: []interface{}{1, "a"}}, 4},
+		{"ArrInsert", Invocation{Command: rjs.ReJSONCommandARRINSERT, Args: []interface{}{0, 10}}, 2},
+		{"StrAppend", Invocation{Command: rjs.ReJSONCommandSTRAPPEND, Args: []interface{}{`"ab"`}}, 4},
+		{"Get", Invocation{Command: rjs.ReJSONCommandGET, Result: []byte(`{"a":1}`)}, 7},
+		{"MGet", Invocation{Command: rjs.ReJSONCommandMGET, Result: []interface{}{[]byte(`1`), nil, []byte(`22`)}}, 3},
+		{"Del", Invocation{Command: rjs.ReJSONCommandDEL, Result: int64(1)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.inv.PayloadSize(); got != tt.want {
+				t.Errorf("PayloadSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("MarshaledOnce", func(t *testing.T) {
+		conn := &fakeConn{reply: "OK"}
+		rh := NewReJSONHandler()
+		rh.SetRedigoClient(conn)
+		var sizes []int
+		rh.Use(func(next Invoker) Invoker {
+			return func(inv *Invocation) (interface{}, error) {
+				res, err := next(inv)
+				sizes = append(sizes, inv.PayloadSize(), inv.PayloadSize())
+				return res, err
+			}
+		})
+		value := &countingValue{}
+		if _, err := rh.JSONSet("doc", ".", value); err != nil {
+			t.Fatalf("JSONSet() error = %v", err)
+		}
+		if _, err := rh.JSONArrInsert("doc", ".items", 0, value, value); err != nil {
+			t.Fatalf("JSONArrInsert() error = %v", err)
+		}
+		if value.calls != 3 || !reflect.DeepEqual(sizes, []int{4, 4, 8, 8}) {
+			t.Errorf("marshaled %d times, sizes %v, want 3 times, sizes [4 4 8 8]", value.calls, sizes)
+		}
+		if want := []interface{}{"JSON.SET", "doc", ".", []byte("true")}; !reflect.DeepEqual(conn.commands[0], want) {
+			t.Errorf("sent %v, want %v", conn.commands[0], want)
+		}
+	})
+}
+
+// countingValue counts the calls of its MarshalJSON
+type countingValue struct {
+	calls int
+}
+
+func (v *countingValue) MarshalJSON() ([]byte, error) {
+	v.calls++
+	return []byte("true"), nil
+}
+
+// TestClusterMGet runs against the Redis Cluster nodes listed, comma separated,
+// in REJSON_TEST_CLUSTER_ADDRS and is skipped otherwise
+func TestClusterMGet(t *testing.T) {
+	addrs := os.Getenv("REJSON_TEST_CLUSTER_ADDRS")
+	if addrs == "" {
+		t.Skip("REJSON_TEST_CLUSTER_ADDRS not set")
+	}
+	cli := goredis.NewClusterClient(&goredis.ClusterOptions{Addrs: strings.Split(addrs, ",")})
+	defer func() {
+		_ = cli.ForEachMaster(context.Background(), func(ctx context.Context, client *goredis.Client) error {
+			return client.FlushAll(ctx).Err()
+		})
+		_ = cli.Close()
+	}()
+
+	rh := NewReJSONHandler()
+	rh.SetGoRedisClient(cli)
+
+	keys := make([]string, 0, 100)
+	want := make([]interface{}, 0, 101)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("mget:%d", i)
+		if _, err := rh.JSONSet(key, ".", i); err != nil {
+			t.Fatal("Failed to Set key ", err)
+		}
+		keys = append(keys, key)
+		want = append(want, []byte(fmt.Sprint(i)))
+	}
+	keys = append(keys, "mget:missing")
+	want = append(want, nil)
+
+	got, err := rh.JSONMGet(".", keys...)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONMGet() = %v %v, want %v", got, err, want)
+	}
+}
+
+type TestClient struct {
+	*testing.T
+	name string
+	conn interface{}
+	rh   *Handler
+}
+
+type helper struct {
+	cli       interface{}
+	name      string
+	closeFunc func()
+}
+
+func (t *TestClient) init() []helper {
+	t.name = "-"
+	t.conn = "inactive"
+	t.rh = NewReJSONHandler()
+
+	// Redigo Test Client
+	redigoCli, err := redigo.Dial("tcp", ":6379")
+	if err != nil {
+		t.Fatalf("redigo - could not connect to redigo: %v", err)
+		return nil
+	}
+
+	// GoRedis Test Client
+	goredisCli := goredis.NewUniversalClient(&goredis.UniversalOptions{
+		Addrs: []string{"localhost:6379"},
+	})
+
+	return []helper{
+		{cli: redigoCli, name: "Redigo ", closeFunc: func() {
+			_, err = redigoCli.Do("FLUSHALL")
+			if err != nil {
+				t.Fatalf("redigo - failed to flush: %v", err)
+			}
+			err = redigoCli.Close()
+			if err != nil {
+				t.Fatalf("redigo - failed to close: %v", err)
+			}
+		}},
+		{cli: goredisCli, name: "GoRedis ", closeFunc: func() {
+			if err := goredisCli.FlushAll(context.Background()).Err(); err != nil {
+				t.Fatalf("goredis - failed to flush: %v", err)
+			}
+			if err := goredisCli.Close(); err != nil {
+				t.Fatalf("goredis - failed to communicate to redis-server: %v", err)
+			}
+		}},
+	}
+}
+
+func (t *TestClient) SetTestingClient(conn interface{}) {
+	t.conn = conn
+
+	switch conn := conn.(type) {
+	case clients.RedigoClientConn:
+		t.name = "Redigo-"
+		t.rh.SetRedigoClient(conn)
+	case clients.GoRedisClientConn:
+		t.name = "GoRedis-"
+		t.rh.SetGoRedisClient(conn)
+	default:
+		t.name = "-"
+		t.conn = "inactive"
+		t.rh.SetClientInactive()
+	}
+}
+
+func TestReJSON(t *testing.T) {
+	test := TestClient{T: t}
+	list := test.init()
+	for _, obj := range list {
+		t.Run(obj.name+"TestJSONSet", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONSet(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONGet", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONGet(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONDel", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONDel(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONMGet", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONMGet(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONType", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONType(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONNumIncrBy", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONNumIncrBy(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONNumMultBy", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONNumMultBy(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONStrAppend", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONStrAppend(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONStrLen", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONStrLen(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONArrAppend", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONArrAppend(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONArrLen", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONArrLen(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONArrPop", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONArrPop(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONArrIndex", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONArrIndex(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONArrTrim", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONArrTrim(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONArrInsert", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONArrInsert(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONObjLen", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONObjLen(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONObjKeys", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONObjKeys(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONDebug", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONDebug(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONForget", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONForget(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONResp", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONResp(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONLargeNumbers", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONLargeNumbers(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONGetStream", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONGetStream(test.rh, t)
+		})
+		t.Run(obj.name+"TestArrayIterator", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testArrayIterator(test.rh, t)
+		})
+		t.Run(obj.name+"TestScanJSON", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testScanJSON(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONMGetSlotValidation", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONMGetSlotValidation(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONGetCache", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONGetCache(test.rh, t)
+		})
+		t.Run(obj.name+"TestWithPrefix", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testWithPrefix(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONSetWithTTL", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONSetWithTTL(test.rh, t)
+		})
+		t.Run(obj.name+"TestScripts", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testScripts(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONSetIf", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONSetIf(test.rh, t)
+		})
+		t.Run(obj.name+"TestJSONArrCapped", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testJSONArrCapped(test.rh, t)
+		})
+		t.Run(obj.name+"TestLock", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testLock(test.rh, t)
+		})
+		t.Run(obj.name+"TestVersioning", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testVersioning(test.rh, t)
+		})
+		t.Run(obj.name+"TestAudit", func(t *testing.T) {
+			test.SetTestingClient(obj.cli)
+			testAudit(test.rh, t)
+		})
+		obj.closeFunc()
+	}
+
+}
+
+func TestReJSONWithContext(t *testing.T) {
+	ctx := context.Background()
+	ctxCn, cancel := context.WithCancel(ctx)
+	cancel()
+
+	testObj := TestObject{
+		Name:   "itemName",
+		Number: 1,
+	}
+	res := []byte("{\"name\":\"itemName\",\"number\":1}")
+
+	test := TestClient{T: t}
+	list := test.init()
+	for _, obj := range list {
+		test.SetTestingClient(obj.cli)
+		rh := test.rh
+
+		// check with canceled context
+		ok, err := rh.SetContext(ctxCn).JSONSet("testObj#1", ".", testObj)
+		if rh.active().name == rjs.ClientGoRedis {
+			if err == nil || ok == "OK" {
+				t.Errorf("JSONSet() got = %v %v, want nil, error: context.Canceled", ok, err)
+			}
+			got, err := rh.JSONGet("testObj#1", ".")
+			if err == nil || reflect.DeepEqual(got, res) {
+				t.Errorf("JSONGet() got = %v %v, want: no key found error", got, err)
+			}
+		} else {
+			if err != nil || ok != "OK" {
+				t.Errorf("JSONSet() got = %v %v, want OK, nil", ok, err)
+			}
+			got, err := rh.JSONGet("testObj#1", ".")
+			if err != nil || !reflect.DeepEqual(got, res) {
+				t.Errorf("JSONGet() got = %v %v, want: %v", got, err, res)
+			}
+		}
+
+		// check with normal context
+		ok, err = rh.SetContext(ctx).JSONSet("testObj#2", ".", testObj)
+		if err != nil || ok != "OK" {
+			t.Errorf("JSONSet() got = %v %v, want OK, nil", ok, err)
+		}
+		got, err := rh.JSONGet("testObj#2", ".")
+		if err != nil || !reflect.DeepEqual(got, res) {
+			t.Errorf("JSONGet() got = %v %v, want: %v", got, err, res)
+		}
+		got, err = rh.SetContext(ctx).JSONGet("testObj#2", ".")
+		if err != nil || !reflect.DeepEqual(got, res) {
+			t.Errorf("JSONGet() got = %v %v, want: %v", got, err, res)
+		}
+
+		// check without context
+		ok, err = rh.JSONSet("testObj#3", ".", testObj)
+		if err != nil || ok != "OK" {
+			t.Errorf("JSONSet() got = %v %v, want OK, nil", ok, err)
+		}
+		got, err = rh.JSONGet("testObj#3", ".")
+		if err != nil || !reflect.DeepEqual(got, res) {
+			t.Errorf("JSONGet() got = %v %v, want: %v", got, err, res)
+		}
+		got, err = rh.SetContext(ctx).JSONGet("testObj#3", ".")
+		if err != nil || !reflect.DeepEqual(got, res) {
+			t.Errorf("JSONGet() got = %v %v, want: %v", got, err, res)
+		}
+
+		obj.closeFunc()
+	}
+}
+
+type TestObject struct {
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+}
+
+func testJSONSet(rh *Handler, t *testing.T) {
+
+	testObj := TestObject{
+		"item#1",
+		1,
+	}
+	type args struct {
+		key  string
+		path string
+		obj  interface{}
+		opt  []rjs.SetOption
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantRes interface{}
+		wantErr bool
+	}{
+		{
+			name: "SimpleString",
+			args: args{
+				key:  "kstr",
+				path: ".",
+				obj:  "simplestring",
+			},
+			wantRes: "OK",
+			wantErr: false,
+		},
+		{
+			name: "SimpleInt",
+			args: args{
+				key:  "kint",
+				path: ".",
+				obj:  1234,
+			},
+			wantRes: "OK",
+			wantErr: false,
+		},
+		{
+			name: "SimpleStruct",
+			args: args{
+				key:  "kstruct",
+				path: ".",
+				obj:  testObj,
+			},
+			wantRes: "OK",
+			wantErr: false,
+		},
+		{
+			name: "SimpleStructFieldOK",
+			args: args{
+				key:  "kstruct",
+				path: "name",
+				obj:  "foobar",
+			},
+			wantRes: "OK",
+			wantErr: false,
+		},
+		{
+			name: "SimpleStringWithNXOK",
+			args: args{
+				key:  "kstrnx",
+				path: ".",
+				obj:  123,
+				opt:  []rjs.SetOption{rjs.SetOptionNX},
+			},
+			wantRes: "OK",
+			wantErr: false,
+		},
+		{
+			name: "SimpleStringWithNXNotOK",
+			args: args{
+				key:  "kstrnx",
+				path: ".",
+				obj:  "simplestringnx",
+				opt:  []rjs.SetOption{rjs.SetOptionNX},
+			},
+			wantRes: nil,
+			wantErr: false,
+		},
+		{
+			name: "SimpleStringWithXXOK",
+			args: args{
+				key:  "kstrnx",
+				path: ".",
+				obj:  "simplestringfoo",
+				opt:  []rjs.SetOption{rjs.SetOptionXX},
+			},
+			wantRes: "OK",
+			wantErr: false,
+		},
+		{
+			name: "SimpleStringWithXXNotOK",
+			args: args{
+				key:  "kstrxx",
+				path: ".",
+				obj:  "simplestringfoobar",
+				opt:  []rjs.SetOption{rjs.SetOptionXX},
+			},
+			wantRes: nil,
+			wantErr: false,
+		},
+		{
+			name: "RawJSON",
+			args: args{
+				key:  "kraw",
+				path: ".",
+				obj:  rjs.RawJSON(`{"name":"item#1","number":1}`),
+			},
+			wantRes: "OK",
+			wantErr: false,
+		},
+		{
+			name: "RawMessage",
+			args: args{
+				key:  "krawmsg",
+				path: ".",
+				obj:  json.RawMessage(`[1,2,3]`),
+			},
+			wantRes: "OK",
+			wantErr: false,
+		},
+		{
+			name: "InvalidRawJSON",
+			args: args{
+				key:  "krawinvalid",
+				path: ".",
+				obj:  rjs.RawJSON(`{"name":`),
+			},
+			wantRes: nil,
+			wantErr: true,
+		},
+		{
+			name: rjs.ClientInactive,
+			args: args{
+				key:  "active",
+				path: ".",
+				obj:  "client",
+			},
+			wantRes: nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == rjs.ClientInactive {
+				rh.SetClientInactive()
+			}
+			gotRes, err := rh.JSONSet(tt.args.key, tt.args.path, tt.args.obj, tt.args.opt...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("JSONSet() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
+				t.Errorf("JSONSet() = %v, want %v", gotRes, tt.wantRes)
+			}
+		})
+	}
+}
+
+func testJSONGet(rh *Handler, t *testing.T) {
+
+	_, err := rh.JSONSet("kstr", ".", "simplestring")
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
+	_, err = rh.JSONSet("kint", ".", 123)
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
+	testObj := TestObject{
+		Name:   "Item#1",
+		Number: 1,
+	}
+
+	_, err = rh.JSONSet("kstruct", ".", testObj)
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
+	type args struct {
+		key     string
+		path    string
+		options []rjs.GetOption
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantRes interface{}
+		wantErr bool
+	}{
+		{
+			name: "SimpleString",
+			args: args{
+				key:     "kstr",
+				path:    ".",
+				options: []rjs.GetOption{},
+			},
+			wantRes: []byte("\"simplestring\""),
+			wantErr: false,
+		},
+		{
+			name: "SimpleInt",
+			args: args{
+				key:     "kint",
+				path:    ".",
+				options: []rjs.GetOption{},
+			},
+			wantRes: []byte("123"),
+			wantErr: false,
+		},
+		{
+			name: "SimpleStruct",
+			args: args{
+				key:     "kstruct",
+				path:    ".",
+				options: []rjs.GetOption{},
+			},
+			wantRes: []byte("{\"name\":\"Item#1\",\"number\":1}"),
+			wantErr: false,
+		},
+		{
+			name: "SimpleStruct",
+			args: args{
+				key:  "kstruct",
+				path: ".",
+				options: []rjs.GetOption{
+					rjs.GETOptionINDENT,
+					rjs.GETOptionNEWLINE,
+					rjs.GETOptionNOESCAPE,
+					rjs.GETOptionSPACE,
+				},
+			},
+			wantRes: []byte("{\n\t\"name\": \"Item#1\",\n\t\"number\": 1\n}"),
+			wantErr: false,
+		},
+		{
+			name: rjs.ClientInactive,
+			args: args{
+				key:  "active",
+				path: ".",
+			},
+			wantRes: nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == rjs.ClientInactive {
+				rh.SetClientInactive()
+			}
+			gotRes, err := rh.JSONGet(tt.args.key, tt.args.path, tt.args.options...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("JSONGet() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
+				t.Errorf("\nJSONGet() = %v,\nwant      = %v", gotRes, tt.wantRes)
+			}
+		})
+	}
+}
+
+func testJSONDel(rh *Handler, t *testing.T) {
+
+	_, err := rh.JSONSet("kstr", ".", "simplestring")
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
+	testObj := TestObject{
+		Name:   "Item#1",
+		Number: 1,
+	}
+
+	_, err = rh.JSONSet("kstruct", ".", testObj)
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
+	type args struct {
+		key  string
+		path string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantRes interface{}
+		wantErr bool
+	}{
+		{
+			name: "SimpleString",
+			args: args{
+				key:  "kstr",
+				path: ".",
+			},
+			wantRes: int64(1),
+			wantErr: false,
+		},
+		{
+			name: "SimpleStructFieldOK",
+			args: args{
+				key:  "kstruct",
+				path: "name",
+			},
+			wantRes: int64(1),
+			wantErr: false,
+		},
+		{
+			name: "SimpleStructFieldNotOK",
+			args: args{
+				key:  "kstruct",
+				path: "foobar",
+			},
+			wantRes: int64(0),
+			wantErr: false,
+		},
+		{
+			name: "SimpleStruct",
+			args: args{
+				key:  "kstruct",
+				path: ".",
+			},
+			wantRes: int64(1),
+			wantErr: false,
+		},
+		{
+			name: rjs.ClientInactive,
+			args: args{
+				key:  "active",
+				path: ".",
+			},
+			wantRes: nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == rjs.ClientInactive {
+				rh.SetClientInactive()
+			}
+			gotRes, err := rh.JSONDel(tt.args.key, tt.args.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("JSONDel() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
+				t.Errorf("JSONDel() = %t, want %t", gotRes, tt.wantRes)
+			}
+		})
+	}
+}
+
+func testJSONMGet(rh *Handler, t *testing.T) {
+
+	_, err := rh.JSONSet("kstr", ".", "simplestring")
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
+	testObj1 := TestObject{
+		Name:   "Item#1",
+		Number: 1,
+	}
+
+	testObj2 := TestObject{
+		Name:   "Item#2",
+		Number: 2,
+	}
+
+	testObj3 := TestObject{
+		Name:   "Item#3",
+		Number: 3,
+	}
+
+	_, err = rh.JSONSet("testObj1", ".", testObj1)
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
+	_, err = rh.JSONSet("testObj2", ".", testObj2)
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
+	_, err = rh.JSONSet("testObj3", ".", testObj3)
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
+	resultNameThreeStudents := make([]interface{}, 0)
+	type args struct {
+		path string
+		keys []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantRes interface{}
+		wantErr bool
+	}{
+		{
+			name: "NameThreeStudents",
+			args: args{
+				path: "name",
+				keys: []string{"testObj1", "testObj2", "testObj3"},
+			},
+			wantRes: append(resultNameThreeStudents,
+				[]byte("\"Item#1\""),
+				[]byte("\"Item#2\""),
+				[]byte("\"Item#3\""),
+			),
+			wantErr: false,
+		},
+		{
+			name: "NonExistingKey",
+			args: args{
+				path: "name",
+				keys: []string{"testObj1", "testObj2", "foobar"},
+			},
+			wantRes: append(resultNameThreeStudents,
+				[]byte("\"Item#1\""),
+				[]byte("\"Item#2\""),
+				nil,
+			),
+			wantErr: false,
+		},
+		{
+			name: "NonExistingKey",
+			args: args{
+				path: "foobar",
+				keys: []string{"testObj1"},
+			},
+			wantRes: append(resultNameThreeStudents,
+				nil,
+			),
+			wantErr: false,
+		},
+		{
+			name: "NoKeys",
+			args: args{
+				path: "name",
+				keys: []string{},
+			},
+			wantRes: nil,
+			wantErr: true,
+		},
+		{
+			name: rjs.ClientInactive,
+			args: args{
+				keys: []string{"active"},
+				path: ".",
+			},
+			wantRes: nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == rjs.ClientInactive {
+				rh.SetClientInactive()
+			}
+			gotRes, err := rh.JSONMGet(tt.args.path, tt.args.keys...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("JSONMGet() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
+				t.Errorf("JSONMGet() = %v, want %v", gotRes, tt.wantRes)
+			}
+		})
+	}
+}
+
+func testJSONType(rh *Handler, t *testing.T) {
+
+	_, err := rh.JSONSet("kstr", ".", "simplestring")
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
 
 	testObj := TestObject{
-		"item#1",
-		1,
+		Name:   "Item#1",
+		Number: 1,
+	}
+
+	_, err = rh.JSONSet("testObj", ".", testObj)
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
 	}
+
 	type args struct {
 		key  string
 		path string
-		obj  interface{}
-		opt  []rjs.SetOption
 	}
 	tests := []struct {
 		name    string
@@ -271,85 +2495,37 @@ func testJSONSet(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "SimpleString",
-			args: args{
-				key:  "kstr",
-				path: ".",
-				obj:  "simplestring",
-			},
-			wantRes: "OK",
-			wantErr: false,
-		},
-		{
-			name: "SimpleInt",
-			args: args{
-				key:  "kint",
-				path: ".",
-				obj:  1234,
-			},
-			wantRes: "OK",
-			wantErr: false,
-		},
-		{
-			name: "SimpleStruct",
+			name: "Object",
 			args: args{
-				key:  "kstruct",
+				key:  "testObj",
 				path: ".",
-				obj:  testObj,
 			},
-			wantRes: "OK",
+			wantRes: "object",
 			wantErr: false,
 		},
 		{
-			name: "SimpleStructFieldOK",
+			name: "String",
 			args: args{
-				key:  "kstruct",
+				key:  "testObj",
 				path: "name",
-				obj:  "foobar",
-			},
-			wantRes: "OK",
-			wantErr: false,
-		},
-		{
-			name: "SimpleStringWithNXOK",
-			args: args{
-				key:  "kstrnx",
-				path: ".",
-				obj:  123,
-				opt:  []rjs.SetOption{rjs.SetOptionNX},
-			},
-			wantRes: "OK",
-			wantErr: false,
-		},
-		{
-			name: "SimpleStringWithNXNotOK",
-			args: args{
-				key:  "kstrnx",
-				path: ".",
-				obj:  "simplestringnx",
-				opt:  []rjs.SetOption{rjs.SetOptionNX},
 			},
-			wantRes: nil,
+			wantRes: "string",
 			wantErr: false,
 		},
 		{
-			name: "SimpleStringWithXXOK",
+			name: "Integer",
 			args: args{
-				key:  "kstrnx",
-				path: ".",
-				obj:  "simplestringfoo",
-				opt:  []rjs.SetOption{rjs.SetOptionXX},
+				key:  "testObj",
+				path: "number",
 			},
-			wantRes: "OK",
+			wantRes: "integer",
 			wantErr: false,
 		},
 		{
-			name: "SimpleStringWithXXNotOK",
+			name: "NotExist",
 			args: args{
-				key:  "kstrxx",
-				path: ".",
-				obj:  "simplestringfoobar",
-				opt:  []rjs.SetOption{rjs.SetOptionXX},
+				key:  "foobar",
+				path: "number",
 			},
 			wantRes: nil,
 			wantErr: false,
@@ -359,7 +2535,6 @@ func testJSONSet(rh *Handler, t *testing.T) {
 			args: args{
 				key:  "active",
 				path: ".",
-				obj:  "client",
 			},
 			wantRes: nil,
 			wantErr: true,
@@ -370,27 +2545,27 @@ func testJSONSet(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONSet(tt.args.key, tt.args.path, tt.args.obj, tt.args.opt...)
+			gotRes, err := rh.JSONType(tt.args.key, tt.args.path)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONSet() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONType() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONSet() = %v, want %v", gotRes, tt.wantRes)
+				t.Errorf("JSONType() = %v, want %v", gotRes, tt.wantRes)
 			}
 		})
 	}
 }
 
-func testJSONGet(rh *Handler, t *testing.T) {
+func testJSONNumIncrBy(rh *Handler, t *testing.T) {
 
-	_, err := rh.JSONSet("kstr", ".", "simplestring")
+	_, err := rh.JSONSet("kint", ".", 1)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
-	_, err = rh.JSONSet("kint", ".", 123)
+	_, err = rh.JSONSet("kstr", ".", "simplestring")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
@@ -401,16 +2576,16 @@ func testJSONGet(rh *Handler, t *testing.T) {
 		Number: 1,
 	}
 
-	_, err = rh.JSONSet("kstruct", ".", testObj)
+	_, err = rh.JSONSet("testObj", ".", testObj)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
 	type args struct {
-		key     string
-		path    string
-		options []rjs.GetOption
+		key    string
+		path   string
+		number int
 	}
 	tests := []struct {
 		name    string
@@ -419,49 +2594,44 @@ func testJSONGet(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "SimpleString",
+			name: "SimpleInt",
 			args: args{
-				key:     "kstr",
-				path:    ".",
-				options: []rjs.GetOption{},
+				key:    "kint",
+				path:   ".",
+				number: 5,
 			},
-			wantRes: []byte("\"simplestring\""),
+			wantRes: []byte("6"),
 			wantErr: false,
 		},
 		{
-			name: "SimpleInt",
+			name: "SimpleStruct",
 			args: args{
-				key:     "kint",
-				path:    ".",
-				options: []rjs.GetOption{},
+				key:    "testObj",
+				path:   ".number",
+				number: 5,
 			},
-			wantRes: []byte("123"),
+			wantRes: []byte("6"),
 			wantErr: false,
 		},
 		{
-			name: "SimpleStruct",
+			name: "SimpleStringNotOK",
 			args: args{
-				key:     "kstruct",
-				path:    ".",
-				options: []rjs.GetOption{},
+				key:    "kstr",
+				path:   ".",
+				number: 5,
 			},
-			wantRes: []byte("{\"name\":\"Item#1\",\"number\":1}"),
-			wantErr: false,
+			wantRes: redigo.Error("ERR wrong type of path value - expected a number but found string"),
+			wantErr: true,
 		},
 		{
-			name: "SimpleStruct",
+			name: "SimpleStructNotOK",
 			args: args{
-				key:  "kstruct",
-				path: ".",
-				options: []rjs.GetOption{
-					rjs.GETOptionINDENT,
-					rjs.GETOptionNEWLINE,
-					rjs.GETOptionNOESCAPE,
-					rjs.GETOptionSPACE,
-				},
+				key:    "testObj",
+				path:   ".",
+				number: 5,
 			},
-			wantRes: []byte("{\n\t\"name\": \"Item#1\",\n\t\"number\": 1\n}"),
-			wantErr: false,
+			wantRes: redigo.Error("ERR wrong type of path value - expected a number but found object"),
+			wantErr: true,
 		},
 		{
 			name: rjs.ClientInactive,
@@ -478,21 +2648,27 @@ func testJSONGet(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONGet(tt.args.key, tt.args.path, tt.args.options...)
+			gotRes, err := rh.JSONNumIncrBy(tt.args.key, tt.args.path, tt.args.number)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONGet() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONNumIncrBy() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("\nJSONGet() = %v,\nwant      = %v", gotRes, tt.wantRes)
+				t.Errorf("JSONNumIncrBy() = %v, want %v", gotRes, tt.wantRes)
 			}
 		})
 	}
 }
 
-func testJSONDel(rh *Handler, t *testing.T) {
+func testJSONNumMultBy(rh *Handler, t *testing.T) {
 
-	_, err := rh.JSONSet("kstr", ".", "simplestring")
+	_, err := rh.JSONSet("kint", ".", 2)
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
+	_, err = rh.JSONSet("kstr", ".", "simplestring")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
@@ -500,18 +2676,19 @@ func testJSONDel(rh *Handler, t *testing.T) {
 
 	testObj := TestObject{
 		Name:   "Item#1",
-		Number: 1,
+		Number: 2,
 	}
 
-	_, err = rh.JSONSet("kstruct", ".", testObj)
+	_, err = rh.JSONSet("testObj", ".", testObj)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
 	type args struct {
-		key  string
-		path string
+		key    string
+		path   string
+		number int
 	}
 	tests := []struct {
 		name    string
@@ -520,40 +2697,44 @@ func testJSONDel(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "SimpleString",
+			name: "SimpleInt",
 			args: args{
-				key:  "kstr",
-				path: ".",
+				key:    "kint",
+				path:   ".",
+				number: 5,
 			},
-			wantRes: int64(1),
+			wantRes: []byte("10"),
 			wantErr: false,
 		},
 		{
-			name: "SimpleStructFieldOK",
+			name: "SimpleStruct",
 			args: args{
-				key:  "kstruct",
-				path: "name",
+				key:    "testObj",
+				path:   ".number",
+				number: 5,
 			},
-			wantRes: int64(1),
+			wantRes: []byte("10"),
 			wantErr: false,
 		},
 		{
-			name: "SimpleStructFieldNotOK",
+			name: "SimpleStringNotOK",
 			args: args{
-				key:  "kstruct",
-				path: "foobar",
+				key:    "kstr",
+				path:   ".",
+				number: 5,
 			},
-			wantRes: int64(0),
-			wantErr: false,
+			wantRes: redigo.Error("ERR wrong type of path value - expected a number but found string"),
+			wantErr: true,
 		},
 		{
-			name: "SimpleStruct",
+			name: "SimpleStructNotOK",
 			args: args{
-				key:  "kstruct",
-				path: ".",
+				key:    "testObj",
+				path:   ".",
+				number: 5,
 			},
-			wantRes: int64(1),
-			wantErr: false,
+			wantRes: redigo.Error("ERR wrong type of path value - expected a number but found object"),
+			wantErr: true,
 		},
 		{
 			name: rjs.ClientInactive,
@@ -570,63 +2751,41 @@ func testJSONDel(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONDel(tt.args.key, tt.args.path)
+			gotRes, err := rh.JSONNumMultBy(tt.args.key, tt.args.path, tt.args.number)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONDel() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONNumMultBy() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONDel() = %t, want %t", gotRes, tt.wantRes)
-			}
-		})
-	}
-}
-
-func testJSONMGet(rh *Handler, t *testing.T) {
-
-	_, err := rh.JSONSet("kstr", ".", "simplestring")
-	if err != nil {
-		t.Fatal("Failed to Set key ", err)
-		return
-	}
-
-	testObj1 := TestObject{
-		Name:   "Item#1",
-		Number: 1,
-	}
-
-	testObj2 := TestObject{
-		Name:   "Item#2",
-		Number: 2,
+			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
+				t.Errorf("JSONNumMultBy() = %v, want %v", gotRes, tt.wantRes)
+			}
+		})
 	}
+}
 
-	testObj3 := TestObject{
-		Name:   "Item#3",
-		Number: 3,
-	}
+func testJSONStrAppend(rh *Handler, t *testing.T) {
 
-	_, err = rh.JSONSet("testObj1", ".", testObj1)
+	_, err := rh.JSONSet("kstr", ".", "simplestring")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
-	_, err = rh.JSONSet("testObj2", ".", testObj2)
-	if err != nil {
-		t.Fatal("Failed to Set key ", err)
-		return
+	testObj := TestObject{
+		Name:   "Item#1",
+		Number: 1,
 	}
 
-	_, err = rh.JSONSet("testObj3", ".", testObj3)
+	_, err = rh.JSONSet("testObj", ".", testObj)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
-	resultNameThreeStudents := make([]interface{}, 0)
 	type args struct {
-		path string
-		keys []string
+		key        string
+		path       string
+		jsonstring string
 	}
 	tests := []struct {
 		name    string
@@ -635,55 +2794,39 @@ func testJSONMGet(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "NameThreeStudents",
-			args: args{
-				path: "name",
-				keys: []string{"testObj1", "testObj2", "testObj3"},
-			},
-			wantRes: append(resultNameThreeStudents,
-				[]byte("\"Item#1\""),
-				[]byte("\"Item#2\""),
-				[]byte("\"Item#3\""),
-			),
-			wantErr: false,
-		},
-		{
-			name: "NonExistingKey",
+			name: "SimpleString",
 			args: args{
-				path: "name",
-				keys: []string{"testObj1", "testObj2", "foobar"},
+				key:        "kstr",
+				path:       ".",
+				jsonstring: "\"Appended\"",
 			},
-			wantRes: append(resultNameThreeStudents,
-				[]byte("\"Item#1\""),
-				[]byte("\"Item#2\""),
-				nil,
-			),
+			wantRes: int64(20),
 			wantErr: false,
 		},
 		{
-			name: "NonExistingKey",
+			name: "SimpleStruct",
 			args: args{
-				path: "foobar",
-				keys: []string{"testObj1"},
+				key:        "testObj",
+				path:       "name",
+				jsonstring: "\"24\"",
 			},
-			wantRes: append(resultNameThreeStudents,
-				nil,
-			),
+			wantRes: int64(8),
 			wantErr: false,
 		},
 		{
-			name: "NoKeys",
+			name: "SimpleStructNotOK",
 			args: args{
-				path: "name",
-				keys: []string{},
+				key:        "testObj",
+				path:       "number",
+				jsonstring: "\"24\"",
 			},
-			wantRes: nil,
+			wantRes: redigo.Error("ERR wrong type of path value - expected string but found integer"),
 			wantErr: true,
 		},
 		{
 			name: rjs.ClientInactive,
 			args: args{
-				keys: []string{"active"},
+				key:  "active",
 				path: ".",
 			},
 			wantRes: nil,
@@ -695,19 +2838,19 @@ func testJSONMGet(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONMGet(tt.args.path, tt.args.keys...)
+			gotRes, err := rh.JSONStrAppend(tt.args.key, tt.args.path, tt.args.jsonstring)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONMGet() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONStrAppend() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONMGet() = %v, want %v", gotRes, tt.wantRes)
+				t.Errorf("JSONStrAppend() = %v, want %t", gotRes, tt.wantRes)
 			}
 		})
 	}
 }
 
-func testJSONType(rh *Handler, t *testing.T) {
+func testJSONStrLen(rh *Handler, t *testing.T) {
 
 	_, err := rh.JSONSet("kstr", ".", "simplestring")
 	if err != nil {
@@ -737,40 +2880,31 @@ func testJSONType(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "Object",
+			name: "SimpleString",
 			args: args{
-				key:  "testObj",
+				key:  "kstr",
 				path: ".",
 			},
-			wantRes: "object",
+			wantRes: int64(12),
 			wantErr: false,
 		},
 		{
-			name: "String",
+			name: "SimpleStruct",
 			args: args{
 				key:  "testObj",
 				path: "name",
 			},
-			wantRes: "string",
+			wantRes: int64(6),
 			wantErr: false,
 		},
 		{
-			name: "Integer",
+			name: "SimpleStructNotOK",
 			args: args{
 				key:  "testObj",
 				path: "number",
 			},
-			wantRes: "integer",
-			wantErr: false,
-		},
-		{
-			name: "NotExist",
-			args: args{
-				key:  "foobar",
-				path: "number",
-			},
-			wantRes: nil,
-			wantErr: false,
+			wantRes: redigo.Error("ERR wrong type of path value - expected string but found integer"),
+			wantErr: true,
 		},
 		{
 			name: rjs.ClientInactive,
@@ -787,38 +2921,37 @@ func testJSONType(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONType(tt.args.key, tt.args.path)
+			gotRes, err := rh.JSONStrLen(tt.args.key, tt.args.path)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONType() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONStrLen() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONType() = %v, want %v", gotRes, tt.wantRes)
+				t.Errorf("JSONStrLen() = %v, want %v", gotRes, tt.wantRes)
 			}
 		})
 	}
 }
 
-func testJSONNumIncrBy(rh *Handler, t *testing.T) {
+func testJSONArrAppend(rh *Handler, t *testing.T) {
 
-	_, err := rh.JSONSet("kint", ".", 1)
-	if err != nil {
-		t.Fatal("Failed to Set key ", err)
-		return
+	values := make([]interface{}, 0)
+	valuesStr := []string{"one"}
+	for _, value := range valuesStr {
+		values = append(values, value)
 	}
-
-	_, err = rh.JSONSet("kstr", ".", "simplestring")
+	_, err := rh.JSONSet("karr", ".", values)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
-
-	testObj := TestObject{
-		Name:   "Item#1",
-		Number: 1,
+	appendValues := make([]interface{}, 0)
+	valuesAppendStr := []string{"two", "three"}
+	for _, valueAppend := range valuesAppendStr {
+		appendValues = append(appendValues, valueAppend)
 	}
 
-	_, err = rh.JSONSet("testObj", ".", testObj)
+	_, err = rh.JSONSet("kstr", ".", "SimpleString")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
@@ -827,7 +2960,7 @@ func testJSONNumIncrBy(rh *Handler, t *testing.T) {
 	type args struct {
 		key    string
 		path   string
-		number int
+		values []interface{}
 	}
 	tests := []struct {
 		name    string
@@ -836,23 +2969,13 @@ func testJSONNumIncrBy(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "SimpleInt",
+			name: "SimpleArray",
 			args: args{
-				key:    "kint",
+				key:    "karr",
 				path:   ".",
-				number: 5,
-			},
-			wantRes: []byte("6"),
-			wantErr: false,
-		},
-		{
-			name: "SimpleStruct",
-			args: args{
-				key:    "testObj",
-				path:   ".number",
-				number: 5,
+				values: appendValues,
 			},
-			wantRes: []byte("6"),
+			wantRes: int64(3),
 			wantErr: false,
 		},
 		{
@@ -860,19 +2983,9 @@ func testJSONNumIncrBy(rh *Handler, t *testing.T) {
 			args: args{
 				key:    "kstr",
 				path:   ".",
-				number: 5,
-			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected a number but found string"),
-			wantErr: true,
-		},
-		{
-			name: "SimpleStructNotOK",
-			args: args{
-				key:    "testObj",
-				path:   ".",
-				number: 5,
+				values: appendValues,
 			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected a number but found object"),
+			wantRes: redigo.Error("ERR wrong type of path value - expected array but found string"),
 			wantErr: true,
 		},
 		{
@@ -890,47 +3003,39 @@ func testJSONNumIncrBy(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONNumIncrBy(tt.args.key, tt.args.path, tt.args.number)
+			gotRes, err := rh.JSONArrAppend(tt.args.key, tt.args.path, tt.args.values...)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONNumIncrBy() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONArrAppend() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONNumIncrBy() = %v, want %v", gotRes, tt.wantRes)
+				t.Errorf("JSONArrAppend() = %v, want %v", gotRes, tt.wantRes)
 			}
 		})
 	}
 }
 
-func testJSONNumMultBy(rh *Handler, t *testing.T) {
+func testJSONArrLen(rh *Handler, t *testing.T) {
 
-	_, err := rh.JSONSet("kint", ".", 2)
-	if err != nil {
-		t.Fatal("Failed to Set key ", err)
-		return
+	values := make([]interface{}, 0)
+	valuesStr := []string{"one", "two", "three"}
+	for _, value := range valuesStr {
+		values = append(values, value)
 	}
-
-	_, err = rh.JSONSet("kstr", ".", "simplestring")
+	_, err := rh.JSONSet("karr", ".", values)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
-	testObj := TestObject{
-		Name:   "Item#1",
-		Number: 2,
-	}
-
-	_, err = rh.JSONSet("testObj", ".", testObj)
+	_, err = rh.JSONSet("kstr", ".", "SimpleString")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
-
 	type args struct {
-		key    string
-		path   string
-		number int
+		key  string
+		path string
 	}
 	tests := []struct {
 		name    string
@@ -939,43 +3044,21 @@ func testJSONNumMultBy(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "SimpleInt",
-			args: args{
-				key:    "kint",
-				path:   ".",
-				number: 5,
-			},
-			wantRes: []byte("10"),
-			wantErr: false,
-		},
-		{
-			name: "SimpleStruct",
+			name: "SimpleArray",
 			args: args{
-				key:    "testObj",
-				path:   ".number",
-				number: 5,
+				key:  "karr",
+				path: ".",
 			},
-			wantRes: []byte("10"),
+			wantRes: int64(3),
 			wantErr: false,
 		},
 		{
-			name: "SimpleStringNotOK",
-			args: args{
-				key:    "kstr",
-				path:   ".",
-				number: 5,
-			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected a number but found string"),
-			wantErr: true,
-		},
-		{
-			name: "SimpleStructNotOK",
+			name: "SimpleString",
 			args: args{
-				key:    "testObj",
-				path:   ".",
-				number: 5,
+				key:  "kstr",
+				path: ".",
 			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected a number but found object"),
+			wantRes: redigo.Error("ERR wrong type of path value - expected array but found string"),
 			wantErr: true,
 		},
 		{
@@ -993,41 +3076,41 @@ func testJSONNumMultBy(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONNumMultBy(tt.args.key, tt.args.path, tt.args.number)
+			gotRes, err := rh.JSONArrLen(tt.args.key, tt.args.path)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONNumMultBy() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONArrLen() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONNumMultBy() = %v, want %v", gotRes, tt.wantRes)
+				t.Errorf("JSONArrLen() = %v, want %v", gotRes, tt.wantRes)
 			}
 		})
 	}
-}
-
-func testJSONStrAppend(rh *Handler, t *testing.T) {
-
-	_, err := rh.JSONSet("kstr", ".", "simplestring")
+}
+
+func testJSONArrPop(rh *Handler, t *testing.T) {
+
+	values := make([]interface{}, 0)
+	valuesStr := []string{"one", "two", "three", "four"}
+	for _, value := range valuesStr {
+		values = append(values, value)
+	}
+	_, err := rh.JSONSet("karr", ".", values)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
-	testObj := TestObject{
-		Name:   "Item#1",
-		Number: 1,
-	}
-
-	_, err = rh.JSONSet("testObj", ".", testObj)
+	_, err = rh.JSONSet("kstr", ".", "SimpleString")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
 	type args struct {
-		key        string
-		path       string
-		jsonstring string
+		key   string
+		path  string
+		index int
 	}
 	tests := []struct {
 		name    string
@@ -1036,33 +3119,33 @@ func testJSONStrAppend(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "SimpleString",
+			name: "SimpleArrayLastPop",
 			args: args{
-				key:        "kstr",
-				path:       ".",
-				jsonstring: "\"Appended\"",
+				key:   "karr",
+				path:  ".",
+				index: rjs.PopArrLast,
 			},
-			wantRes: int64(20),
+			wantRes: string("four"),
 			wantErr: false,
 		},
 		{
-			name: "SimpleStruct",
+			name: "SimpleArray2ndElementPop",
 			args: args{
-				key:        "testObj",
-				path:       "name",
-				jsonstring: "\"24\"",
+				key:   "karr",
+				path:  ".",
+				index: 1,
 			},
-			wantRes: int64(8),
+			wantRes: "two",
 			wantErr: false,
 		},
 		{
-			name: "SimpleStructNotOK",
+			name: "SimpleStringNotOK",
 			args: args{
-				key:        "testObj",
-				path:       "number",
-				jsonstring: "\"24\"",
+				key:   "kstr",
+				path:  ".",
+				index: rjs.PopArrLast,
 			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected string but found integer"),
+			wantRes: redigo.Error("ERR wrong type of path value - expected array but found string"),
 			wantErr: true,
 		},
 		{
@@ -1080,40 +3163,50 @@ func testJSONStrAppend(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONStrAppend(tt.args.key, tt.args.path, tt.args.jsonstring)
+			res, err := rh.JSONArrPop(tt.args.key, tt.args.path, tt.args.index)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONStrAppend() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONArrPop() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONStrAppend() = %v, want %t", gotRes, tt.wantRes)
+			if !tt.wantErr {
+				var gotRes interface{}
+				err = json.Unmarshal(res.([]byte), &gotRes)
+				if err != nil {
+					t.Errorf("JSONArrPop(): Failed to JSON Unmarshal")
+					return
+				}
+				if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
+					t.Errorf("JSONArrPop() = %v, want %v", gotRes, tt.wantRes)
+				}
 			}
 		})
 	}
 }
 
-func testJSONStrLen(rh *Handler, t *testing.T) {
+func testJSONArrIndex(rh *Handler, t *testing.T) {
 
-	_, err := rh.JSONSet("kstr", ".", "simplestring")
+	values := make([]interface{}, 0)
+	valuesStr := []string{"one", "two", "three"}
+	for _, value := range valuesStr {
+		values = append(values, value)
+	}
+	_, err := rh.JSONSet("karr", ".", values)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
-	testObj := TestObject{
-		Name:   "Item#1",
-		Number: 1,
-	}
-
-	_, err = rh.JSONSet("testObj", ".", testObj)
+	_, err = rh.JSONSet("kstr", ".", "SimpleString")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
 	type args struct {
-		key  string
-		path string
+		key           string
+		path          string
+		value         interface{}
+		optionalRange []int
 	}
 	tests := []struct {
 		name    string
@@ -1122,30 +3215,55 @@ func testJSONStrLen(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "SimpleString",
+			name: "SimpleArray",
 			args: args{
-				key:  "kstr",
-				path: ".",
+				key:   "karr",
+				path:  ".",
+				value: "two",
 			},
-			wantRes: int64(12),
+			wantRes: int64(1),
 			wantErr: false,
 		},
 		{
-			name: "SimpleStruct",
+			name: "SimpleArrayElementNotPresent",
 			args: args{
-				key:  "testObj",
-				path: "name",
+				key:   "karr",
+				path:  ".",
+				value: "ten",
 			},
-			wantRes: int64(6),
+			wantRes: int64(-1),
 			wantErr: false,
 		},
 		{
-			name: "SimpleStructNotOK",
+			name: "SimpleArrayElementOutOfRangeWithStart",
 			args: args{
-				key:  "testObj",
-				path: "number",
+				key:           "karr",
+				path:          ".",
+				value:         "two",
+				optionalRange: []int{2},
 			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected string but found integer"),
+			wantRes: int64(-1),
+			wantErr: false,
+		},
+		{
+			name: "SimpleArrayElementOutOfRange",
+			args: args{
+				key:           "karr",
+				path:          ".",
+				value:         "three",
+				optionalRange: []int{1, 5},
+			},
+			wantRes: int64(2),
+			wantErr: false,
+		},
+		{
+			name: "SimpleStringNotOK",
+			args: args{
+				key:   "kstr",
+				path:  ".",
+				value: "one",
+			},
+			wantRes: redigo.Error("ERR wrong type of path value - expected array but found string"),
 			wantErr: true,
 		},
 		{
@@ -1163,22 +3281,25 @@ func testJSONStrLen(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONStrLen(tt.args.key, tt.args.path)
+
+			gotRes, err := rh.JSONArrIndex(tt.args.key, tt.args.path, tt.args.value, tt.args.optionalRange...)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONStrLen() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONArrIndex() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONStrLen() = %v, want %v", gotRes, tt.wantRes)
+			if !tt.wantErr {
+				if !reflect.DeepEqual(gotRes.(int64), tt.wantRes.(int64)) {
+					t.Errorf("JSONArrIndex() = %v, want %v", gotRes, tt.wantRes)
+				}
 			}
 		})
 	}
 }
 
-func testJSONArrAppend(rh *Handler, t *testing.T) {
+func testJSONArrTrim(rh *Handler, t *testing.T) {
 
 	values := make([]interface{}, 0)
-	valuesStr := []string{"one"}
+	valuesStr := []string{"one", "two", "three", "four"}
 	for _, value := range valuesStr {
 		values = append(values, value)
 	}
@@ -1187,11 +3308,6 @@ func testJSONArrAppend(rh *Handler, t *testing.T) {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
-	appendValues := make([]interface{}, 0)
-	valuesAppendStr := []string{"two", "three"}
-	for _, valueAppend := range valuesAppendStr {
-		appendValues = append(appendValues, valueAppend)
-	}
 
 	_, err = rh.JSONSet("kstr", ".", "SimpleString")
 	if err != nil {
@@ -1200,9 +3316,10 @@ func testJSONArrAppend(rh *Handler, t *testing.T) {
 	}
 
 	type args struct {
-		key    string
-		path   string
-		values []interface{}
+		key   string
+		path  string
+		start int
+		end   int
 	}
 	tests := []struct {
 		name    string
@@ -1213,19 +3330,21 @@ func testJSONArrAppend(rh *Handler, t *testing.T) {
 		{
 			name: "SimpleArray",
 			args: args{
-				key:    "karr",
-				path:   ".",
-				values: appendValues,
+				key:   "karr",
+				path:  ".",
+				start: 1,
+				end:   2,
 			},
-			wantRes: int64(3),
+			wantRes: int64(2),
 			wantErr: false,
 		},
 		{
 			name: "SimpleStringNotOK",
 			args: args{
-				key:    "kstr",
-				path:   ".",
-				values: appendValues,
+				key:   "kstr",
+				path:  ".",
+				start: 1,
+				end:   2,
 			},
 			wantRes: redigo.Error("ERR wrong type of path value - expected array but found string"),
 			wantErr: true,
@@ -1245,22 +3364,24 @@ func testJSONArrAppend(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONArrAppend(tt.args.key, tt.args.path, tt.args.values...)
+
+			gotRes, err := rh.JSONArrTrim(tt.args.key, tt.args.path, tt.args.start, tt.args.end)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONArrAppend() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONArrTrim() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONArrAppend() = %v, want %v", gotRes, tt.wantRes)
+				t.Errorf("JSONArrTrim() = %v, want %v", gotRes, tt.wantRes)
 			}
+
 		})
 	}
 }
 
-func testJSONArrLen(rh *Handler, t *testing.T) {
+func testJSONArrInsert(rh *Handler, t *testing.T) {
 
 	values := make([]interface{}, 0)
-	valuesStr := []string{"one", "two", "three"}
+	valuesStr := []string{"three"}
 	for _, value := range valuesStr {
 		values = append(values, value)
 	}
@@ -1269,36 +3390,60 @@ func testJSONArrLen(rh *Handler, t *testing.T) {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
+	insertValues := make([]interface{}, 0)
+	valuesInsertStr := []string{"one", "two"}
+	for _, valueAppend := range valuesInsertStr {
+		insertValues = append(insertValues, valueAppend)
+	}
+
+	finalStrSlice := make([]string, 0, 4)
+	finalStrSlice = append(finalStrSlice, valuesInsertStr...)
+	finalStrSlice = append(finalStrSlice, valuesStr...)
 
 	_, err = rh.JSONSet("kstr", ".", "SimpleString")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
+
+	fssM, err := json.Marshal(finalStrSlice)
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
 	type args struct {
-		key  string
-		path string
+		key    string
+		path   string
+		index  int
+		values []interface{}
 	}
 	tests := []struct {
-		name    string
-		args    args
-		wantRes interface{}
-		wantErr bool
+		name          string
+		args          args
+		wantRes       interface{}
+		wantErr       bool
+		finalSliceGot []byte
 	}{
 		{
 			name: "SimpleArray",
 			args: args{
-				key:  "karr",
-				path: ".",
+				key:    "karr",
+				path:   ".",
+				index:  0,
+				values: insertValues,
 			},
-			wantRes: int64(3),
-			wantErr: false,
+			wantRes:       int64(3),
+			wantErr:       false,
+			finalSliceGot: fssM,
 		},
 		{
-			name: "SimpleString",
+			name: "SimpleStringNotOK",
 			args: args{
-				key:  "kstr",
-				path: ".",
+				key:    "kstr",
+				path:   ".",
+				index:  0,
+				values: insertValues,
 			},
 			wantRes: redigo.Error("ERR wrong type of path value - expected array but found string"),
 			wantErr: true,
@@ -1318,41 +3463,52 @@ func testJSONArrLen(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONArrLen(tt.args.key, tt.args.path)
+			gotRes, err := rh.JSONArrInsert(tt.args.key, tt.args.path, tt.args.index, tt.args.values...)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONArrLen() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONArrInsert() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONArrLen() = %v, want %v", gotRes, tt.wantRes)
+				t.Errorf("JSONArrInsert() = %v, want %v", gotRes, tt.wantRes)
+				return
+			}
+
+			if !tt.wantErr {
+				newArr, err := rh.JSONGet(tt.args.key, tt.args.path)
+				if err != nil {
+					t.Errorf("JSONArrGet(): Failed to JSONGet")
+					return
+				}
+				if !reflect.DeepEqual(newArr.([]byte), tt.finalSliceGot) {
+					t.Errorf("JSONArrGet() = %v, want %v", newArr.([]byte), tt.finalSliceGot)
+				}
 			}
 		})
 	}
 }
 
-func testJSONArrPop(rh *Handler, t *testing.T) {
+func testJSONObjLen(rh *Handler, t *testing.T) {
 
-	values := make([]interface{}, 0)
-	valuesStr := []string{"one", "two", "three", "four"}
-	for _, value := range valuesStr {
-		values = append(values, value)
+	type Object struct {
+		Name      string `json:"name"`
+		LastSeen  int64  `json:"lastSeen"`
+		LoggedOut bool   `json:"loggedOut"`
 	}
-	_, err := rh.JSONSet("karr", ".", values)
+	obj := Object{"Leonard Cohen", 1478476800, true}
+	_, err := rh.JSONSet("tobj", ".", obj)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
-	_, err = rh.JSONSet("kstr", ".", "SimpleString")
+	_, err = rh.JSONSet("tstr", ".", "SimpleString")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
-
 	type args struct {
-		key   string
-		path  string
-		index int
+		key  string
+		path string
 	}
 	tests := []struct {
 		name    string
@@ -1361,33 +3517,21 @@ func testJSONArrPop(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "SimpleArrayLastPop",
-			args: args{
-				key:   "karr",
-				path:  ".",
-				index: rjs.PopArrLast,
-			},
-			wantRes: string("four"),
-			wantErr: false,
-		},
-		{
-			name: "SimpleArray2ndElementPop",
+			name: "SimpleObject",
 			args: args{
-				key:   "karr",
-				path:  ".",
-				index: 1,
+				key:  "tobj",
+				path: ".",
 			},
-			wantRes: "two",
+			wantRes: int64(3),
 			wantErr: false,
 		},
 		{
-			name: "SimpleStringNotOK",
+			name: "SimpleString",
 			args: args{
-				key:   "kstr",
-				path:  ".",
-				index: rjs.PopArrLast,
+				key:  "tstr",
+				path: ".",
 			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected array but found string"),
+			wantRes: redigo.Error("ERR wrong type of path value - expected object but found string"),
 			wantErr: true,
 		},
 		{
@@ -1405,50 +3549,40 @@ func testJSONArrPop(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			res, err := rh.JSONArrPop(tt.args.key, tt.args.path, tt.args.index)
+			gotRes, err := rh.JSONObjLen(tt.args.key, tt.args.path)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONArrPop() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONObjLen() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !tt.wantErr {
-				var gotRes interface{}
-				err = json.Unmarshal(res.([]byte), &gotRes)
-				if err != nil {
-					t.Errorf("JSONArrPop(): Failed to JSON Unmarshal")
-					return
-				}
-				if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-					t.Errorf("JSONArrPop() = %v, want %v", gotRes, tt.wantRes)
-				}
+			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
+				t.Errorf("JSONObjLen() = %v, want %v", gotRes, tt.wantRes)
 			}
 		})
 	}
 }
 
-func testJSONArrIndex(rh *Handler, t *testing.T) {
+func testJSONObjKeys(rh *Handler, t *testing.T) {
 
-	values := make([]interface{}, 0)
-	valuesStr := []string{"one", "two", "three"}
-	for _, value := range valuesStr {
-		values = append(values, value)
+	type Object struct {
+		Name      string `json:"name"`
+		LastSeen  int64  `json:"lastSeen"`
+		LoggedOut bool   `json:"loggedOut"`
 	}
-	_, err := rh.JSONSet("karr", ".", values)
+	obj := Object{"Leonard Cohen", 1478476800, true}
+	_, err := rh.JSONSet("tobj", ".", obj)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
-	_, err = rh.JSONSet("kstr", ".", "SimpleString")
+	_, err = rh.JSONSet("tstr", ".", "SimpleString")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
-
 	type args struct {
-		key           string
-		path          string
-		value         interface{}
-		optionalRange []int
+		key  string
+		path string
 	}
 	tests := []struct {
 		name    string
@@ -1457,55 +3591,21 @@ func testJSONArrIndex(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "SimpleArray",
-			args: args{
-				key:   "karr",
-				path:  ".",
-				value: "two",
-			},
-			wantRes: int64(1),
-			wantErr: false,
-		},
-		{
-			name: "SimpleArrayElementNotPresent",
-			args: args{
-				key:   "karr",
-				path:  ".",
-				value: "ten",
-			},
-			wantRes: int64(-1),
-			wantErr: false,
-		},
-		{
-			name: "SimpleArrayElementOutOfRangeWithStart",
-			args: args{
-				key:           "karr",
-				path:          ".",
-				value:         "two",
-				optionalRange: []int{2},
-			},
-			wantRes: int64(-1),
-			wantErr: false,
-		},
-		{
-			name: "SimpleArrayElementOutOfRange",
+			name: "SimpleObject",
 			args: args{
-				key:           "karr",
-				path:          ".",
-				value:         "three",
-				optionalRange: []int{1, 5},
+				key:  "tobj",
+				path: ".",
 			},
-			wantRes: int64(2),
+			wantRes: []string{"name", "lastSeen", "loggedOut"},
 			wantErr: false,
 		},
 		{
-			name: "SimpleStringNotOK",
+			name: "SimpleString",
 			args: args{
-				key:   "kstr",
-				path:  ".",
-				value: "one",
+				key:  "tstr",
+				path: ".",
 			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected array but found string"),
+			wantRes: redigo.Error("ERR wrong type of path value - expected object but found string"),
 			wantErr: true,
 		},
 		{
@@ -1523,45 +3623,29 @@ func testJSONArrIndex(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-
-			gotRes, err := rh.JSONArrIndex(tt.args.key, tt.args.path, tt.args.value, tt.args.optionalRange...)
+			gotRes, err := rh.JSONObjKeys(tt.args.key, tt.args.path)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONArrIndex() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONObjKeys() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !tt.wantErr {
-				if !reflect.DeepEqual(gotRes.(int64), tt.wantRes.(int64)) {
-					t.Errorf("JSONArrIndex() = %v, want %v", gotRes, tt.wantRes)
-				}
+			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
+				t.Errorf("JSONObjKeys() = %v, want %v", gotRes, tt.wantRes)
 			}
 		})
 	}
 }
 
-func testJSONArrTrim(rh *Handler, t *testing.T) {
-
-	values := make([]interface{}, 0)
-	valuesStr := []string{"one", "two", "three", "four"}
-	for _, value := range valuesStr {
-		values = append(values, value)
-	}
-	_, err := rh.JSONSet("karr", ".", values)
-	if err != nil {
-		t.Fatal("Failed to Set key ", err)
-		return
-	}
-
-	_, err = rh.JSONSet("kstr", ".", "SimpleString")
+func testJSONDebug(rh *Handler, t *testing.T) {
+	t.Skip("JSON.DEBUG apparently has some open bugs")
+	_, err := rh.JSONSet("tstr", ".", "SimpleString")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
-
 	type args struct {
-		key   string
-		path  string
-		start int
-		end   int
+		subCommand rjs.DebugSubCommand
+		key        string
+		path       string
 	}
 	tests := []struct {
 		name    string
@@ -1570,26 +3654,24 @@ func testJSONArrTrim(rh *Handler, t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "SimpleArray",
+			name: "Debug Help",
 			args: args{
-				key:   "karr",
-				path:  ".",
-				start: 1,
-				end:   2,
+				subCommand: rjs.DebugHelpSubcommand,
+				key:        "tstr",
+				path:       ".",
 			},
-			wantRes: int64(2),
+			wantRes: rjs.DebugHelpOutput,
 			wantErr: false,
 		},
 		{
-			name: "SimpleStringNotOK",
+			name: "Debug Memory",
 			args: args{
-				key:   "kstr",
-				path:  ".",
-				start: 1,
-				end:   2,
+				subCommand: rjs.DebugMemorySubcommand,
+				key:        "tstr",
+				path:       ".",
 			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected array but found string"),
-			wantErr: true,
+			wantRes: int64(8),
+			wantErr: false,
 		},
 		{
 			name: rjs.ClientInactive,
@@ -1606,89 +3688,82 @@ func testJSONArrTrim(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-
-			gotRes, err := rh.JSONArrTrim(tt.args.key, tt.args.path, tt.args.start, tt.args.end)
+			gotRes, err := rh.JSONDebug(tt.args.subCommand, tt.args.key, tt.args.path)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONArrTrim() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONDebug() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONArrTrim() = %v, want %v", gotRes, tt.wantRes)
+				t.Errorf("JSONDebug() = %v, want %v", gotRes, tt.wantRes)
 			}
-
 		})
 	}
 }
 
-func testJSONArrInsert(rh *Handler, t *testing.T) {
+func testJSONForget(rh *Handler, t *testing.T) {
 
-	values := make([]interface{}, 0)
-	valuesStr := []string{"three"}
-	for _, value := range valuesStr {
-		values = append(values, value)
-	}
-	_, err := rh.JSONSet("karr", ".", values)
+	_, err := rh.JSONSet("kstr", ".", "simplestring")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
-	insertValues := make([]interface{}, 0)
-	valuesInsertStr := []string{"one", "two"}
-	for _, valueAppend := range valuesInsertStr {
-		insertValues = append(insertValues, valueAppend)
-	}
-
-	finalStrSlice := make([]string, 0, 4)
-	finalStrSlice = append(finalStrSlice, valuesInsertStr...)
-	finalStrSlice = append(finalStrSlice, valuesStr...)
 
-	_, err = rh.JSONSet("kstr", ".", "SimpleString")
-	if err != nil {
-		t.Fatal("Failed to Set key ", err)
-		return
+	testObj := TestObject{
+		Name:   "Item#1",
+		Number: 1,
 	}
 
-	fssM, err := json.Marshal(finalStrSlice)
+	_, err = rh.JSONSet("kstruct", ".", testObj)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
 	type args struct {
-		key    string
-		path   string
-		index  int
-		values []interface{}
+		key  string
+		path string
 	}
 	tests := []struct {
-		name          string
-		args          args
-		wantRes       interface{}
-		wantErr       bool
-		finalSliceGot []byte
+		name    string
+		args    args
+		wantRes interface{}
+		wantErr bool
 	}{
 		{
-			name: "SimpleArray",
+			name: "SimpleString",
+			args: args{
+				key:  "kstr",
+				path: ".",
+			},
+			wantRes: int64(1),
+			wantErr: false,
+		},
+		{
+			name: "SimpleStructFieldOK",
 			args: args{
-				key:    "karr",
-				path:   ".",
-				index:  0,
-				values: insertValues,
+				key:  "kstruct",
+				path: "name",
 			},
-			wantRes:       int64(3),
-			wantErr:       false,
-			finalSliceGot: fssM,
+			wantRes: int64(1),
+			wantErr: false,
 		},
 		{
-			name: "SimpleStringNotOK",
+			name: "SimpleStructFieldNotOK",
 			args: args{
-				key:    "kstr",
-				path:   ".",
-				index:  0,
-				values: insertValues,
+				key:  "kstruct",
+				path: "foobar",
 			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected array but found string"),
-			wantErr: true,
+			wantRes: int64(0),
+			wantErr: false,
+		},
+		{
+			name: "SimpleStruct",
+			args: args{
+				key:  "kstruct",
+				path: ".",
+			},
+			wantRes: int64(1),
+			wantErr: false,
 		},
 		{
 			name: rjs.ClientInactive,
@@ -1705,45 +3780,21 @@ func testJSONArrInsert(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONArrInsert(tt.args.key, tt.args.path, tt.args.index, tt.args.values...)
+			gotRes, err := rh.JSONForget(tt.args.key, tt.args.path)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONArrInsert() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONForget() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONArrInsert() = %v, want %v", gotRes, tt.wantRes)
-				return
-			}
-
-			if !tt.wantErr {
-				newArr, err := rh.JSONGet(tt.args.key, tt.args.path)
-				if err != nil {
-					t.Errorf("JSONArrGet(): Failed to JSONGet")
-					return
-				}
-				if !reflect.DeepEqual(newArr.([]byte), tt.finalSliceGot) {
-					t.Errorf("JSONArrGet() = %v, want %v", newArr.([]byte), tt.finalSliceGot)
-				}
+				t.Errorf("JSONForget() = %t, want %t", gotRes, tt.wantRes)
 			}
 		})
 	}
 }
 
-func testJSONObjLen(rh *Handler, t *testing.T) {
-
-	type Object struct {
-		Name      string `json:"name"`
-		LastSeen  int64  `json:"lastSeen"`
-		LoggedOut bool   `json:"loggedOut"`
-	}
-	obj := Object{"Leonard Cohen", 1478476800, true}
-	_, err := rh.JSONSet("tobj", ".", obj)
-	if err != nil {
-		t.Fatal("Failed to Set key ", err)
-		return
-	}
+func testJSONResp(rh *Handler, t *testing.T) {
 
-	_, err = rh.JSONSet("tstr", ".", "SimpleString")
+	_, err := rh.JSONSet("tstr", ".", "SimpleString")
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
@@ -1755,26 +3806,15 @@ func testJSONObjLen(rh *Handler, t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		wantRes interface{}
 		wantErr bool
 	}{
 		{
-			name: "SimpleObject",
-			args: args{
-				key:  "tobj",
-				path: ".",
-			},
-			wantRes: int64(3),
-			wantErr: false,
-		},
-		{
-			name: "SimpleString",
+			name: "RESP",
 			args: args{
 				key:  "tstr",
 				path: ".",
 			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected object but found string"),
-			wantErr: true,
+			wantErr: false,
 		},
 		{
 			name: rjs.ClientInactive,
@@ -1782,7 +3822,6 @@ func testJSONObjLen(rh *Handler, t *testing.T) {
 				key:  "active",
 				path: ".",
 			},
-			wantRes: nil,
 			wantErr: true,
 		},
 	}
@@ -1791,292 +3830,686 @@ func testJSONObjLen(rh *Handler, t *testing.T) {
 			if tt.name == rjs.ClientInactive {
 				rh.SetClientInactive()
 			}
-			gotRes, err := rh.JSONObjLen(tt.args.key, tt.args.path)
+			_, err := rh.JSONResp(tt.args.key, tt.args.path)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONObjLen() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("JSONResp() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONObjLen() = %v, want %v", gotRes, tt.wantRes)
-			}
 		})
 	}
 }
 
-func testJSONObjKeys(rh *Handler, t *testing.T) {
+func testJSONLargeNumbers(rh *Handler, t *testing.T) {
+	type Account struct {
+		ID      json.Number `json:"id"`
+		Balance *big.Int    `json:"balance"`
+	}
+	balance, _ := new(big.Int).SetString("9007199254740993", 10)
+	account := Account{ID: "9223372036854775807", Balance: balance}
 
-	type Object struct {
-		Name      string `json:"name"`
-		LastSeen  int64  `json:"lastSeen"`
-		LoggedOut bool   `json:"loggedOut"`
+	_, err := rh.JSONSet("kaccount", ".", account)
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
 	}
-	obj := Object{"Leonard Cohen", 1478476800, true}
-	_, err := rh.JSONSet("tobj", ".", obj)
+
+	var got Account
+	if err := rh.JSONGetInto("kaccount", ".", &got); err != nil {
+		t.Fatalf("JSONGetInto() error = %v", err)
+	}
+	if got.ID != account.ID || got.Balance.Cmp(account.Balance) != 0 {
+		t.Errorf("JSONGetInto() = %v, want %v", got, account)
+	}
+
+	res, err := rh.JSONNumIncrByNumber("kaccount", "balance", json.Number("1"))
+	if err != nil {
+		t.Fatalf("JSONNumIncrByNumber() error = %v", err)
+	}
+	incr := new(big.Int)
+	if err := rjs.Unmarshal(res, incr); err != nil || incr.String() != "9007199254740994" {
+		t.Errorf("JSONNumIncrByNumber() = %v %v, want 9007199254740994", incr, err)
+	}
+
+	var doc interface{}
+	if err := rh.JSONGetInto("kaccount", ".", &doc); err != nil {
+		t.Fatalf("JSONGetInto() error = %v", err)
+	}
+	if id := doc.(map[string]interface{})["id"]; id != json.Number("9223372036854775807") {
+		t.Errorf("JSONGetInto() id = %#v, want json.Number(9223372036854775807)", id)
+	}
+
+	// a nested *big.Float would be stored as a string, it round-trips as json.Number
+	rate, _, _ := big.ParseFloat("0.03125", 10, 64, big.ToNearestEven)
+	if _, err := rh.JSONSet("krate", ".", struct {
+		Rate *big.Float `json:"rate"`
+	}{rate}); !errors.Is(err, rjs.ErrInvalidNumber) {
+		t.Errorf("JSONSet() of a nested *big.Float error = %v, want %v", err, rjs.ErrInvalidNumber)
+	}
+	if _, err := rh.JSONSet("krate", ".", struct {
+		Rate json.Number `json:"rate"`
+	}{json.Number(rate.Text('g', -1))}); err != nil {
+		t.Fatal("Failed to Set key ", err)
+	}
+	res, err = rh.JSONGet("krate", "rate")
+	if err != nil {
+		t.Fatalf("JSONGet() error = %v", err)
+	}
+	gotRate := new(big.Float).SetPrec(rate.Prec())
+	if err := rjs.Unmarshal(res, gotRate); err != nil || gotRate.Cmp(rate) != 0 {
+		t.Errorf("JSONGet() rate = %v %v, want %v", gotRate, err, rate)
+	}
+}
+
+func testJSONGetStream(rh *Handler, t *testing.T) {
+	skipIfNoJSONPath(rh, t)
+	items := make([]TestObject, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		items = append(items, TestObject{Name: fmt.Sprintf("item#%d", i), Number: i})
+	}
+	_, err := rh.JSONSet("kitems", ".", items)
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
-	_, err = rh.JSONSet("tstr", ".", "SimpleString")
+	i := 0
+	err = rh.JSONGetStream("kitems", ".", func(dec *json.Decoder) error {
+		var item TestObject
+		if err := dec.Decode(&item); err != nil {
+			return err
+		}
+		if item != items[i] {
+			t.Errorf("JSONGetStream() element %d = %v, want %v", i, item, items[i])
+		}
+		i++
+		return nil
+	}, ArrayIteratorOptions{PageSize: 64})
+	if err != nil || i != len(items) {
+		t.Errorf("JSONGetStream() streamed %d elements, err = %v, want %d", i, err, len(items))
+	}
+
+	_, err = rh.JSONSet("kstruct", ".", items[0])
 	if err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
-	type args struct {
-		key  string
-		path string
+	err = rh.JSONGetStream("kstruct", ".", func(dec *json.Decoder) error { return nil }, ArrayIteratorOptions{})
+	if err == nil {
+		t.Errorf("JSONGetStream() on an object returned nil error")
+	}
+	err = rh.JSONGetStream("kitems:missing", ".", func(dec *json.Decoder) error { return nil }, ArrayIteratorOptions{})
+	if err == nil {
+		t.Errorf("JSONGetStream() of a missing key returned nil error")
+	}
+}
+
+// skipIfNoJSONPath skips tests relying on JSONPath ($) syntax, which is only
+// supported from RedisJSON 2.0
+func skipIfNoJSONPath(rh *Handler, t *testing.T) {
+	if _, err := rh.JSONSet("kjsonpath", "$", 1); err != nil {
+		t.Skipf("JSONPath not supported by the server: %v", err)
+	}
+}
+
+func testArrayIterator(rh *Handler, t *testing.T) {
+	skipIfNoJSONPath(rh, t)
+
+	items := make([]TestObject, 0, 1234)
+	for i := 0; i < 1234; i++ {
+		items = append(items, TestObject{Name: fmt.Sprintf("item#%d", i), Number: i})
+	}
+	_, err := rh.JSONSet("kdoc", ".", map[string]interface{}{"items": items})
+	if err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+
+	for _, opts := range []ArrayIteratorOptions{{}, {PageSize: 100}, {PageSize: 7, Prefetch: true}} {
+		t.Run(fmt.Sprintf("PageSize%dPrefetch%v", opts.PageSize, opts.Prefetch), func(t *testing.T) {
+			it := rh.ArrayIterator("kdoc", ".items", opts)
+			n := 0
+			for it.Next() {
+				var item TestObject
+				if err := it.Decode(&item); err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				if it.Index() != n || item != items[n] {
+					t.Errorf("ArrayIterator() element %d = %v, want %v", it.Index(), item, items[n])
+				}
+				n++
+			}
+			if it.Err() != nil || n != len(items) {
+				t.Errorf("ArrayIterator() iterated %d elements, err = %v, want %d", n, it.Err(), len(items))
+			}
+		})
+	}
+
+	t.Run("ArrayShrinks", func(t *testing.T) {
+		it := rh.ArrayIterator("kdoc", "$.items", ArrayIteratorOptions{PageSize: 10})
+		n := 0
+		for it.Next() {
+			n++
+			if n == 5 {
+				if _, err := rh.JSONArrTrim("kdoc", ".items", 0, 14); err != nil {
+					t.Fatalf("JSONArrTrim() error = %v", err)
+				}
+			}
+		}
+		if it.Err() != nil || n != 15 {
+			t.Errorf("ArrayIterator() iterated %d elements, err = %v, want 15", n, it.Err())
+		}
+	})
+
+	t.Run("NotAnArray", func(t *testing.T) {
+		it := rh.ArrayIterator("kdoc", ".", ArrayIteratorOptions{})
+		if it.Next() || it.Err() == nil {
+			t.Errorf("ArrayIterator() on an object returned no error")
+		}
+	})
+}
+
+func testScanJSON(rh *Handler, t *testing.T) {
+	want := make([]string, 0, 50)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("scan:user:%d", i)
+		if _, err := rh.JSONSet(key, ".", TestObject{Name: key, Number: i}); err != nil {
+			t.Fatal("Failed to Set key ", err)
+			return
+		}
+		want = append(want, key)
+	}
+	if _, err := rh.JSONSet("scan:other", ".", "other"); err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+	sort.Strings(want)
+
+	it := rh.ScanJSON("scan:user:*", ScanOptions{Count: 7})
+	if it.Next() == false && it.Err() != nil {
+		t.Skipf("SCAN ... TYPE not supported by the server: %v", it.Err())
+	}
+
+	t.Run("Keys", func(t *testing.T) {
+		seen := map[string]bool{}
+		it := rh.ScanJSON("scan:user:*", ScanOptions{Count: 7})
+		for it.Next() {
+			seen[it.Key()] = true
+		}
+		if it.Err() != nil {
+			t.Fatalf("ScanJSON() error = %v", it.Err())
+		}
+		got := make([]string, 0, len(seen))
+		for key := range seen {
+			got = append(got, key)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ScanJSON() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Documents", func(t *testing.T) {
+		n := 0
+		it := rh.ScanJSON("scan:user:*", ScanOptions{WithDocuments: true})
+		for it.Next() {
+			var obj TestObject
+			if err := it.Decode(&obj); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if obj.Name != it.Key() {
+				t.Errorf("ScanJSON() document = %v, want name %v", obj, it.Key())
+			}
+			n++
+		}
+		if it.Err() != nil || n < len(want) {
+			t.Errorf("ScanJSON() scanned %d documents, err = %v, want %d", n, it.Err(), len(want))
+		}
+	})
+
+	t.Run("DocumentPath", func(t *testing.T) {
+		it := rh.ScanJSON("scan:user:1", ScanOptions{WithDocuments: true, Path: "name"})
+		if !it.Next() {
+			t.Fatalf("ScanJSON() found no key, err = %v", it.Err())
+		}
+		var name string
+		if err := it.Decode(&name); err != nil || name != "scan:user:1" {
+			t.Errorf("ScanJSON() document = %v %v, want scan:user:1", name, err)
+		}
+	})
+}
+
+func testJSONMGetSlotValidation(rh *Handler, t *testing.T) {
+	rh.SetSlotValidation(true)
+	defer rh.SetSlotValidation(false)
+
+	kb := rjs.NewKeyBuilder("order:1")
+	for i, key := range []string{kb.Key("items"), kb.Key("customer")} {
+		if _, err := rh.JSONSet(key, ".", i); err != nil {
+			t.Fatal("Failed to Set key ", err)
+			return
+		}
+	}
+
+	got, err := rh.JSONMGet(".", kb.Key("items"), kb.Key("customer"))
+	want := []interface{}{[]byte("0"), []byte("1")}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONMGet() = %v %v, want %v", got, err, want)
+	}
+
+	_, err = rh.JSONMGet(".", kb.Key("items"), "foo")
+	if !errors.Is(err, rjs.ErrCrossSlot) {
+		t.Errorf("JSONMGet() error = %v, want ErrCrossSlot", err)
+	}
+}
+
+func testJSONGetCache(rh *Handler, t *testing.T) {
+	if err := rh.EnableCache(CacheOptions{TTL: time.Minute}); err != nil {
+		t.Fatalf("EnableCache() error = %v", err)
+	}
+	defer rh.DisableCache()
+
+	check := func(path, want string) {
+		t.Helper()
+		got, err := rh.JSONGet("kcache", path)
+		if err != nil || string(got.([]byte)) != want {
+			t.Errorf("JSONGet(%v) = %s %v, want %v", path, got, err, want)
+		}
+	}
+
+	if _, err := rh.JSONSet("kcache", ".", TestObject{Name: "item", Number: 1}); err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+	check(".", `{"name":"item","number":1}`)
+	check("number", "1")
+
+	if _, err := rh.JSONNumIncrBy("kcache", "number", 1); err != nil {
+		t.Fatal("Failed to increment ", err)
+	}
+	check("number", "2")
+	check(".", `{"name":"item","number":2}`)
+
+	if _, err := rh.JSONDel("kcache", "."); err != nil {
+		t.Fatal("Failed to Del key ", err)
+	}
+	if got, err := rh.JSONGet("kcache", "."); err == nil && got != nil {
+		t.Errorf("JSONGet() = %s, want no reply after JSONDel", got)
+	}
+}
+
+func testWithPrefix(rh *Handler, t *testing.T) {
+	tenant := rh.WithPrefix("tenant42:")
+	for i := 0; i < 3; i++ {
+		if _, err := tenant.JSONSet(fmt.Sprintf("pfx:%d", i), ".", i); err != nil {
+			t.Fatal("Failed to Set key ", err)
+			return
+		}
+	}
+
+	got, err := rh.JSONGet("tenant42:pfx:1", ".")
+	if err != nil || !reflect.DeepEqual(got, []byte("1")) {
+		t.Errorf("JSONGet() = %s %v, want the key set through the prefixed handler", got, err)
+	}
+	got, err = tenant.JSONMGet(".", "pfx:0", "pfx:2")
+	if want := []interface{}{[]byte("0"), []byte("2")}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONMGet() = %v %v, want %v", got, err, want)
+	}
+
+	it := tenant.ScanJSON("pfx:*", ScanOptions{WithDocuments: true})
+	if it.Next() == false && it.Err() != nil {
+		t.Skipf("SCAN ... TYPE not supported by the server: %v", it.Err())
+	}
+	it = tenant.ScanJSON("pfx:*", ScanOptions{WithDocuments: true})
+	seen := map[string]string{}
+	for it.Next() {
+		seen[it.Key()] = string(it.Document().([]byte))
+	}
+	want := map[string]string{"pfx:0": "0", "pfx:1": "1", "pfx:2": "2"}
+	if it.Err() != nil || !reflect.DeepEqual(seen, want) {
+		t.Errorf("ScanJSON() = %v %v, want %v", seen, it.Err(), want)
+	}
+}
+
+// pttl returns the remaining time to live of key in milliseconds
+func pttl(rh *Handler, t *testing.T, key string) int64 {
+	t.Helper()
+	res, err := eval(rh.active().impl, rjs.NewScript("PTTL", "return redis.call('PTTL', KEYS[1])"), []string{key})
+	if err != nil {
+		t.Fatalf("PTTL error = %v", err)
+	}
+	return res.(int64)
+}
+
+func testJSONSetWithTTL(rh *Handler, t *testing.T) {
+	res, err := rh.JSONSetWithTTL("kttl", ".", TestObject{Name: "item"}, rjs.TTLOptionEX(time.Minute))
+	if err != nil || res != "OK" {
+		t.Fatalf("JSONSetWithTTL() = %v %v, want OK", res, err)
+	}
+	if ttl := pttl(rh, t, "kttl"); ttl <= 50000 || ttl > 60000 {
+		t.Errorf("PTTL = %v, want about a minute", ttl)
+	}
+
+	res, err = rh.JSONSetWithTTL("kttl", "name", "other", rjs.TTLOptionKEEPTTL)
+	if err != nil || res != "OK" {
+		t.Fatalf("JSONSetWithTTL() = %v %v, want OK", res, err)
+	}
+	if ttl := pttl(rh, t, "kttl"); ttl <= 50000 || ttl > 60000 {
+		t.Errorf("PTTL = %v after KEEPTTL, want about a minute", ttl)
+	}
+
+	res, err = rh.JSONSetWithTTL("kttl", ".", 1, rjs.TTLOptionPX(1500*time.Millisecond), rjs.SetOptionNX)
+	if err != nil || res != nil {
+		t.Errorf("JSONSetWithTTL(NX) = %v %v, want no reply for an existing key", res, err)
+	}
+	if ttl := pttl(rh, t, "kttl"); ttl <= 50000 {
+		t.Errorf("PTTL = %v, want the expiry untouched when NX fails", ttl)
+	}
+
+	res, err = rh.JSONSetWithTTL("kttl", ".", 1, rjs.TTLOptionPX(1500*time.Millisecond), rjs.SetOptionXX)
+	if err != nil || res != "OK" {
+		t.Fatalf("JSONSetWithTTL(XX) = %v %v, want OK", res, err)
+	}
+	if ttl := pttl(rh, t, "kttl"); ttl <= 0 || ttl > 1500 {
+		t.Errorf("PTTL = %v, want at most 1500", ttl)
+	}
+
+	if _, err = rh.JSONSetWithTTL("kttl", ".", 1, rjs.TTLOptionEX(time.Millisecond)); err != rjs.ErrInvalidTTL {
+		t.Errorf("JSONSetWithTTL() error = %v, want ErrInvalidTTL for a ttl under a second", err)
+	}
+}
+
+func testScripts(rh *Handler, t *testing.T) {
+	if err := rh.LoadScripts(); err != nil {
+		t.Fatalf("LoadScripts() error = %v", err)
+	}
+
+	if _, err := rh.JSONSet("kscript", ".", TestObject{Name: "item", Number: 1}); err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
+	}
+	res, err := rh.JSONNumIncrByGet("kscript", "number", 2)
+	want := []byte(`{"name":"item","number":3}`)
+	if err != nil || !reflect.DeepEqual(res, want) {
+		t.Errorf("JSONNumIncrByGet() = %s %v, want %s", res, err, want)
+	}
+	if _, err = rh.JSONNumIncrByGet("kscript", "name", 2); err == nil {
+		t.Errorf("JSONNumIncrByGet() error = nil, want an error for a string")
+	}
+}
+
+func testJSONSetIf(rh *Handler, t *testing.T) {
+	order := map[string]interface{}{
+		"status": "packed",
+		"items":  []map[string]interface{}{{"sku": "a", "qty": 1}},
+		"id":     json.Number("9007199254740993"),
+		"tags":   []string{},
+	}
+	if _, err := rh.JSONSet("korder", ".", order); err != nil {
+		t.Fatal("Failed to Set key ", err)
+		return
 	}
+
 	tests := []struct {
-		name    string
-		args    args
-		wantRes interface{}
-		wantErr bool
+		name     string
+		key      string
+		path     string
+		expected interface{}
+		newValue interface{}
+		want     bool
+		wantDoc  string
 	}{
-		{
-			name: "SimpleObject",
-			args: args{
-				key:  "tobj",
-				path: ".",
-			},
-			wantRes: []string{"name", "lastSeen", "loggedOut"},
-			wantErr: false,
-		},
-		{
-			name: "SimpleString",
-			args: args{
-				key:  "tstr",
-				path: ".",
-			},
-			wantRes: redigo.Error("ERR wrong type of path value - expected object but found string"),
-			wantErr: true,
-		},
-		{
-			name: rjs.ClientInactive,
-			args: args{
-				key:  "active",
-				path: ".",
-			},
-			wantRes: nil,
-			wantErr: true,
-		},
+		{"Swap", "korder", "status", "packed", "shipped", true, `"shipped"`},
+		{"Mismatch", "korder", "status", "packed", "delivered", false, `"shipped"`},
+		{"Object", "korder", "items[0]", json.RawMessage(`{"qty": 1, "sku": "a"}`), map[string]int{"qty": 2}, true,
+			`{"qty":2}`},
+		{"NumberFormat", "korder", "items[0].qty", json.Number("2.0"), 3, true, "3"},
+		{"LargeIntegerMismatch", "korder", "id", json.Number("9007199254740992"), 1, false, "9007199254740993"},
+		{"LargeInteger", "korder", "id", json.Number("9007199254740993"), json.Number("9007199254740995"), true,
+			"9007199254740995"},
+		{"EmptyObjectIsNotArray", "korder", "tags", map[string]int{}, []int{1}, false, "[]"},
+		{"MissingPath", "korder", "missing", nil, 1, false, ""},
+		{"MissingKey", "kmissing", ".", nil, 1, false, ""},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.name == rjs.ClientInactive {
-				rh.SetClientInactive()
+			swapped, err := rh.JSONSetIf(tt.key, tt.path, tt.expected, tt.newValue)
+			if err != nil || swapped != tt.want {
+				t.Errorf("JSONSetIf() = %v %v, want %v", swapped, err, tt.want)
 			}
-			gotRes, err := rh.JSONObjKeys(tt.args.key, tt.args.path)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONObjKeys() error = %v, wantErr %v", err, tt.wantErr)
+			if tt.wantDoc == "" {
 				return
 			}
-			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONObjKeys() = %v, want %v", gotRes, tt.wantRes)
+			if got, err := rh.JSONGet(tt.key, tt.path); err != nil || string(got.([]byte)) != tt.wantDoc {
+				t.Errorf("JSONGet() = %s %v, want %s", got, err, tt.wantDoc)
 			}
 		})
 	}
+
+	t.Run("WrongType", func(t *testing.T) {
+		_, err := eval(rh.active().impl, rjs.NewScript("SET", "return redis.call('SET', KEYS[1], 'x')"),
+			[]string{"ksetifstring"})
+		if err != nil {
+			t.Fatalf("SET error = %v", err)
+		}
+		if swapped, err := rh.JSONSetIf("ksetifstring", ".", "x", "y"); err == nil || swapped {
+			t.Errorf("JSONSetIf() of a string key = %v %v, want an error", swapped, err)
+		}
+	})
+
+	t.Run("JSONPath", func(t *testing.T) {
+		skipIfNoJSONPath(rh, t)
+		swapped, err := rh.JSONSetIf("korder", "$.status", "shipped", "delivered")
+		if err != nil || !swapped {
+			t.Errorf("JSONSetIf() = %v %v, want true", swapped, err)
+		}
+		swapped, err = rh.JSONSetIf("korder", "$.missing", nil, 1)
+		if err != nil || swapped {
+			t.Errorf("JSONSetIf() = %v %v, want false for no match", swapped, err)
+		}
+		if got, err := rh.JSONGet("korder", "$.status"); err != nil || string(got.([]byte)) != `["delivered"]` {
+			t.Errorf("JSONGet() = %s %v, want [\"delivered\"]", got, err)
+		}
+	})
 }
 
-func testJSONDebug(rh *Handler, t *testing.T) {
-	t.Skip("JSON.DEBUG apparently has some open bugs")
-	_, err := rh.JSONSet("tstr", ".", "SimpleString")
-	if err != nil {
+func testJSONArrCapped(rh *Handler, t *testing.T) {
+	if _, err := rh.JSONSet("kcapped", ".", map[string][]int{"events": {1, 2}}); err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
-	type args struct {
-		subCommand rjs.DebugSubCommand
-		key        string
-		path       string
-	}
+
 	tests := []struct {
 		name    string
-		args    args
-		wantRes interface{}
-		wantErr bool
+		prepend bool
+		path    string
+		values  []interface{}
+		want    interface{}
+		wantDoc string
 	}{
-		{
-			name: "Debug Help",
-			args: args{
-				subCommand: rjs.DebugHelpSubcommand,
-				key:        "tstr",
-				path:       ".",
-			},
-			wantRes: rjs.DebugHelpOutput,
-			wantErr: false,
-		},
-		{
-			name: "Debug Memory",
-			args: args{
-				subCommand: rjs.DebugMemorySubcommand,
-				key:        "tstr",
-				path:       ".",
-			},
-			wantRes: int64(8),
-			wantErr: false,
-		},
-		{
-			name: rjs.ClientInactive,
-			args: args{
-				key:  "active",
-				path: ".",
-			},
-			wantRes: nil,
-			wantErr: true,
-		},
+		{"AppendUnderCap", false, ".events", []interface{}{3}, int64(3), `[1,2,3]`},
+		{"AppendOverCap", false, ".events", []interface{}{4, 5}, int64(3), `[3,4,5]`},
+		{"PrependOverCap", true, ".events", []interface{}{7, 6}, int64(3), `[7,6,3]`},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.name == rjs.ClientInactive {
-				rh.SetClientInactive()
+			var res interface{}
+			var err error
+			if tt.prepend {
+				res, err = rh.JSONArrPrependCapped("kcapped", tt.path, 3, tt.values...)
+			} else {
+				res, err = rh.JSONArrAppendCapped("kcapped", tt.path, 3, tt.values...)
 			}
-			gotRes, err := rh.JSONDebug(tt.args.subCommand, tt.args.key, tt.args.path)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONDebug() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			if err != nil || !reflect.DeepEqual(res, tt.want) {
+				t.Errorf("got %v %v, want %v", res, err, tt.want)
 			}
-			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONDebug() = %v, want %v", gotRes, tt.wantRes)
+			if got, err := rh.JSONGet("kcapped", tt.path); err != nil || string(got.([]byte)) != tt.wantDoc {
+				t.Errorf("JSONGet() = %s %v, want %s", got, err, tt.wantDoc)
 			}
 		})
 	}
-}
 
-func testJSONForget(rh *Handler, t *testing.T) {
+	t.Run("NotAnArray", func(t *testing.T) {
+		if _, err := rh.JSONSet("kcapped", ".name", "x"); err != nil {
+			t.Fatal("Failed to Set path ", err)
+		}
+		if _, err := rh.JSONArrAppendCapped("kcapped", ".name", 3, 1); err == nil {
+			t.Errorf("JSONArrAppendCapped() on a string, want an error")
+		}
+	})
 
-	_, err := rh.JSONSet("kstr", ".", "simplestring")
-	if err != nil {
+	t.Run("JSONPath", func(t *testing.T) {
+		skipIfNoJSONPath(rh, t)
+		res, err := rh.JSONArrAppendCapped("kcapped", "$.events", 2, 8)
+		if err != nil || !reflect.DeepEqual(res, []interface{}{int64(2)}) {
+			t.Errorf("JSONArrAppendCapped() = %v %v, want [2]", res, err)
+		}
+		if got, err := rh.JSONGet("kcapped", "$.events"); err != nil || string(got.([]byte)) != `[[3,8]]` {
+			t.Errorf("JSONGet() = %s %v, want [[3,8]]", got, err)
+		}
+	})
+}
+
+func testLock(rh *Handler, t *testing.T) {
+	if _, err := rh.JSONSet("kjob", ".", map[string]string{"state": "pending"}); err != nil {
 		t.Fatal("Failed to Set key ", err)
 		return
 	}
 
-	testObj := TestObject{
-		Name:   "Item#1",
-		Number: 1,
+	first := rh.NewLock("kjob", LockOptions{Owner: "worker-1", TTL: time.Minute})
+	second := rh.NewLock("kjob", LockOptions{Owner: "worker-2", TTL: 200 * time.Millisecond})
+	if err := first.Acquire(); err != nil || first.Token() != 1 {
+		t.Fatalf("Acquire() error = %v, token %d, want 1", err, first.Token())
+	}
+	if err := second.Acquire(); !errors.Is(err, rjs.ErrLockHeld) {
+		t.Errorf("Acquire() of a held lock error = %v, want %v", err, rjs.ErrLockHeld)
+	}
+	if err := first.Renew(); err != nil {
+		t.Errorf("Renew() error = %v", err)
+	}
+	if err := first.Release(); err != nil {
+		t.Errorf("Release() error = %v", err)
 	}
 
-	_, err = rh.JSONSet("kstruct", ".", testObj)
-	if err != nil {
-		t.Fatal("Failed to Set key ", err)
-		return
+	if err := second.Acquire(); err != nil || second.Token() != 2 {
+		t.Fatalf("Acquire() of a released lock error = %v, token %d, want 2", err, second.Token())
+	}
+	time.Sleep(300 * time.Millisecond)
+	if err := first.Acquire(); err != nil || first.Token() != 3 {
+		t.Fatalf("Acquire() of an expired lock error = %v, token %d, want 3", err, first.Token())
+	}
+	if err := second.Renew(); err != rjs.ErrLockNotHeld {
+		t.Errorf("Renew() of a lost lock error = %v, want %v", err, rjs.ErrLockNotHeld)
+	}
+	if err := second.Release(); err != rjs.ErrLockNotHeld {
+		t.Errorf("Release() of a lost lock error = %v, want %v", err, rjs.ErrLockNotHeld)
 	}
 
-	type args struct {
-		key  string
-		path string
+	res, err := rh.JSONGet("kjob", ".lock.owner")
+	if err != nil || string(res.([]byte)) != `"worker-1"` {
+		t.Errorf("JSONGet() = %s %v, want the owner in the document", res, err)
 	}
-	tests := []struct {
-		name    string
-		args    args
-		wantRes interface{}
-		wantErr bool
-	}{
-		{
-			name: "SimpleString",
-			args: args{
-				key:  "kstr",
-				path: ".",
-			},
-			wantRes: int64(1),
-			wantErr: false,
-		},
-		{
-			name: "SimpleStructFieldOK",
-			args: args{
-				key:  "kstruct",
-				path: "name",
-			},
-			wantRes: int64(1),
-			wantErr: false,
-		},
-		{
-			name: "SimpleStructFieldNotOK",
-			args: args{
-				key:  "kstruct",
-				path: "foobar",
-			},
-			wantRes: int64(0),
-			wantErr: false,
-		},
-		{
-			name: "SimpleStruct",
-			args: args{
-				key:  "kstruct",
-				path: ".",
-			},
-			wantRes: int64(1),
-			wantErr: false,
-		},
-		{
-			name: rjs.ClientInactive,
-			args: args{
-				key:  "active",
-				path: ".",
-			},
-			wantRes: nil,
-			wantErr: true,
-		},
+	if err := rh.NewLock("kmissing", LockOptions{}).Acquire(); err == nil {
+		t.Errorf("Acquire() of a missing document, want an error")
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if tt.name == rjs.ClientInactive {
-				rh.SetClientInactive()
-			}
-			gotRes, err := rh.JSONForget(tt.args.key, tt.args.path)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONForget() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if err == nil && !reflect.DeepEqual(gotRes, tt.wantRes) {
-				t.Errorf("JSONForget() = %t, want %t", gotRes, tt.wantRes)
-			}
-		})
+}
+
+func testVersioning(rh *Handler, t *testing.T) {
+	vh := rh.WithPrefix("")
+	if err := vh.EnableVersioning(""); err != nil {
+		t.Fatalf("EnableVersioning() error = %v", err)
+	}
+	version := func() string {
+		res, err := rh.JSONGet("kversioned", DefaultVersionPath)
+		if err != nil {
+			t.Fatalf("JSONGet() error = %v", err)
+		}
+		return string(res.([]byte))
+	}
+
+	if _, err := vh.JSONSet("kversioned", ".", map[string]interface{}{"status": "new", "items": []int{}}); err != nil {
+		t.Fatalf("JSONSet() error = %v", err)
+	}
+	if v := version(); v != "1" {
+		t.Errorf("version = %s after the creation, want 1", v)
+	}
+	if _, err := vh.IfVersion(1).JSONSet("kversioned", ".status", "packed"); err != nil {
+		t.Errorf("JSONSet() at the expected version error = %v", err)
+	}
+	_, err := vh.IfVersion(1).JSONSet("kversioned", ".status", "lost")
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) || conflict.Actual != 2 {
+		t.Errorf("JSONSet() at a stale version error = %v, want a conflict at version 2", err)
+	}
+
+	if res, err := vh.JSONArrAppend("kversioned", ".items", 1, 2); err != nil || res != int64(2) {
+		t.Errorf("JSONArrAppend() = %v %v, want 2", res, err)
+	}
+	if res, err := vh.JSONArrPop("kversioned", ".items", rjs.PopArrLast); err != nil ||
+		!reflect.DeepEqual(res, []byte("2")) {
+		t.Errorf("JSONArrPop() = %v %v, want 2", res, err)
+	}
+	if _, err := vh.JSONSet("kversioned", ".", map[string]string{"status": "new"}); err != nil {
+		t.Errorf("JSONSet() of the root error = %v", err)
+	}
+	if res, err := vh.JSONSet("kversioned", ".", map[string]string{}, rjs.SetOptionNX); err != nil || res != nil {
+		t.Errorf("JSONSet() NX of an existing document = %v %v, want nil", res, err)
+	}
+	if _, err := vh.JSONNumIncrBy("kversioned", ".status", 1); err == nil {
+		t.Errorf("JSONNumIncrBy() of a string, want an error")
+	}
+	if v := version(); v != "5" {
+		t.Errorf("version = %s after 4 more writes, want 5", v)
 	}
 }
 
-func testJSONResp(rh *Handler, t *testing.T) {
+func testAudit(rh *Handler, t *testing.T) {
+	ah := rh.WithPrefix("")
+	ah.AuditWrites(AuditOptions{
+		Stream:   "kaudit:stream",
+		OldValue: true,
+		Caller:   func(ctx context.Context) string { return "tester" },
+	})
+	if _, err := ah.JSONDel("kaudit", "."); err != nil {
+		t.Fatalf("JSONDel() error = %v", err)
+	}
+	_, err := eval(rh.active().impl, rjs.NewScript("DEL", "return redis.call('DEL', KEYS[1])"), []string{"kaudit:stream"})
+	if err != nil {
+		t.Fatalf("DEL error = %v", err)
+	}
 
-	_, err := rh.JSONSet("tstr", ".", "SimpleString")
+	if _, err := ah.JSONSet("kaudit", ".", map[string]string{"status": "new"}); err != nil {
+		t.Fatalf("JSONSet() error = %v", err)
+	}
+	if _, err := ah.JSONSet("kaudit", ".status", "packed"); err != nil {
+		t.Errorf("JSONSet() error = %v", err)
+	}
+	if res, err := ah.JSONSet("kaudit", ".", map[string]string{}, rjs.SetOptionNX); err != nil || res != nil {
+		t.Errorf("JSONSet() NX of an existing document = %v %v, want nil", res, err)
+	}
+	if _, err := ah.JSONNumIncrBy("kaudit", ".status", 1); err == nil {
+		t.Errorf("JSONNumIncrBy() of a string, want an error")
+	}
+
+	res, err := eval(rh.active().impl, rjs.NewScript("XRANGE", "return redis.call('XRANGE', KEYS[1], '-', '+')"),
+		[]string{"kaudit:stream"})
 	if err != nil {
-		t.Fatal("Failed to Set key ", err)
-		return
+		t.Fatalf("XRANGE error = %v", err)
 	}
-	type args struct {
-		key  string
-		path string
+	entries := res.([]interface{})
+	if len(entries) != 2 {
+		t.Fatalf("XRANGE = %v, want the 2 applied writes", entries)
 	}
-	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
-	}{
-		{
-			name: "RESP",
-			args: args{
-				key:  "tstr",
-				path: ".",
-			},
-			wantErr: false,
-		},
-		{
-			name: rjs.ClientInactive,
-			args: args{
-				key:  "active",
-				path: ".",
-			},
-			wantErr: true,
-		},
+	fields := map[string]string{}
+	values := entries[1].([]interface{})[1].([]interface{})
+	for i := 0; i+1 < len(values); i += 2 {
+		name, _ := replyText(values[i])
+		value, _ := replyText(values[i+1])
+		fields[name] = value
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if tt.name == rjs.ClientInactive {
-				rh.SetClientInactive()
-			}
-			_, err := rh.JSONResp(tt.args.key, tt.args.path)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("JSONResp() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-		})
+	want := map[string]string{
+		"key": "kaudit", "path": ".status", "command": "JSON.SET", "new": `"packed"`, "old": `"new"`, "caller": "tester",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("entry = %v, want %v", fields, want)
 	}
 }
@@ -0,0 +1,158 @@
+package rejson
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/nitishm/go-rejson/v4/rjs"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Default backoff bounds of a RetryPolicy
+const (
+	DefaultMinRetryBackoff = 8 * time.Millisecond
+	DefaultMaxRetryBackoff = 512 * time.Millisecond
+)
+
+// retryableReplies are the prefixes of the error replies of a server that is
+// temporarily unable to serve the command
+var retryableReplies = []string{"LOADING", "TRYAGAIN", "BUSY", "MASTERDOWN", "CLUSTERDOWN", "READONLY"}
+
+// RetryPolicy configures the retries of the commands failing with a transient
+// error, see SetRetryPolicy
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a command, including
+	// the first one. Commands are not retried if it is lower than 2.
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff bound the exponential backoff between two
+	// attempts, DefaultMinRetryBackoff and DefaultMaxRetryBackoff if not set
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Retryable reports whether an error is transient, DefaultRetryable if not set
+	Retryable func(err error) bool
+
+	// AllowNonIdempotent lists the commands retried even though they are not
+	// idempotent, see Invocation.Idempotent. A retried JSON.NUMINCRBY may be
+	// applied twice if the reply of the first attempt was lost.
+	AllowNonIdempotent []rjs.ReJSONCommandID
+}
+
+// SetRetryPolicy sets the policy retrying the idempotent commands of the handler
+// that fail with a transient error. The retries happen below the middlewares,
+// which observe a single invocation, see Invocation.Attempts.
+//
+// go-redis clients retry failed commands on their own, regardless of their
+// idempotency, unless goredis.Options.MaxRetries is set to -1.
+func (r *Handler) SetRetryPolicy(policy RetryPolicy) {
+	if policy.MinBackoff <= 0 {
+		policy.MinBackoff = DefaultMinRetryBackoff
+	}
+	if policy.MaxBackoff < policy.MinBackoff {
+		policy.MaxBackoff = DefaultMaxRetryBackoff
+		if policy.MaxBackoff < policy.MinBackoff {
+			policy.MaxBackoff = policy.MinBackoff
+		}
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = DefaultRetryable
+	}
+	r.retry = &policy
+}
+
+// Idempotent reports whether the command can be sent again without changing its
+// outcome when its reply was lost: the read commands, JSON.SET unless NX is set,
+// it is conditional or releases a Lock, as a retry would report the key as
+// already set, the value as changed or the lock as not held, JSON.DEL,
+// JSON.FORGET and JSON.ARRTRIM. JSON.NUMINCRBY, JSON.NUMMULTBY, JSON.STRAPPEND,
+// JSON.ARRAPPEND, JSON.ARRINSERT and JSON.ARRPOP are not, and neither are the
+// writes requiring a version, see IfVersion.
+func (inv *Invocation) Idempotent() bool {
+	if inv.ifVersion != nil {
+		// a retry would conflict with the version of its first attempt
+		return false
+	}
+	switch inv.Command {
+	case rjs.ReJSONCommandSET:
+		if inv.Script == rjs.ScriptSetIf.Name() || inv.Script == rjs.ScriptUnlock.Name() {
+			return false
+		}
+		for _, arg := range inv.Args[1:] {
+			if arg == rjs.SetOptionNX {
+				return false
+			}
+		}
+		return true
+	case rjs.ReJSONCommandNUMINCRBY, rjs.ReJSONCommandNUMMULTBY, rjs.ReJSONCommandSTRAPPEND,
+		rjs.ReJSONCommandARRAPPEND, rjs.ReJSONCommandARRINSERT, rjs.ReJSONCommandARRPOP:
+		return false
+	}
+	return true
+}
+
+// DefaultRetryable reports whether err is a network error, a timeout of the
+// connection or an error reply of a server that is loading its data set, busy
+// or failing over. Expired or canceled contexts are not retried.
+func DefaultRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var redigoErr redigo.Error
+	var goredisErr goredis.Error
+	if errors.As(err, &redigoErr) || errors.As(err, &goredisErr) {
+		for _, prefix := range retryableReplies {
+			if strings.HasPrefix(err.Error(), prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// shouldRetry reports whether inv, having failed with err, is attempted again
+func (p *RetryPolicy) shouldRetry(inv *Invocation, err error) bool {
+	if inv.Attempts >= p.MaxAttempts || !p.Retryable(err) {
+		return false
+	}
+	if inv.Idempotent() {
+		return true
+	}
+	for _, command := range p.AllowNonIdempotent {
+		if command == inv.Command {
+			return true
+		}
+	}
+	return false
+}
+
+// wait sleeps before the next attempt, with an exponential backoff and jitter,
+// returning false if ctx is done first
+func (p *RetryPolicy) wait(ctx context.Context, attempts int) bool {
+	backoff := p.MaxBackoff
+	if shift := attempts - 1; shift < 32 && p.MinBackoff<<shift < p.MaxBackoff {
+		backoff = p.MinBackoff << shift
+	}
+	// equal jitter, between half and the whole backoff
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
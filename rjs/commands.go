@@ -1,9 +1,6 @@
 package rjs
 
-import (
-	"encoding/json"
-	"fmt"
-)
+import "fmt"
 
 // ReJSONCommandID marks a particular unique id to all the ReJSON commands
 // to ensure proper type safety and help reducing typos in using them.
@@ -22,7 +19,7 @@ func commandJSONSet(argsIn ...interface{}) (argsOut []interface{}, err error) {
 
 	argsOut = append(argsOut, key, path)
 
-	b, err := json.Marshal(obj)
+	b, err := MarshalValue(obj)
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +58,10 @@ func commandJSONMGet(argsIn ...interface{}) (argsOut []interface{}, err error) {
 func commandJSONNumIncrBy(argsIn ...interface{}) (argsOut []interface{}, err error) {
 	key := argsIn[0]
 	path := argsIn[1]
-	number := argsIn[2]
+	number, err := numberArg(argsIn[2])
+	if err != nil {
+		return nil, err
+	}
 	argsOut = append(argsOut, key, path, number)
 	return
 }
@@ -69,7 +69,10 @@ func commandJSONNumIncrBy(argsIn ...interface{}) (argsOut []interface{}, err err
 func commandJSONNumMultBy(argsIn ...interface{}) (argsOut []interface{}, err error) {
 	key := argsIn[0]
 	path := argsIn[1]
-	number := argsIn[2]
+	number, err := numberArg(argsIn[2])
+	if err != nil {
+		return nil, err
+	}
 	argsOut = append(argsOut, key, path, number)
 	return
 }
@@ -88,7 +91,7 @@ func commandJSONArrAppend(argsIn ...interface{}) (argsOut []interface{}, err err
 	values := argsIn[2:]
 	argsOut = append(argsOut, keys, path)
 	for _, value := range values {
-		jsonValue, err := json.Marshal(value)
+		jsonValue, err := MarshalValue(value)
 		if err != nil {
 			return nil, err
 		}
@@ -113,7 +116,7 @@ func commandJSONArrPop(argsIn ...interface{}) (argsOut []interface{}, err error)
 func commandJSONArrIndex(argsIn ...interface{}) (argsOut []interface{}, err error) {
 	key := argsIn[0]
 	path := argsIn[1]
-	jsonValue, err := json.Marshal(argsIn[2])
+	jsonValue, err := MarshalValue(argsIn[2])
 	if err != nil {
 		return nil, err
 	}
@@ -138,7 +141,7 @@ func commandJSONArrInsert(argsIn ...interface{}) (argsOut []interface{}, err err
 	values := argsIn[3:]
 	argsOut = append(argsOut, keys, path, index)
 	for _, value := range values {
-		jsonValue, err := json.Marshal(value)
+		jsonValue, err := MarshalValue(value)
 		if err != nil {
 			return nil, err
 		}
@@ -181,7 +184,7 @@ func CommandBuilder(commandNameIn ReJSONCommandID, argsIn ...interface{}) (comma
 
 	argsOut, err = cmd(argsIn...)
 	if err != nil {
-		return commandNameOut, nil, fmt.Errorf("failed to execute command %v: %v", commandNameIn, err)
+		return commandNameOut, nil, fmt.Errorf("failed to execute command %v: %w", commandNameIn, err)
 	}
 
 	return
@@ -8,6 +8,24 @@ var (
 	ErrNoClientSet       = fmt.Errorf("no redis client is set")
 	ErrTooManyOptionals  = fmt.Errorf("error: too many optional arguments")
 	ErrNeedAtLeastOneArg = fmt.Errorf("error: need atleast one argument in varying field")
+	ErrInvalidRawJSON    = fmt.Errorf("error: raw json value is not valid json")
+	ErrInvalidNumber     = fmt.Errorf("error: unsupported or invalid number")
+	ErrNilReply          = fmt.Errorf("error: nil reply")
+	ErrScanNotSupported  = fmt.Errorf("error: client does not support scanning the key space")
+	ErrNotSupported      = fmt.Errorf("error: command not supported by the client")
+	ErrCrossSlot         = fmt.Errorf("error: keys do not hash to the same slot")
+	ErrCircuitOpen       = fmt.Errorf("error: circuit breaker is open")
+	ErrMultipleClients   = fmt.Errorf("error: more than one redis client is set")
+	ErrInvalidOption     = fmt.Errorf("error: invalid option")
+	ErrInvalidTTL        = fmt.Errorf("error: invalid or missing ttl")
+	ErrInvalidMaxLen     = fmt.Errorf("error: array max length must be positive")
+	ErrInvalidPath       = fmt.Errorf("error: invalid path")
+	ErrLockHeld          = fmt.Errorf("error: lock is held by another owner")
+	ErrLockNotHeld       = fmt.Errorf("error: lock is not held")
+	ErrSchemaValidation  = fmt.Errorf("error: json schema validation failed")
+	ErrVersioning        = fmt.Errorf("error: versioned write not supported")
+	ErrVersionConflict   = fmt.Errorf("error: version conflict")
+	ErrAuditing          = fmt.Errorf("error: audited write not supported")
 
 	// GoRedis specific Nil error
 	ErrGoRedisNil = fmt.Errorf("redis: nil")
@@ -23,6 +41,9 @@ const (
 	// ClientGoRedis signifies that the current client is go-redis
 	ClientGoRedis = "goredis"
 
+	// ReJSONKeyType is the type of ReJSON documents as reported by TYPE and filtered by SCAN ... TYPE
+	ReJSONKeyType = "ReJSON-RL"
+
 	// PopArrLast gives index of the last element for JSONArrPop
 	PopArrLast = -1
 
@@ -57,6 +78,10 @@ const (
 	ReJSONCommandFORGET    ReJSONCommandID = 18
 	ReJSONCommandRESP      ReJSONCommandID = 19
 
+	// ReJSONCommandSCAN is not a ReJSON command: it identifies the SCAN of the
+	// keys of the documents, see rejson.ScanJSON. It has no command builder.
+	ReJSONCommandSCAN ReJSONCommandID = 20
+
 	// JSONSET command Options
 	SetOptionNX SetOption = "NX"
 	SetOptionXX SetOption = "XX"
@@ -70,6 +95,11 @@ var (
 	GETOptionNOESCAPE = GetOption{"NOESCAPE", ""}
 )
 
+// JSONSetWithTTL Command Options, see also TTLOptionEX and TTLOptionPX
+var (
+	TTLOptionKEEPTTL = TTLOption{name: "KEEPTTL"}
+)
+
 // commandName maps command id to the command name
 var commandName = map[ReJSONCommandID]string{
 	ReJSONCommandSET:       "JSON.SET",
@@ -92,6 +122,7 @@ var commandName = map[ReJSONCommandID]string{
 	ReJSONCommandDEBUG:     "JSON.DEBUG",
 	ReJSONCommandFORGET:    "JSON.FORGET",
 	ReJSONCommandRESP:      "JSON.RESP",
+	ReJSONCommandSCAN:      "SCAN",
 }
 
 // commandMux maps command id to their Command Builder functions
@@ -29,6 +29,14 @@ func (r ReJSONCommandID) Value() int32 {
 	return int32(r)
 }
 
+// String returns the name of the ReJSON command, e.g. JSON.SET
+func (r ReJSONCommandID) String() string {
+	if name, ok := commandName[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("ReJSONCommandID(%d)", r.Value())
+}
+
 // TypeSafety checks the validity of the command id
 func (r ReJSONCommandID) TypeSafety() error {
 	if r.Value() < 0 || r.Value() > 19 {
@@ -40,9 +48,20 @@ func (r ReJSONCommandID) TypeSafety() error {
 // Details returns the details of the CommandId like its command function and name
 func (r ReJSONCommandID) Details() (CommandBuilderFunc, string, error) {
 	name, ok := commandName[r]
-	if !ok {
+	cmd, built := commandMux[r]
+	if !ok || !built {
 		return nil, "", fmt.Errorf("command not supported by ReJSON")
 	}
-	cmd := commandMux[r]
 	return cmd, name, nil
 }
+
+// IsWrite reports whether the command modifies the document at its key
+func (r ReJSONCommandID) IsWrite() bool {
+	switch r {
+	case ReJSONCommandSET, ReJSONCommandDEL, ReJSONCommandNUMINCRBY, ReJSONCommandNUMMULTBY,
+		ReJSONCommandSTRAPPEND, ReJSONCommandARRAPPEND, ReJSONCommandARRPOP, ReJSONCommandARRTRIM,
+		ReJSONCommandARRINSERT, ReJSONCommandFORGET:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+package rjs
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// RawJSON is a pre-encoded JSON value. It is sent to the server verbatim by
+// every value-taking command builder (JSON.SET, JSON.ARRAPPEND, JSON.ARRINDEX,
+// JSON.ARRINSERT) instead of being marshaled into a quoted JSON string. The
+// builders do not validate it: a rejson.Handler does, unless disabled with
+// rejson.WithRawJSONValidation.
+//
+// json.RawMessage values are treated the same way.
+type RawJSON []byte
+
+// MarshalJSON returns the raw bytes, so RawJSON also encodes correctly when
+// nested inside other values.
+func (r RawJSON) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+// MarshalValue returns the JSON encoding of obj as sent to the server by the
+// command builders. Pre-encoded values are passed through without re-marshaling.
+//
+// A *big.Float is encoded as a json number, but encoding/json encodes the ones
+// nested in other values as json strings: they are rejected with
+// ErrInvalidNumber, use json.Number fields instead.
+func MarshalValue(obj interface{}) ([]byte, error) {
+	switch v := obj.(type) {
+	case RawJSON:
+		return v.MarshalJSON()
+	case json.RawMessage:
+		return v.MarshalJSON()
+	case *big.Float:
+		str, err := formatBigFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(str), nil
+	}
+	if mayHoldBigFloat(reflect.TypeOf(obj)) && holdsBigFloat(reflect.ValueOf(obj), 0) {
+		return nil, fmt.Errorf("%w: *big.Float nested in %T would be sent as a json string", ErrInvalidNumber, obj)
+	}
+	return json.Marshal(obj)
+}
+
+var (
+	bigFloatType      = reflect.TypeOf(big.Float{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+	// bigFloatTypes caches mayHoldBigFloat by type
+	bigFloatTypes sync.Map
+)
+
+// mayHoldBigFloat reports whether the values of type t may hold a big.Float
+// encoded by encoding/json, so that only those values are walked
+func mayHoldBigFloat(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	if may, ok := bigFloatTypes.Load(t); ok {
+		return may.(bool)
+	}
+	may := typeHoldsBigFloat(t, make(map[reflect.Type]bool))
+	bigFloatTypes.Store(t, may)
+	return may
+}
+
+func typeHoldsBigFloat(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if t == bigFloatType || t.Kind() == reflect.Ptr && t.Elem() == bigFloatType {
+		return true
+	}
+	if seen[t] || encodesItself(t) {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return typeHoldsBigFloat(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); encodedField(f) && typeHoldsBigFloat(f.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maxBigFloatDepth bounds the walk of holdsBigFloat, leaving the values deeper
+// than that, e.g. cyclic ones, to encoding/json
+const maxBigFloatDepth = 1000
+
+// holdsBigFloat reports whether v holds a big.Float encoded by encoding/json
+func holdsBigFloat(v reflect.Value, depth int) bool {
+	if depth > maxBigFloatDepth {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return false
+		}
+		if v.Kind() == reflect.Ptr && v.Type().Elem() == bigFloatType {
+			return true
+		}
+		if encodesItself(v.Type()) {
+			return false
+		}
+		return holdsBigFloat(v.Elem(), depth+1)
+	case reflect.Struct:
+		if v.Type() == bigFloatType {
+			return true
+		}
+		if encodesItself(v.Type()) {
+			return false
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if encodedField(v.Type().Field(i)) && holdsBigFloat(v.Field(i), depth+1) {
+				return true
+			}
+		}
+	case reflect.Map:
+		if !mayHoldBigFloat(v.Type().Elem()) {
+			return false
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if holdsBigFloat(iter.Value(), depth+1) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if !mayHoldBigFloat(v.Type().Elem()) {
+			return false
+		}
+		for i := 0; i < v.Len(); i++ {
+			if holdsBigFloat(v.Index(i), depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encodesItself reports whether the values of type t control their encoding,
+// which is then left alone
+func encodesItself(t reflect.Type) bool {
+	if t.Kind() != reflect.Interface && t.Kind() != reflect.Ptr {
+		t = reflect.PtrTo(t)
+	}
+	if t.Kind() == reflect.Interface {
+		return false
+	}
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType)
+}
+
+// encodedField reports whether encoding/json encodes the struct field f
+func encodedField(f reflect.StructField) bool {
+	return (f.PkgPath == "" || f.Anonymous) && f.Tag.Get("json") != "-"
+}
+
+// numberArg returns the wire representation of a numeric command argument.
+// json.Number, *big.Int and *big.Float values are sent as their exact decimal
+// literal so that no precision is lost on the way to the server. Named types of
+// the int, uint and float kinds, e.g. type Cents int64, are accepted as well.
+func numberArg(number interface{}) (interface{}, error) {
+	switch v := number.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v, nil
+	case json.Number:
+		// json.Marshal validates that the literal is a well-formed number, but
+		// encodes the empty one as 0
+		if v == "" {
+			return nil, ErrInvalidNumber
+		}
+		if _, err := json.Marshal(v); err != nil {
+			return nil, ErrInvalidNumber
+		}
+		return v.String(), nil
+	case *big.Int:
+		if v == nil {
+			return nil, ErrInvalidNumber
+		}
+		return v.String(), nil
+	case *big.Float:
+		return formatBigFloat(v)
+	}
+	if number == nil {
+		return nil, ErrInvalidNumber
+	}
+	switch v := reflect.ValueOf(number); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+	return nil, ErrInvalidNumber
+}
+
+func formatBigFloat(f *big.Float) (string, error) {
+	if f == nil || f.IsInf() {
+		return "", ErrInvalidNumber
+	}
+	// the shortest decimal that round-trips at the precision of f
+	return f.Text('g', -1), nil
+}
+
+// Unmarshal decodes a JSON reply, such as the result of JSONGet, an element of
+// JSONMGet, JSONArrPop or JSONNumIncrBy, into v without losing numeric precision.
+//
+// Numbers decoded into interface{} values become json.Number instead of float64,
+// and *big.Int and *big.Float targets are decoded from the exact literal. For
+// numbers nested in structs use json.Number or *big.Int fields.
+func Unmarshal(reply interface{}, v interface{}) error {
+	b, err := replyBytes(reply)
+	if err != nil {
+		return err
+	}
+	if f, ok := v.(*big.Float); ok {
+		return unmarshalBigFloat(b, f)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func unmarshalBigFloat(b []byte, f *big.Float) error {
+	var num json.Number
+	if err := json.Unmarshal(b, &num); err != nil {
+		return err
+	}
+	if f.Prec() == 0 {
+		// about 3.33 bits are needed per decimal digit, keep at least float64 precision
+		prec := uint(len(num)) * 4
+		if prec < 64 {
+			prec = 64
+		}
+		f.SetPrec(prec)
+	}
+	if _, ok := f.SetString(num.String()); !ok {
+		return ErrInvalidNumber
+	}
+	return nil
+}
+
+func replyBytes(reply interface{}) ([]byte, error) {
+	switch v := reply.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case RawJSON:
+		return v, nil
+	case json.RawMessage:
+		return v, nil
+	case nil:
+		return nil, ErrNilReply
+	}
+	return nil, fmt.Errorf("error: cannot decode reply of type %T", reply)
+}
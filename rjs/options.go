@@ -1,5 +1,7 @@
 package rjs
 
+import "time"
+
 // ReJSONOption provides methods for the options used by various ReJSON commands
 // It also abstracts options from the required parameters of the commands
 //
@@ -58,3 +60,50 @@ func (g SetOption) MethodID() ReJSONCommandID {
 func (g SetOption) Value() []interface{} {
 	return []interface{}{string(g)}
 }
+
+// TTLOption implements ReJSONOption for the expiry of the key written by
+// JSONSetWithTTL
+// TTL Options:
+//   - EX seconds
+//   - PX milliseconds
+//   - KEEPTTL (keeping the current expiry of the key, if any)
+type TTLOption struct {
+	name string
+	Arg  int64
+}
+
+// TTLOptionEX expires the key after ttl, truncated to seconds
+func TTLOptionEX(ttl time.Duration) TTLOption {
+	return TTLOption{name: "EX", Arg: int64(ttl / time.Second)}
+}
+
+// TTLOptionPX expires the key after ttl, truncated to milliseconds
+func TTLOptionPX(ttl time.Duration) TTLOption {
+	return TTLOption{name: "PX", Arg: int64(ttl / time.Millisecond)}
+}
+
+// MethodID returns the name of the method i.e. JSON.SET
+func (t TTLOption) MethodID() ReJSONCommandID {
+	return ReJSONCommandSET
+}
+
+// Value returns the value of the option being used
+func (t TTLOption) Value() []interface{} {
+	if t.name == TTLOptionKEEPTTL.name {
+		return []interface{}{t.name}
+	}
+	return []interface{}{t.name, t.Arg}
+}
+
+// validate checks that the option is set, with a positive expiry for EX and PX
+func (t TTLOption) validate() error {
+	switch t.name {
+	case "EX", "PX":
+		if t.Arg > 0 {
+			return nil
+		}
+	case TTLOptionKEEPTTL.name:
+		return nil
+	}
+	return ErrInvalidTTL
+}
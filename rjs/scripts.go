@@ -0,0 +1,514 @@
+package rjs
+
+import (
+	"crypto/sha1" // nolint: gosec
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Script is a Lua script run atomically by the server. Clients run it with
+// EVALSHA, falling back to EVAL, which also caches it, when the server replies
+// NOSCRIPT.
+type Script struct {
+	name   string
+	source string
+	hash   string
+}
+
+// bundledScripts are the scripts of the typed Handler methods, see BundledScripts
+var bundledScripts []*Script
+
+// NewScript returns a Script named name, e.g. for the Invocation of a handler
+func NewScript(name, source string) *Script {
+	sum := sha1.Sum([]byte(source)) // nolint: gosec
+	return &Script{name: name, source: source, hash: hex.EncodeToString(sum[:])}
+}
+
+// bundle returns a new Script added to the bundled scripts
+func bundle(name, source string) *Script {
+	script := NewScript(name, source)
+	bundledScripts = append(bundledScripts, script)
+	return script
+}
+
+// BundledScripts returns the scripts run by the typed Handler methods, e.g. to
+// load them with SCRIPT LOAD beforehand
+func BundledScripts() []*Script {
+	return append([]*Script(nil), bundledScripts...)
+}
+
+// Name returns the name of the script
+func (s *Script) Name() string {
+	return s.name
+}
+
+// Source returns the Lua source of the script
+func (s *Script) Source() string {
+	return s.source
+}
+
+// Hash returns the SHA1 digest of the script, as expected by EVALSHA
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+// EvalArgs returns the arguments of EVAL or EVALSHA after the script or its
+// digest: the number of keys, the keys and args
+func EvalArgs(keys []string, args []interface{}) []interface{} {
+	evalArgs := make([]interface{}, 0, 1+len(keys)+len(args))
+	evalArgs = append(evalArgs, len(keys))
+	for _, key := range keys {
+		evalArgs = append(evalArgs, key)
+	}
+	return append(evalArgs, args...)
+}
+
+// IsNoScript reports whether err is the NOSCRIPT error reply of EVALSHA, sent
+// when the server does not have the script cached
+func IsNoScript(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT")
+}
+
+// ScriptSetWithTTL sets the json value at ARGV[1] of KEYS[1] to ARGV[2] and its
+// expiry, ARGV[3] being EX, PX or KEEPTTL and ARGV[4] the expiry, with the NX
+// or XX option of JSON.SET in ARGV[5]. It returns the reply of JSON.SET.
+var ScriptSetWithTTL = bundle("JSON.SET+TTL", `
+local pttl = -1
+if ARGV[3] == 'KEEPTTL' then
+	pttl = redis.call('PTTL', KEYS[1])
+end
+local res
+if ARGV[5] then
+	res = redis.call('JSON.SET', KEYS[1], ARGV[1], ARGV[2], ARGV[5])
+else
+	res = redis.call('JSON.SET', KEYS[1], ARGV[1], ARGV[2])
+end
+if not res then
+	return res
+end
+if ARGV[3] == 'EX' then
+	redis.call('EXPIRE', KEYS[1], ARGV[4])
+elseif ARGV[3] == 'PX' then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+elseif pttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], pttl)
+end
+return res
+`)
+
+// SetWithTTLArgs returns the ARGV of ScriptSetWithTTL
+func SetWithTTLArgs(path string, obj interface{}, ttl TTLOption, opts ...SetOption) ([]interface{}, error) {
+	if len(opts) > 1 {
+		return nil, ErrTooManyOptionals
+	}
+	if err := ttl.validate(); err != nil {
+		return nil, err
+	}
+	b, err := MarshalValue(obj)
+	if err != nil {
+		return nil, err
+	}
+	args := []interface{}{path, b, ttl.name, ttl.Arg}
+	for _, op := range opts {
+		args = append(args, op.Value()...)
+	}
+	return args, nil
+}
+
+// ScriptNumIncrByGet increments the number at ARGV[1] of KEYS[1] by ARGV[2] and
+// returns the whole document
+var ScriptNumIncrByGet = bundle("JSON.NUMINCRBY+GET", `
+redis.call('JSON.NUMINCRBY', KEYS[1], ARGV[1], ARGV[2])
+return redis.call('JSON.GET', KEYS[1])
+`)
+
+// NumIncrByGetArgs returns the ARGV of ScriptNumIncrByGet
+func NumIncrByGetArgs(path string, number interface{}) ([]interface{}, error) {
+	n, err := numberArg(number)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{path, n}, nil
+}
+
+// ScriptSetIf sets the json value at ARGV[1] of KEYS[1] to ARGV[3] if it is
+// equal to ARGV[2], or if every match of a JSONPath ($) path is. It returns 1
+// if the value was set, 0 otherwise, or the error of JSON.GET, e.g. WRONGTYPE.
+//
+// The values are compared as canonical json text: object members are sorted,
+// strings re-encoded and numbers compared as exact decimals, so that integers
+// beyond 2^53 or [] and {} are never equal.
+var ScriptSetIf = bundle("JSON.SET+IF", `
+-- the exact decimal d of a number literal as digits without trailing zeros
+-- and an exponent, e.g. 1.50 and 15e-1 are both 15e-1
+local function canonical_number(s)
+	local sign, int, frac, exp = string.match(s, '^(-?)(%d+)%.?(%d*)[eE]?([-+]?%d*)$')
+	if not sign then
+		return s
+	end
+	local digits = (string.gsub(int .. frac, '^0+', ''))
+	if digits == '' then
+		return '0'
+	end
+	local stripped = (string.gsub(digits, '0+$', ''))
+	return sign .. stripped .. 'e' .. ((tonumber(exp) or 0) - #frac + #digits - #stripped)
+end
+
+-- the canonical text of the json value s, and the ones of its elements if it
+-- is an array
+local function canonical(s)
+	local pos = 1
+	local function skip()
+		pos = string.find(s, '[^ \t\r\n]', pos) or #s + 1
+	end
+	local function str()
+		local e = pos + 1
+		while true do
+			e = string.find(s, '["\\]', e)
+			if string.sub(s, e, e) == '"' then
+				break
+			end
+			e = e + 2
+		end
+		local raw = string.sub(s, pos, e)
+		pos = e + 1
+		return cjson.encode(cjson.decode(raw))
+	end
+	local function value()
+		skip()
+		local c = string.sub(s, pos, pos)
+		if c == '"' then
+			return str()
+		end
+		if c == '[' or c == '{' then
+			local close = c == '[' and ']' or '}'
+			local parts = {}
+			pos = pos + 1
+			skip()
+			if string.sub(s, pos, pos) == close then
+				pos = pos + 1
+				return c .. close, parts
+			end
+			repeat
+				skip()
+				if c == '{' then
+					local k = str()
+					skip()
+					pos = pos + 1
+					table.insert(parts, k .. ':' .. value())
+				else
+					table.insert(parts, (value()))
+				end
+				skip()
+				local sep = string.sub(s, pos, pos)
+				pos = pos + 1
+			until sep == close
+			if c == '{' then
+				table.sort(parts)
+			end
+			return c .. table.concat(parts, ',') .. close, parts
+		end
+		local token = string.match(s, '^[^,:%]}%s]+', pos)
+		pos = pos + #token
+		if string.find(token, '^-?%d') then
+			return canonical_number(token)
+		end
+		return token
+	end
+	return value()
+end
+
+local current = redis.pcall('JSON.GET', KEYS[1], ARGV[1])
+if type(current) == 'table' and current.err then
+	if string.find(current.err, 'does not exist', 1, true) then
+		-- no value at the path
+		return 0
+	end
+	return current
+end
+if not current then
+	-- no key
+	return 0
+end
+local expected = canonical(ARGV[2])
+if string.sub(ARGV[1], 1, 1) == '$' then
+	local _, matches = canonical(current)
+	if #matches == 0 then
+		return 0
+	end
+	for _, v in ipairs(matches) do
+		if v ~= expected then
+			return 0
+		end
+	end
+elseif canonical(current) ~= expected then
+	return 0
+end
+redis.call('JSON.SET', KEYS[1], ARGV[1], ARGV[3])
+return 1
+`)
+
+// SetIfArgs returns the ARGV of ScriptSetIf
+func SetIfArgs(path string, expected, newValue interface{}) ([]interface{}, error) {
+	e, err := MarshalValue(expected)
+	if err != nil {
+		return nil, err
+	}
+	v, err := MarshalValue(newValue)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{path, e, v}, nil
+}
+
+// ScriptArrAppendCapped appends the json values ARGV[3...] to the arrays at
+// ARGV[1] of KEYS[1] and trims them to their last ARGV[2] elements. It returns
+// the reply of JSON.ARRTRIM, the new length of the arrays.
+//
+// The range of a legacy path is computed from the length of its array, as
+// servers before RedisJSON 2.0 read a negative start as 0. The arrays matched
+// by a JSONPath ($) path, which requires RedisJSON 2.0, are trimmed from their
+// end.
+var ScriptArrAppendCapped = bundle("JSON.ARRAPPEND+ARRTRIM", `
+local len = redis.call('JSON.ARRAPPEND', KEYS[1], ARGV[1], unpack(ARGV, 3))
+local max = tonumber(ARGV[2])
+if type(len) == 'number' then
+	return redis.call('JSON.ARRTRIM', KEYS[1], ARGV[1], math.max(0, len - max), len - 1)
+end
+return redis.call('JSON.ARRTRIM', KEYS[1], ARGV[1], -max, -1)
+`)
+
+// ScriptArrPrependCapped inserts the json values ARGV[3...] at the start of the
+// arrays at ARGV[1] of KEYS[1] and trims them to their first ARGV[2] elements.
+// It returns the reply of JSON.ARRTRIM, the new length of the arrays.
+var ScriptArrPrependCapped = bundle("JSON.ARRINSERT+ARRTRIM", `
+redis.call('JSON.ARRINSERT', KEYS[1], ARGV[1], 0, unpack(ARGV, 3))
+return redis.call('JSON.ARRTRIM', KEYS[1], ARGV[1], 0, ARGV[2] - 1)
+`)
+
+// ArrCappedArgs returns the ARGV of ScriptArrAppendCapped and ScriptArrPrependCapped
+func ArrCappedArgs(path string, maxLen int, values ...interface{}) ([]interface{}, error) {
+	if len(values) == 0 {
+		return nil, ErrNeedAtLeastOneArg
+	}
+	if maxLen <= 0 {
+		return nil, ErrInvalidMaxLen
+	}
+	args := make([]interface{}, 0, 2+len(values))
+	args = append(args, path, maxLen)
+	for _, value := range values {
+		b, err := MarshalValue(value)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, b)
+	}
+	return args, nil
+}
+
+// lockNow sets now to the time of the server in milliseconds. Commands are
+// replicated instead of the script, so that writes are allowed after TIME.
+const lockNow = `
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+`
+
+// ScriptLock acquires the lock at ARGV[1] of KEYS[1] for the owner ARGV[2] and
+// ARGV[3] milliseconds, creating the {"owner", "expires", "token"} object if the
+// path does not exist, if it is not held by another owner or expired. The token
+// is then incremented with JSON.NUMINCRBY. It returns {1, token, expires} once
+// acquired, {0, owner, expires} otherwise, expires being in unix milliseconds.
+var ScriptLock = bundle("JSON.LOCK", lockNow+`
+local current = redis.pcall('JSON.GET', KEYS[1], ARGV[1])
+if not current then
+	return redis.error_reply('ERR lock document does not exist')
+end
+local expires = now + tonumber(ARGV[3])
+local owner = cjson.encode(ARGV[2])
+if type(current) == 'table' then
+	-- no lock at the path yet
+	redis.call('JSON.SET', KEYS[1], ARGV[1], '{"owner":' .. owner .. ',"expires":0,"token":0}')
+else
+	local lock = cjson.decode(current)
+	if type(lock.owner) == 'string' and lock.owner ~= ARGV[2] and (tonumber(lock.expires) or 0) > now then
+		return {0, lock.owner, lock.expires}
+	end
+	redis.call('JSON.SET', KEYS[1], ARGV[1] .. '.owner', owner)
+end
+redis.call('JSON.SET', KEYS[1], ARGV[1] .. '.expires', expires)
+local token = redis.call('JSON.NUMINCRBY', KEYS[1], ARGV[1] .. '.token', 1)
+return {1, token, expires}
+`)
+
+// lockHeld sets lock to the lock at ARGV[1] of KEYS[1], returning 0 unless its
+// owner is ARGV[2] and its token ARGV[3]
+const lockHeld = `
+local current = redis.pcall('JSON.GET', KEYS[1], ARGV[1])
+if not current or type(current) == 'table' then
+	return 0
+end
+local lock = cjson.decode(current)
+if lock.owner ~= ARGV[2] or lock.token ~= tonumber(ARGV[3]) then
+	return 0
+end
+`
+
+// ScriptLockRenew extends the lock at ARGV[1] of KEYS[1] held by the owner
+// ARGV[2] with the token ARGV[3] by ARGV[4] milliseconds. It returns the new
+// expiry in unix milliseconds, or 0 if the lock is not held or expired.
+var ScriptLockRenew = bundle("JSON.LOCK+RENEW", lockNow+lockHeld+`
+if (tonumber(lock.expires) or 0) <= now then
+	return 0
+end
+local expires = now + tonumber(ARGV[4])
+redis.call('JSON.SET', KEYS[1], ARGV[1] .. '.expires', expires)
+return expires
+`)
+
+// ScriptUnlock releases the lock at ARGV[1] of KEYS[1] held by the owner ARGV[2]
+// with the token ARGV[3], keeping the token. It returns 1 if it was released, 0
+// if it is not held.
+var ScriptUnlock = bundle("JSON.UNLOCK", lockHeld+`
+redis.call('JSON.SET', KEYS[1], ARGV[1] .. '.owner', 'null')
+redis.call('JSON.SET', KEYS[1], ARGV[1] .. '.expires', 0)
+return 1
+`)
+
+// LockArgs returns the ARGV of ScriptLock
+func LockArgs(path, owner string, ttl time.Duration) ([]interface{}, error) {
+	if ttl < time.Millisecond {
+		return nil, ErrInvalidTTL
+	}
+	return []interface{}{path, owner, ttl.Milliseconds()}, nil
+}
+
+// LockRenewArgs returns the ARGV of ScriptLockRenew
+func LockRenewArgs(path, owner string, token int64, ttl time.Duration) ([]interface{}, error) {
+	if ttl < time.Millisecond {
+		return nil, ErrInvalidTTL
+	}
+	return []interface{}{path, owner, token, ttl.Milliseconds()}, nil
+}
+
+// UnlockArgs returns the ARGV of ScriptUnlock
+func UnlockArgs(path, owner string, token int64) []interface{} {
+	return []interface{}{path, owner, token}
+}
+
+// versionedWrite defines versioned_write(key, path, expected, command, args),
+// the body of ScriptVersioned
+const versionedWrite = `
+local function versioned_write(key, path, expected, command, args)
+	local version = 0
+	if redis.call('EXISTS', key) == 1 then
+		local t = redis.pcall('JSON.TYPE', key)
+		if type(t) == 'table' then
+			if t.err then
+				return t
+			end
+			-- a status reply
+			t = t.ok
+		end
+		if t ~= 'object' then
+			return redis.error_reply('ERR the root of a versioned document must be an object')
+		end
+		local current = redis.pcall('JSON.GET', key, path)
+		if type(current) == 'string' then
+			version = tonumber(current) or 0
+		end
+	end
+	if expected ~= '' and tonumber(expected) ~= version then
+		return {0, version}
+	end
+	local res = redis.pcall(command, key, unpack(args))
+	if type(res) == 'table' and res.err then
+		return res
+	end
+	if res and redis.call('EXISTS', key) == 1 then
+		version = version + 1
+		redis.call('JSON.SET', key, path, version)
+	end
+	return {1, res, version}
+end
+`
+
+// ScriptVersioned runs the write ARGV[3] of KEYS[1] with the arguments
+// ARGV[4...] and increments the version at ARGV[1] if the key exists once it
+// ran. If ARGV[2] is not empty the write only runs if the document is at this
+// version, a missing document or version being at 0. It returns {1, reply of
+// the write, new version}, or {0, version} on a version conflict.
+var ScriptVersioned = bundle("JSON.VERSIONED", versionedWrite+`
+return versioned_write(KEYS[1], ARGV[1], ARGV[2], ARGV[3], {unpack(ARGV, 4)})
+`)
+
+// ScriptAudited runs the write ARGV[6] of KEYS[1] with the arguments ARGV[7...],
+// the path being ARGV[7], and adds an entry to the stream KEYS[2] with XADD, if
+// the write succeeded and did not skip the document as JSON.SET NX can. The
+// entry has the key, path and command fields, new with the json value at the
+// path after the write if any, old with the one before if ARGV[2] is 1, caller
+// with ARGV[3] if not empty and version with the version of a versioned write.
+// The stream is capped to about ARGV[1] entries if not empty.
+//
+// If ARGV[4] is not empty the write is versioned as with ScriptVersioned, with
+// the version path ARGV[4] and the expected version ARGV[5], and the reply is
+// the one of ScriptVersioned. Otherwise it is the reply of the write.
+var ScriptAudited = bundle("JSON.AUDITED", versionedWrite+`
+redis.replicate_commands()
+local path = ARGV[7]
+local function get()
+	local v = redis.pcall('JSON.GET', KEYS[1], path)
+	if type(v) == 'string' then
+		return v
+	end
+	return nil
+end
+
+local old
+if ARGV[2] == '1' then
+	old = get()
+end
+local reply, res
+if ARGV[4] == '' then
+	reply = redis.pcall(ARGV[6], KEYS[1], unpack(ARGV, 7))
+	if type(reply) == 'table' and reply.err then
+		return reply
+	end
+	res = reply
+else
+	reply = versioned_write(KEYS[1], ARGV[4], ARGV[5], ARGV[6], {unpack(ARGV, 7)})
+	if reply.err or reply[1] == 0 then
+		return reply
+	end
+	res = reply[2]
+end
+if not res then
+	return reply
+end
+
+local entry = {'key', KEYS[1], 'path', path, 'command', ARGV[6]}
+local new = get()
+if new then
+	table.insert(entry, 'new')
+	table.insert(entry, new)
+end
+if old then
+	table.insert(entry, 'old')
+	table.insert(entry, old)
+end
+if ARGV[3] ~= '' then
+	table.insert(entry, 'caller')
+	table.insert(entry, ARGV[3])
+end
+if ARGV[4] ~= '' then
+	table.insert(entry, 'version')
+	table.insert(entry, reply[3])
+end
+if ARGV[1] ~= '' then
+	redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[1], '*', unpack(entry))
+else
+	redis.call('XADD', KEYS[2], '*', unpack(entry))
+end
+return reply
+`)
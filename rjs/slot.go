@@ -0,0 +1,93 @@
+package rjs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClusterSlots is the number of hash slots of a Redis Cluster
+const ClusterSlots = 16384
+
+// KeySlot returns the Redis Cluster hash slot of key, the CRC16 of the key or
+// of its hash tag (the part between the first `{` and the next `}`, if not empty)
+// modulo 16384
+func KeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % ClusterSlots)
+}
+
+// crc16 implements CRC16-CCITT (XModem) as used by Redis Cluster
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for b := 0; b < 8; b++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// HashTag wraps tag in braces so that every key containing it is hashed on tag
+// only, e.g. HashTag("user:42") == "{user:42}". tag must not contain `}`.
+func HashTag(tag string) string {
+	return "{" + tag + "}"
+}
+
+// KeyBuilder builds keys sharing a hash tag, so that they are co-located on the
+// same Redis Cluster slot and can be used together in multi-key commands such
+// as JSON.MGET or in MULTI/EXEC transactions
+//
+//	kb := rjs.NewKeyBuilder("user:42")
+//	kb.Key("profile")          // {user:42}:profile
+//	kb.Key("orders", "latest") // {user:42}:orders:latest
+type KeyBuilder struct {
+	// Tag is the hash tag shared by the keys, without braces
+	Tag string
+
+	// Separator joins the hash tag and the key parts, ":" by default
+	Separator string
+}
+
+// NewKeyBuilder returns a KeyBuilder for tag using ":" as separator
+func NewKeyBuilder(tag string) KeyBuilder {
+	return KeyBuilder{Tag: tag, Separator: ":"}
+}
+
+// Key returns the key made of the hash tag followed by parts
+func (b KeyBuilder) Key(parts ...string) string {
+	return strings.Join(append([]string{HashTag(b.Tag)}, parts...), b.Separator)
+}
+
+// Slot returns the hash slot shared by all the keys of the builder
+func (b KeyBuilder) Slot() int {
+	return KeySlot(HashTag(b.Tag))
+}
+
+// SameSlot reports whether all keys hash to the same Redis Cluster slot
+func SameSlot(keys ...string) bool {
+	return ValidateSameSlot(keys...) == nil
+}
+
+// ValidateSameSlot returns an error wrapping ErrCrossSlot if keys do not all
+// hash to the same Redis Cluster slot
+func ValidateSameSlot(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	slot := KeySlot(keys[0])
+	for i := 1; i < len(keys); i++ {
+		if KeySlot(keys[i]) != slot {
+			return fmt.Errorf("%w: %q and %q", ErrCrossSlot, keys[0], keys[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package rejson
+
+import (
+	"strings"
+
+	"github.com/nitishm/go-rejson/v4/clients"
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// ScanOptions configures a ScanIterator
+type ScanOptions struct {
+	// Count is the COUNT hint passed to every SCAN, the server default if not set
+	Count int64
+
+	// WithDocuments fetches the document of every key with JSON.GET
+	WithDocuments bool
+
+	// Path is the path fetched when WithDocuments is set, the root if not set
+	Path string
+}
+
+// ScanIterator walks every ReJSON document whose key matches a pattern, using
+// SCAN ... TYPE ReJSON-RL (Redis 6.0 or later). With a go-redis ClusterClient
+// or Ring every master or shard is scanned in turn.
+//
+// As with SCAN, keys created or deleted during the iteration may or may not be
+// returned, and a key may be returned more than once. Keys deleted between the
+// SCAN and the JSON.GET of their document are skipped.
+//
+// Every SCAN goes through the middlewares, the circuit breaker and the retry
+// policy of the handler, as an Invocation of rjs.ReJSONCommandSCAN.
+//
+//	it := rh.ScanJSON("user:*", rejson.ScanOptions{WithDocuments: true})
+//	for it.Next() {
+//		var user User
+//		if err := it.Decode(&user); err != nil {
+//			...
+//		}
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ScanIterator struct {
+	handler *Handler
+	pattern string
+	opts    ScanOptions
+
+	started  bool
+	nodes    []clients.ScanNode
+	node     int
+	cursor   uint64
+	scanning bool
+	keys     []string
+	key      string
+	document interface{}
+	err      error
+}
+
+// ScanJSON returns an iterator over the keys of the ReJSON documents matching
+// pattern, and optionally their documents. With a key prefix, see WithPrefix,
+// only the keys with the prefix are scanned, pattern applying to the rest of
+// the key, and the returned keys are stripped of the prefix.
+func (r *Handler) ScanJSON(pattern string, opts ScanOptions) *ScanIterator {
+	if opts.Path == "" {
+		opts.Path = "."
+	}
+	return &ScanIterator{
+		handler: r,
+		pattern: escapeGlob(r.prefix) + pattern,
+		opts:    opts,
+	}
+}
+
+// Next advances the iterator to the next key, returning false when the key
+// space is exhausted or an error occurred
+func (it *ScanIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		if it.err = it.start(); it.err != nil {
+			return false
+		}
+	}
+
+	for {
+		for len(it.keys) > 0 {
+			it.key, it.keys = strings.TrimPrefix(it.keys[0], it.handler.prefix), it.keys[1:]
+			if !it.opts.WithDocuments {
+				return true
+			}
+			found, err := it.fetchDocument()
+			if err != nil {
+				it.err = err
+				return false
+			}
+			if found {
+				return true
+			}
+		}
+		if !it.scan() {
+			return false
+		}
+	}
+}
+
+// Key returns the current key
+func (it *ScanIterator) Key() string {
+	return it.key
+}
+
+// Document returns the JSON.GET reply for the current key when the iterator
+// was created with WithDocuments
+func (it *ScanIterator) Document() interface{} {
+	return it.document
+}
+
+// Decode decodes the document of the current key into v, see JSONGetInto
+func (it *ScanIterator) Decode(v interface{}) error {
+	return it.handler.decode(it.document, v)
+}
+
+// Err returns the error that ended the iteration, if any
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+func (it *ScanIterator) start() error {
+	client := it.handler.active()
+	if client.name == rjs.ClientInactive {
+		return rjs.ErrNoClientSet
+	}
+	scanner, ok := client.impl.(clients.KeyScanner)
+	if !ok {
+		return rjs.ErrScanNotSupported
+	}
+	nodes, err := scanner.ScanNodes()
+	if err != nil {
+		return err
+	}
+	it.nodes = nodes
+	return nil
+}
+
+// scan fetches the next batch of keys, moving to the next node once the
+// cursor of the current one is exhausted
+func (it *ScanIterator) scan() bool {
+	for it.node < len(it.nodes) {
+		if it.scanning && it.cursor == 0 {
+			it.node++
+			it.scanning = false
+			continue
+		}
+		next, keys, err := it.scanNode(it.nodes[it.node])
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.cursor, it.scanning, it.keys = next, true, keys
+		if len(keys) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// scanNode sends the SCAN of node through the middlewares of the handler. The
+// Args of its Invocation are the cursor, the pattern, the COUNT hint and the
+// key type, its Result the next cursor and the keys.
+func (it *ScanIterator) scanNode(node clients.ScanNode) (next uint64, keys []string, err error) {
+	inv := &Invocation{
+		Command: rjs.ReJSONCommandSCAN,
+		Args:    []interface{}{it.cursor, it.pattern, it.opts.Count, rjs.ReJSONKeyType},
+	}
+	res, err := it.handler.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		next, keys, err := node.Scan(inv.Args[0].(uint64), inv.Args[1].(string), inv.Args[2].(int64),
+			inv.Args[3].(string))
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{next, keys}, nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	reply := res.([]interface{})
+	return reply[0].(uint64), reply[1].([]string), nil
+}
+
+func (it *ScanIterator) fetchDocument() (bool, error) {
+	res, err := it.handler.JSONGet(it.key, it.opts.Path)
+	if err != nil {
+		if err.Error() == rjs.ErrGoRedisNil.Error() {
+			return false, nil
+		}
+		return false, err
+	}
+	it.document = res
+	return res != nil, nil
+}
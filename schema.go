@@ -0,0 +1,462 @@
+package rejson
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// Schema validates json documents before they are written, see RegisterSchema.
+// The jsonschema module implements it with JSON Schema draft 2020-12.
+type Schema interface {
+	// Validate returns the violations of doc, a json document decoded with
+	// json.Decoder.UseNumber, none if it is valid, or an error if doc could not
+	// be validated
+	Validate(doc interface{}) ([]SchemaViolation, error)
+}
+
+// SchemaViolation is a value of a document failing a keyword of its schema
+type SchemaViolation struct {
+	// Path is the JSON pointer of the failing value in the document, e.g.
+	// /items/0/qty, empty for the document itself
+	Path string
+
+	// Keyword is the JSON pointer of the failing keyword in the schema, e.g.
+	// /properties/items/items/properties/qty/minimum
+	Keyword string
+
+	// Message describes the violation
+	Message string
+}
+
+// ValidationError is the error of a write rejected by the schema of its key
+type ValidationError struct {
+	// Command is the rejected write
+	Command rjs.ReJSONCommandID
+
+	// Key is the key of the document, including the key prefix of the handler
+	Key string
+
+	// Path is the path of the write
+	Path string
+
+	// Violations are the values of the document, as it would be after the
+	// write, failing the schema
+	Violations []SchemaViolation
+}
+
+// Error lists the failing paths
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v: %s of %s at %s:", rjs.ErrSchemaValidation, e.Command, e.Key, e.Path)
+	for i, v := range e.Violations {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		path := v.Path
+		if path == "" {
+			path = "/"
+		}
+		fmt.Fprintf(&b, " %s: %s", path, v.Message)
+	}
+	return b.String()
+}
+
+// Unwrap returns rjs.ErrSchemaValidation, so that errors.Is matches it
+func (e *ValidationError) Unwrap() error {
+	return rjs.ErrSchemaValidation
+}
+
+type schemaRule struct {
+	pattern string
+	schema  Schema
+}
+
+// RegisterSchema validates the writes of JSONSet, JSONArrAppend, JSONArrInsert
+// and of their atomic variants, e.g. JSONSetWithTTL or JSONArrAppendCapped, to
+// the keys matching pattern against schema. pattern is a glob-style pattern as
+// for SCAN MATCH, matched after the key prefix of the handler. Writes failing
+// any matching schema are not sent and fail with a *ValidationError.
+//
+//	rh.RegisterSchema("order:*", jsonschema.MustCompile(orderSchema))
+//
+// The whole document is validated as it would be after the write: unless the
+// root is set, it is read with JSON.GET first. This read is an extra round trip,
+// sent through the middlewares, the circuit breaker and the retry policy as a
+// command of its own. The read and the write are not atomic: a concurrent write
+// to the document may still make it invalid. The paths of the validated writes may
+// only select members, indexes and wildcards, e.g. $.items[*].qty, other paths
+// are rejected.
+func (r *Handler) RegisterSchema(pattern string, schema Schema) {
+	rule := schemaRule{pattern: escapeGlob(r.prefix) + pattern, schema: schema}
+	// never append in place, handlers returned by SetContext share the rules
+	r.schemas = append(r.schemas[:len(r.schemas):len(r.schemas)], rule)
+}
+
+// validateWrite checks the document written by inv against the schemas of its
+// key, reading it first if needed
+func (r *Handler) validateWrite(inv *Invocation) error {
+	var schemas []Schema
+	for _, rule := range r.schemas {
+		if matchGlob(rule.pattern, inv.Key) {
+			schemas = append(schemas, rule.schema)
+		}
+	}
+	if len(schemas) == 0 {
+		return nil
+	}
+	write := schemaWrite(inv)
+	if write == nil {
+		return nil
+	}
+	segments, err := parsePath(inv.Path)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	if len(segments) > 0 || inv.Command != rjs.ReJSONCommandSET {
+		res, err := r.chain(&Invocation{
+			Context: inv.Context, Command: rjs.ReJSONCommandGET, Client: inv.Client, Key: inv.Key, Path: ".",
+			Args: []interface{}{}, impl: inv.impl,
+			call: func(c ReJSON, inv *Invocation) (interface{}, error) {
+				return c.JSONGet(inv.Key, inv.Path)
+			},
+		})
+		if err != nil && err.Error() != rjs.ErrGoRedisNil.Error() {
+			return err
+		}
+		if res == nil {
+			// without a document the write fails, unless it sets the root
+			return nil
+		}
+		if doc, err = decodeDocument(res); err != nil {
+			return err
+		}
+	}
+	if doc, err = updatePath(doc, segments, write); err != nil {
+		return err
+	}
+
+	verr := &ValidationError{Command: inv.Command, Key: inv.Key, Path: inv.Path}
+	for _, schema := range schemas {
+		violations, err := schema.Validate(doc)
+		if err != nil {
+			return err
+		}
+		verr.Violations = append(verr.Violations, violations...)
+	}
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// pathWrite returns the new value at a path selected by the write, given the
+// current one, if any, and whether it is to be stored
+type pathWrite func(v interface{}, ok bool) (interface{}, bool, error)
+
+// schemaWrite returns the change of a document made by inv, nil if it is not a
+// validated write
+func schemaWrite(inv *Invocation) pathWrite {
+	// versioned and audited writes are the plain commands
+	plain := inv.Script == "" || inv.Script == rjs.ScriptVersioned.Name() || inv.Script == rjs.ScriptAudited.Name()
+	switch {
+	case inv.Command == rjs.ReJSONCommandSET && (plain ||
+		inv.Script == rjs.ScriptSetWithTTL.Name() || inv.Script == rjs.ScriptSetIf.Name()):
+		return func(interface{}, bool) (interface{}, bool, error) {
+			v, err := decodeValue(inv.sentArgs()[0])
+			return v, err == nil, err
+		}
+	case inv.Command == rjs.ReJSONCommandARRAPPEND && plain:
+		return arrayWrite(inv.sentArgs(), func(arr, values []interface{}) []interface{} {
+			return append(arr, values...)
+		})
+	case inv.Command == rjs.ReJSONCommandARRAPPEND && inv.Script == rjs.ScriptArrAppendCapped.Name():
+		maxLen := inv.Args[0].(int)
+		return arrayWrite(inv.sentArgs()[1:], func(arr, values []interface{}) []interface{} {
+			if arr = append(arr, values...); len(arr) > maxLen {
+				arr = arr[len(arr)-maxLen:]
+			}
+			return arr
+		})
+	case inv.Command == rjs.ReJSONCommandARRINSERT && plain:
+		index := inv.Args[0].(int)
+		return arrayWrite(inv.sentArgs()[1:], func(arr, values []interface{}) []interface{} {
+			i := index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i > len(arr) {
+				// out of range, the server rejects the write
+				return arr
+			}
+			return append(append(append([]interface{}(nil), arr[:i]...), values...), arr[i:]...)
+		})
+	case inv.Command == rjs.ReJSONCommandARRINSERT && inv.Script == rjs.ScriptArrPrependCapped.Name():
+		maxLen := inv.Args[0].(int)
+		return arrayWrite(inv.sentArgs()[1:], func(arr, values []interface{}) []interface{} {
+			if arr = append(append([]interface{}(nil), values...), arr...); len(arr) > maxLen {
+				arr = arr[:maxLen]
+			}
+			return arr
+		})
+	}
+	return nil
+}
+
+// arrayWrite returns the pathWrite changing the arrays at a path with update
+func arrayWrite(args []interface{}, update func(arr, values []interface{}) []interface{}) pathWrite {
+	return func(v interface{}, ok bool) (interface{}, bool, error) {
+		arr, isArray := v.([]interface{})
+		if !isArray {
+			return v, ok, nil
+		}
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			var err error
+			if values[i], err = decodeValue(arg); err != nil {
+				return nil, false, err
+			}
+		}
+		return update(arr, values), true, nil
+	}
+}
+
+// decodeValue decodes a value sent by a command as the server would store it
+func decodeValue(v interface{}) (interface{}, error) {
+	b, err := rjs.MarshalValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDocument(b)
+}
+
+func decodeDocument(reply interface{}) (doc interface{}, err error) {
+	err = rjs.Unmarshal(reply, &doc)
+	return
+}
+
+// pathSegment is a member, an index or a wildcard of a path
+type pathSegment struct {
+	member   string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parsePath parses a legacy path (`.`, `.a.b`, `a[0]["b"]`) or a JSONPath made
+// of members, indexes and wildcards (`$.a[*].b`, `$['a'][-1]`)
+func parsePath(path string) (segments []pathSegment, err error) {
+	unsupported := fmt.Errorf("error: path %q is not supported by schema validation", path)
+	p := strings.TrimPrefix(path, "$")
+	if p == "." {
+		return nil, nil
+	}
+	for i := 0; i < len(p); {
+		switch {
+		case p[i] == '[':
+			if !strings.Contains(p[i:], "]") {
+				return nil, unsupported
+			}
+			seg, n, err := parseBracket(p[i:])
+			if err != nil {
+				return nil, unsupported
+			}
+			segments = append(segments, seg)
+			i += n
+		case p[i] == '.' || i == 0:
+			if p[i] == '.' {
+				i++
+			}
+			j := i
+			for j < len(p) && p[j] != '.' && p[j] != '[' {
+				j++
+			}
+			switch name := p[i:j]; name {
+			case "":
+				// recursive descent or an empty member
+				return nil, unsupported
+			case "*":
+				segments = append(segments, pathSegment{wildcard: true})
+			default:
+				segments = append(segments, pathSegment{member: name})
+			}
+			i = j
+		default:
+			return nil, unsupported
+		}
+	}
+	return segments, nil
+}
+
+// parseBracket parses the [...] segment at the start of p, returning it and
+// its length
+func parseBracket(p string) (seg pathSegment, n int, err error) {
+	if len(p) > 2 && (p[1] == '"' || p[1] == '\'') {
+		quote := p[1]
+		for j := 2; j < len(p); j++ {
+			switch p[j] {
+			case '\\':
+				j++
+			case quote:
+				if j+1 >= len(p) || p[j+1] != ']' {
+					return seg, 0, strconv.ErrSyntax
+				}
+				member := p[2:j]
+				if quote == '"' {
+					if member, err = strconv.Unquote(p[1 : j+1]); err != nil {
+						return seg, 0, err
+					}
+				}
+				return pathSegment{member: member}, j + 2, nil
+			}
+		}
+		return seg, 0, strconv.ErrSyntax
+	}
+	end := strings.IndexByte(p, ']')
+	switch inner := strings.TrimSpace(p[1:end]); inner {
+	case "*":
+		return pathSegment{wildcard: true}, end + 1, nil
+	default:
+		index, err := strconv.Atoi(inner)
+		return pathSegment{index: index, isIndex: true}, end + 1, err
+	}
+}
+
+// updatePath applies write to the values of v selected by segments, returning
+// the updated v. Objects and arrays are updated in place.
+func updatePath(v interface{}, segments []pathSegment, write pathWrite) (interface{}, error) {
+	if len(segments) == 0 {
+		nv, ok, err := write(v, true)
+		if err != nil || !ok {
+			return v, err
+		}
+		return nv, nil
+	}
+
+	seg, rest := segments[0], segments[1:]
+	var err error
+	switch c := v.(type) {
+	case map[string]interface{}:
+		switch {
+		case seg.wildcard:
+			for k, e := range c {
+				if c[k], err = updatePath(e, rest, write); err != nil {
+					return nil, err
+				}
+			}
+		case seg.isIndex:
+		default:
+			e, ok := c[seg.member]
+			if ok {
+				c[seg.member], err = updatePath(e, rest, write)
+			} else if len(rest) == 0 {
+				// JSON.SET adds the missing last member of a path
+				if e, ok, err = write(nil, false); ok {
+					c[seg.member] = e
+				}
+			}
+		}
+	case []interface{}:
+		switch {
+		case seg.wildcard:
+			for i, e := range c {
+				if c[i], err = updatePath(e, rest, write); err != nil {
+					return nil, err
+				}
+			}
+		case seg.isIndex:
+			i := seg.index
+			if i < 0 {
+				i += len(c)
+			}
+			if i >= 0 && i < len(c) {
+				c[i], err = updatePath(c[i], rest, write)
+			}
+		}
+	}
+	return v, err
+}
+
+// matchGlob reports whether s matches the glob-style pattern of SCAN MATCH,
+// with *, ?, [abc], [^a-z] and \ escapes
+func matchGlob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchGlob(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			n, ok := matchClass(pattern, s[0])
+			if !ok {
+				return false
+			}
+			pattern = pattern[n:]
+			s = s[1:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
+
+// matchClass matches c against the [...] class at the start of pattern,
+// returning the length of the class
+func matchClass(pattern string, c byte) (n int, ok bool) {
+	i := 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+	var match bool
+	for ; i < len(pattern) && pattern[i] != ']'; i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			match = match || pattern[i] == c
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			lo, hi := pattern[i], pattern[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			match = match || (lo <= c && c <= hi)
+			i += 2
+		default:
+			match = match || pattern[i] == c
+		}
+	}
+	if i < len(pattern) {
+		i++
+	}
+	return i, match != negate
+}
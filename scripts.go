@@ -0,0 +1,182 @@
+package rejson
+
+import (
+	"fmt"
+
+	"github.com/nitishm/go-rejson/v4/clients"
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// JSONSetWithTTL sets the json value at path and the expiry of key atomically,
+// with a Lua script, so that no key is left without its expiry if a separate
+// EXPIRE failed. With TTLOptionKEEPTTL an existing expiry of key is kept.
+//
+//	rh.JSONSetWithTTL("session:1", ".", session, rjs.TTLOptionEX(30*time.Minute))
+//
+// The Invocation of the command is a JSON.SET, with the TTL option after the value.
+func (r *Handler) JSONSetWithTTL(key, path string, obj interface{}, ttl rjs.TTLOption, opts ...rjs.SetOption) (
+	res interface{}, err error,
+) {
+	if obj, err = r.encode(obj); err != nil {
+		return nil, err
+	}
+	inv := &Invocation{
+		Command: rjs.ReJSONCommandSET, Script: rjs.ScriptSetWithTTL.Name(), Key: key, Path: path,
+		Args: append([]interface{}{obj, ttl}, setOptionArgs(opts)...),
+	}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		args, err := rjs.SetWithTTLArgs(inv.Path, inv.sentArgs()[0], ttl, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return eval(c, rjs.ScriptSetWithTTL, []string{inv.Key}, args...)
+	})
+}
+
+// eval runs script with c, which must implement clients.ScriptRunner
+func eval(c ReJSON, script *rjs.Script, keys []string, args ...interface{}) (interface{}, error) {
+	runner, ok := c.(clients.ScriptRunner)
+	if !ok {
+		return nil, notSupported(c, script.Name())
+	}
+	return runner.Eval(script, keys, args...)
+}
+
+// LoadScripts loads the Lua scripts of the typed Handler methods, see
+// rjs.BundledScripts, into the script cache of the server. It is optional:
+// scripts are sent with EVAL, which caches them, when EVALSHA fails with
+// NOSCRIPT, e.g. after a restart or a SCRIPT FLUSH.
+func (r *Handler) LoadScripts() error {
+	client := r.active()
+	if client.name == rjs.ClientInactive {
+		return rjs.ErrNoClientSet
+	}
+	loader, ok := client.impl.(clients.ScriptLoader)
+	if !ok {
+		return fmt.Errorf("error: client %s cannot load scripts", client.name)
+	}
+	for _, script := range rjs.BundledScripts() {
+		if err := loader.LoadScript(script); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSONNumIncrByGet increments the number at path by number and returns the
+// whole document, atomically, with a Lua script. number is any type accepted
+// by JSONNumIncrByNumber.
+//
+// The Invocation of the command is a JSON.NUMINCRBY.
+func (r *Handler) JSONNumIncrByGet(key, path string, number interface{}) (res interface{}, err error) {
+	inv := &Invocation{
+		Command: rjs.ReJSONCommandNUMINCRBY, Script: rjs.ScriptNumIncrByGet.Name(), Key: key, Path: path,
+		Args: []interface{}{number},
+	}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		args, err := rjs.NumIncrByGetArgs(inv.Path, number)
+		if err != nil {
+			return nil, err
+		}
+		return bulkReply(eval(c, rjs.ScriptNumIncrByGet, []string{inv.Key}, args...))
+	})
+}
+
+// bulkReply converts the bulk string replies of go-redis scripts into []byte,
+// as returned by redigo and the JSON.GET of both clients
+func bulkReply(res interface{}, err error) (interface{}, error) {
+	if s, ok := res.(string); ok {
+		return rjs.StringToBytes(s), err
+	}
+	return res, err
+}
+
+// JSONSetIf sets the json value at path to newValue only if it currently is
+// expected, atomically, with a Lua script, and reports whether it was set. The
+// values are compared as canonical json, so that formatting and the order of
+// object members do not matter, while numbers are compared exactly, beyond the
+// precision of float64. A missing key or path is never equal to expected, other
+// errors of the read of the value, e.g. WRONGTYPE, are returned.
+//
+// With a JSONPath ($) path every match must be equal to expected, and every
+// match is set.
+//
+//	shipped, err := rh.JSONSetIf("order:1", "$.status", "packed", "shipped")
+//
+// The Invocation of the command is a JSON.SET with newValue and expected as
+// arguments, which is not retried as a swap could be reported as failed.
+func (r *Handler) JSONSetIf(key, path string, expected, newValue interface{}) (swapped bool, err error) {
+	if expected, err = r.encode(expected); err != nil {
+		return false, err
+	}
+	if newValue, err = r.encode(newValue); err != nil {
+		return false, err
+	}
+	inv := &Invocation{
+		Command: rjs.ReJSONCommandSET, Script: rjs.ScriptSetIf.Name(), Key: key, Path: path,
+		Args: []interface{}{newValue, expected},
+	}
+	res, err := r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		args, err := rjs.SetIfArgs(inv.Path, inv.sentArgs()[1], inv.sentArgs()[0])
+		if err != nil {
+			return nil, err
+		}
+		return eval(c, rjs.ScriptSetIf, []string{inv.Key}, args...)
+	})
+	if err != nil {
+		return false, err
+	}
+	return res == int64(1), nil
+}
+
+// JSONArrAppendCapped appends values to the json array at path and trims it to
+// its last maxLen elements, atomically, with a Lua script, e.g. to keep a bounded
+// history of events. It returns the new length of the array, as JSONArrTrim.
+//
+//	rh.JSONArrAppendCapped("device:1", ".events", 100, event)
+//
+// The Invocation of the command is a JSON.ARRAPPEND with maxLen before the values.
+func (r *Handler) JSONArrAppendCapped(key, path string, maxLen int, values ...interface{}) (
+	res interface{}, err error,
+) {
+	return r.arrCapped(rjs.ReJSONCommandARRAPPEND, rjs.ScriptArrAppendCapped, key, path, maxLen, values)
+}
+
+// JSONArrPrependCapped inserts values at the start of the json array at path
+// and trims it to its first maxLen elements, atomically, with a Lua script, the
+// latest values being first. It returns the new length of the array, as
+// JSONArrTrim.
+//
+// The Invocation of the command is a JSON.ARRINSERT with maxLen before the values.
+func (r *Handler) JSONArrPrependCapped(key, path string, maxLen int, values ...interface{}) (
+	res interface{}, err error,
+) {
+	return r.arrCapped(rjs.ReJSONCommandARRINSERT, rjs.ScriptArrPrependCapped, key, path, maxLen, values)
+}
+
+func (r *Handler) arrCapped(command rjs.ReJSONCommandID, script *rjs.Script, key, path string, maxLen int,
+	values []interface{},
+) (res interface{}, err error) {
+	if values, err = r.encodeAll(values); err != nil {
+		return nil, err
+	}
+	// checked before the invocation, whose schemas, see RegisterSchema, apply
+	// the cap
+	if len(values) == 0 {
+		return nil, rjs.ErrNeedAtLeastOneArg
+	}
+	if maxLen <= 0 {
+		return nil, rjs.ErrInvalidMaxLen
+	}
+	inv := &Invocation{
+		Command: command, Script: script.Name(), Key: key, Path: path,
+		Args: append([]interface{}{maxLen}, values...),
+	}
+	return r.invoke(inv, func(c ReJSON, inv *Invocation) (interface{}, error) {
+		args, err := rjs.ArrCappedArgs(inv.Path, maxLen, inv.sentArgs()[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		return eval(c, script, []string{inv.Key}, args...)
+	})
+}
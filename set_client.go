@@ -2,6 +2,7 @@ package rejson
 
 import (
 	"context"
+
 	"github.com/nitishm/go-rejson/v4/clients"
 	"github.com/nitishm/go-rejson/v4/rjs"
 )
@@ -13,18 +14,58 @@ type RedisClient interface {
 	SetGoRedisClient(conn clients.GoRedisClientConn)
 }
 
-// SetClientInactive resets the handler and unset any client, set to the handler
+// activeClient is the client of a handler, replaced as a whole
+type activeClient struct {
+	name string
+	impl ReJSON
+}
+
+var inactiveClient = &activeClient{name: rjs.ClientInactive}
+
+// active returns the current client of the handler. A command uses the client
+// returned when it started, even if the client is swapped meanwhile.
+func (r *Handler) active() *activeClient {
+	if r.state == nil {
+		return inactiveClient
+	}
+	if c, ok := r.state.client.Load().(*activeClient); ok {
+		return c
+	}
+	return inactiveClient
+}
+
+func (r *Handler) setClient(name string, impl ReJSON) {
+	r.store(&activeClient{name: name, impl: impl})
+}
+
+// shared returns the state of r, to be shared with a derived handler
+func (r *Handler) shared() *sharedState {
+	if r.state == nil {
+		r.store(inactiveClient)
+	}
+	return r.state
+}
+
+func (r *Handler) store(c *activeClient) {
+	if r.state == nil {
+		// a Handler not created by NewReJSONHandler or New
+		r.state = new(sharedState)
+	}
+	r.state.client.Store(c)
+}
+
+// SetClientInactive resets the handler and unset any client, set to the handler.
+//
+// Clients can be set, swapped or unset while commands are in flight, e.g. on a
+// failover: the commands started before complete with the previous client.
 func (r *Handler) SetClientInactive() {
-	_t := &Handler{clientName: rjs.ClientInactive}
-	r.clientName = _t.clientName
-	r.implementation = _t.implementation
+	r.store(inactiveClient)
 }
 
 // SetRedigoClient sets Redigo (https://github.com/gomodule/redigo/redis) client
 // to the handler
 func (r *Handler) SetRedigoClient(conn clients.RedigoClientConn) {
-	r.clientName = "redigo"
-	r.implementation = &clients.Redigo{Conn: conn}
+	r.setClient(rjs.ClientRedigo, &clients.Redigo{Conn: conn})
 }
 
 // Deprecated: SetGoRedisClient sets Go-Redis (https://github.com/go-redis/redis) client to
@@ -36,6 +77,12 @@ func (r *Handler) SetGoRedisClient(conn clients.GoRedisClientConn) {
 // SetGoRedisClientWithContext sets Go-Redis (https://github.com/go-redis/redis) client to
 // the handler with a global context for the connection
 func (r *Handler) SetGoRedisClientWithContext(ctx context.Context, conn clients.GoRedisClientConn) {
-	r.clientName = "goredis"
-	r.implementation = clients.NewGoRedisClient(ctx, conn)
+	r.setClient(rjs.ClientGoRedis, clients.NewGoRedisClient(ctx, conn))
+}
+
+// SetSlotValidation enables or disables the client-side check that the keys of
+// multi-key commands, like JSONMGet, hash to the same Redis Cluster slot. Keys
+// can be co-located with hash tags, see rjs.KeyBuilder.
+func (r *Handler) SetSlotValidation(enabled bool) {
+	r.validateSlots = enabled
 }
@@ -0,0 +1,119 @@
+//go:build go1.21
+
+package rejson
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// RedactedValue replaces the redacted parts of keys and values in the records
+// of the slow command logger
+const RedactedValue = "[REDACTED]"
+
+// SlowLogOptions configures the slow command logger, see LogSlowCommands
+type SlowLogOptions struct {
+	// Latency logs the commands taking at least this long, disabled if not set
+	Latency time.Duration
+
+	// PayloadSize logs the commands sending or receiving json of at least this
+	// many bytes, see Invocation.PayloadSize. Disabled if not set.
+	PayloadSize int
+
+	// Level is the level of the records, slog.LevelWarn if not set
+	Level slog.Leveler
+
+	// RedactKey returns the key as logged, e.g. RedactKeySegments(1). Keys are
+	// logged verbatim if not set.
+	RedactKey func(key string) string
+
+	// RedactValue returns a value sent by the command as logged, e.g. the
+	// document of JSON.SET. Values are only logged if it is set: return
+	// RedactedValue for the values that must not be logged.
+	RedactValue func(inv *Invocation, value interface{}) interface{}
+}
+
+// RedactKeySegments returns a RedactKey function keeping the first n segments
+// of the keys, separated by colons, e.g. user:[REDACTED] for user:42:profile
+// and n = 1. The whole key is redacted if n is 0 or less.
+func RedactKeySegments(n int) func(key string) string {
+	if n < 0 {
+		n = 0
+	}
+	return func(key string) string {
+		segments := strings.SplitN(key, ":", n+1)
+		if len(segments) <= n {
+			return key
+		}
+		return strings.Join(append(segments[:n], RedactedValue), ":")
+	}
+}
+
+// LogSlowCommands logs the commands exceeding the latency or payload size
+// thresholds of opts to logger, e.g. to find JSONGet calls fetching whole
+// documents. It appends a middleware to the handler, see Use.
+func (r *Handler) LogSlowCommands(logger *slog.Logger, opts SlowLogOptions) {
+	if opts.Level == nil {
+		opts.Level = slog.LevelWarn
+	}
+	r.Use(func(next Invoker) Invoker {
+		return func(inv *Invocation) (interface{}, error) {
+			res, err := next(inv)
+
+			slow := opts.Latency > 0 && inv.Duration >= opts.Latency
+			size := 0
+			if opts.PayloadSize > 0 {
+				size = inv.PayloadSize()
+			}
+			large := opts.PayloadSize > 0 && size >= opts.PayloadSize
+			if !slow && !large {
+				return res, err
+			}
+
+			msg := "slow ReJSON command"
+			if !slow {
+				msg = "large ReJSON payload"
+			}
+			logger.LogAttrs(inv.Context, opts.Level.Level(), msg, slowLogAttrs(inv, size, err, opts)...)
+			return res, err
+		}
+	})
+}
+
+func slowLogAttrs(inv *Invocation, size int, err error, opts SlowLogOptions) []slog.Attr {
+	redactKey := opts.RedactKey
+	if redactKey == nil {
+		redactKey = func(key string) string { return key }
+	}
+
+	attrs := []slog.Attr{
+		slog.String("command", inv.Command.String()),
+		slog.String("client", inv.Client),
+	}
+	if inv.Key != "" {
+		attrs = append(attrs, slog.String("key", redactKey(inv.Key)))
+	}
+	if len(inv.Keys) > 0 {
+		keys := make([]string, len(inv.Keys))
+		for i, key := range inv.Keys {
+			keys[i] = redactKey(key)
+		}
+		attrs = append(attrs, slog.Any("keys", keys))
+	}
+	attrs = append(attrs, slog.String("path", inv.Path), slog.Duration("duration", inv.Duration))
+	if size > 0 {
+		attrs = append(attrs, slog.Int("payload_size", size))
+	}
+	if opts.RedactValue != nil && len(inv.Args) > 0 {
+		values := make([]interface{}, len(inv.Args))
+		for i, v := range inv.Args {
+			values[i] = opts.RedactValue(inv, v)
+		}
+		attrs = append(attrs, slog.Any("args", values))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	return attrs
+}
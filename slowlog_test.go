@@ -0,0 +1,121 @@
+//go:build go1.21
+
+package rejson
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+func TestLogSlowCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SlowLogOptions
+		want []map[string]interface{}
+	}{
+		{
+			name: "Disabled",
+			opts: SlowLogOptions{},
+		},
+		{
+			name: "Latency",
+			opts: SlowLogOptions{Latency: time.Nanosecond},
+			want: []map[string]interface{}{
+				{"msg": "slow ReJSON command", "command": "JSON.SET", "key": "user:42:profile", "path": "."},
+				{"msg": "slow ReJSON command", "command": "JSON.GET", "key": "user:42:profile", "path": "."},
+			},
+		},
+		{
+			name: "PayloadSize",
+			opts: SlowLogOptions{PayloadSize: 30, RedactKey: RedactKeySegments(1)},
+			want: []map[string]interface{}{
+				{"msg": "large ReJSON payload", "command": "JSON.SET", "key": "user:[REDACTED]", "path": ".",
+					"payload_size": 40.0},
+			},
+		},
+		{
+			name: "Values",
+			opts: SlowLogOptions{
+				PayloadSize: 10,
+				RedactValue: func(inv *Invocation, value interface{}) interface{} {
+					if doc, ok := value.(map[string]string); ok {
+						return map[string]string{"name": doc["name"], "email": RedactedValue}
+					}
+					return value
+				},
+			},
+			want: []map[string]interface{}{
+				{"msg": "large ReJSON payload", "command": "JSON.SET", "key": "user:42:profile", "path": ".",
+					"payload_size": 40.0, "args": []interface{}{
+						map[string]interface{}{"name": "ann", "email": RedactedValue}, "NX",
+					}},
+				{"msg": "large ReJSON payload", "command": "JSON.GET", "key": "user:42:profile", "path": ".",
+					"payload_size": 23.0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rh := NewReJSONHandler()
+			conn := &fakeConn{reply: "OK"}
+			rh.SetRedigoClient(conn)
+			rh.LogSlowCommands(slog.New(slog.NewJSONHandler(&buf, nil)), tt.opts)
+
+			doc := map[string]string{"name": "ann", "email": "ann@example.com"}
+			if _, err := rh.JSONSet("user:42:profile", ".", doc, rjs.SetOptionNX); err != nil {
+				t.Fatalf("JSONSet() error = %v", err)
+			}
+			conn.reply = []byte(`{"name":"ann","age":42}`)
+			if _, err := rh.JSONGet("user:42:profile", "."); err != nil {
+				t.Fatalf("JSONGet() error = %v", err)
+			}
+
+			var got []map[string]interface{}
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var record map[string]interface{}
+				if err := dec.Decode(&record); err != nil {
+					t.Fatal(err)
+				}
+				if record["level"] != "WARN" || record["client"] != "redigo" || record["duration"] == nil {
+					t.Errorf("record = %v", record)
+				}
+				delete(record, "time")
+				delete(record, "level")
+				delete(record, "client")
+				delete(record, "duration")
+				got = append(got, record)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("records = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactKeySegments(t *testing.T) {
+	tests := []struct {
+		key  string
+		n    int
+		want string
+	}{
+		{"user:42:profile", 1, "user:[REDACTED]"},
+		{"user:42:profile", 2, "user:42:[REDACTED]"},
+		{"user:42:profile", 3, "user:42:profile"},
+		{"user", 1, "user"},
+		{"user", 0, "[REDACTED]"},
+		{"user:42", -1, "[REDACTED]"},
+	}
+	for _, tt := range tests {
+		if got := RedactKeySegments(tt.n)(tt.key); got != tt.want {
+			t.Errorf("RedactKeySegments(%d)(%q) = %q, want %q", tt.n, tt.key, got, tt.want)
+		}
+	}
+}
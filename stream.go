@@ -0,0 +1,30 @@
+package rejson
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// JSONGetStream streams the json array at path, calling fn once for every
+// element with a json.Decoder positioned at that element. fn must consume
+// exactly one value, typically with dec.Decode, or skip it by returning an error.
+//
+// The array is read page by page with an ArrayIterator configured by opts, so
+// that only one page of elements is held in memory at a time, however large the
+// array. Neither client can stream a single reply from the connection: the
+// elements of a page are read in full before fn is called for them.
+//
+// Numbers decoded into interface{} values become json.Number, as in rjs.Unmarshal.
+// The path must match exactly one array, and slice paths require JSONPath
+// support, i.e. RedisJSON 2.0 or later.
+func (r *Handler) JSONGetStream(key, path string, fn func(dec *json.Decoder) error, opts ArrayIteratorOptions) error {
+	it := r.ArrayIterator(key, path, opts)
+	for it.Next() {
+		dec := json.NewDecoder(bytes.NewReader(it.Raw()))
+		dec.UseNumber()
+		if err := fn(dec); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
@@ -0,0 +1,177 @@
+package rejson
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/nitishm/go-rejson/v4/rjs"
+)
+
+// DefaultVersionPath is the path of the version of the documents when no path
+// is configured, see EnableVersioning
+const DefaultVersionPath = "._version"
+
+// VersionConflictError is the error of a write of a handler returned by
+// IfVersion when the document is at another version
+type VersionConflictError struct {
+	// Key is the key of the document, including the key prefix of the handler
+	Key string
+
+	// Expected is the version required by IfVersion
+	Expected int64
+
+	// Actual is the version of the document, 0 if it does not exist
+	Actual int64
+}
+
+// Error describes the conflict
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%v: %s is at version %d, expected %d", rjs.ErrVersionConflict, e.Key, e.Actual, e.Expected)
+}
+
+// Unwrap returns rjs.ErrVersionConflict, so that errors.Is matches it
+func (e *VersionConflictError) Unwrap() error {
+	return rjs.ErrVersionConflict
+}
+
+// EnableVersioning makes every write of the handler increment the version of
+// its document, an integer at path, DefaultVersionPath if empty, atomically
+// with a Lua script. path must be a member of the root, which must then be an
+// object. A new document is at version 1, a missing version counts as 0.
+//
+// Versions give optimistic locking without WATCH: a document read at version n
+// is written back with IfVersion(n), which fails if it was written since.
+//
+//	var order struct {
+//		Status  string `json:"status"`
+//		Version int64  `json:"_version"`
+//	}
+//	err := rh.JSONGetInto("order:1", ".", &order)
+//	...
+//	_, err = rh.IfVersion(order.Version).JSONSet("order:1", ".status", "shipped")
+//	if errors.Is(err, rjs.ErrVersionConflict) {
+//		// read the order again and retry
+//	}
+//
+// The Invocation of a versioned write is the same command, with the
+// JSON.VERSIONED script. The writes running their own Lua script cannot be
+// versioned: JSONSetWithTTL, JSONSetIf, JSONNumIncrByGet, JSONArrAppendCapped
+// and JSONArrPrependCapped fail with rjs.ErrVersioning, and the writes of a Lock
+// are sent as they are, without changing the version. A deleted document starts
+// again at version 1.
+func (r *Handler) EnableVersioning(path string) error {
+	if path == "" {
+		path = DefaultVersionPath
+	}
+	segments, err := parsePath(path)
+	if err != nil || len(segments) != 1 || segments[0].member == "" {
+		return fmt.Errorf("%w: version path %q is not a member of the root", rjs.ErrVersioning, path)
+	}
+	r.versionPath = path
+	return nil
+}
+
+// DisableVersioning stops incrementing the version of the documents
+func (r *Handler) DisableVersioning() {
+	r.versionPath = ""
+}
+
+// IfVersion returns a handler sharing the client, see WithPrefix, and the
+// configuration of r whose writes fail with a *VersionConflictError, without
+// being sent, unless their document is at version. Versioning must be enabled.
+//
+// A successful write increments the version: the next write of the document
+// requires version+1.
+func (r *Handler) IfVersion(version int64) *Handler {
+	h := &Handler{state: r.shared(), handlerConfig: r.handlerConfig}
+	h.ifVersion = &version
+	return h
+}
+
+// versioned makes inv, a write, a versioned one
+func (r *Handler) versioned(inv *Invocation) error {
+	switch {
+	case r.versionPath == "":
+		return fmt.Errorf("%w: versioning is not enabled", rjs.ErrVersioning)
+	case inv.Script == rjs.ScriptLock.Name() || inv.Script == rjs.ScriptLockRenew.Name() ||
+		inv.Script == rjs.ScriptUnlock.Name():
+		return nil
+	case inv.Script != "":
+		return fmt.Errorf("%w: %s runs its own script", rjs.ErrVersioning, inv.Script)
+	}
+	if segments, err := parsePath(inv.Path); inv.Command == rjs.ReJSONCommandSET && err == nil && len(segments) == 0 {
+		b, err := rjs.MarshalValue(inv.sentArgs()[0])
+		if err != nil {
+			return err
+		}
+		if b = bytes.TrimSpace(b); len(b) == 0 || b[0] != '{' {
+			return fmt.Errorf("%w: the root of a versioned document must be an object", rjs.ErrVersioning)
+		}
+	}
+
+	inv.Script, inv.versionPath, inv.ifVersion = rjs.ScriptVersioned.Name(), r.versionPath, r.ifVersion
+	inv.call = sendVersioned
+	return nil
+}
+
+// sendVersioned sends inv with ScriptVersioned
+func sendVersioned(c ReJSON, inv *Invocation) (interface{}, error) {
+	name, args, err := writeArgs(inv)
+	if err != nil {
+		return nil, err
+	}
+	res, err := eval(c, rjs.ScriptVersioned, []string{inv.Key},
+		append([]interface{}{inv.versionPath, expectedVersion(inv), name}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return writeReply(inv, res)
+}
+
+// writeArgs returns the name of the write of inv and its arguments after the key
+func writeArgs(inv *Invocation) (name string, args []interface{}, err error) {
+	args = []interface{}{inv.Key, inv.Path}
+	for _, arg := range inv.sentArgs() {
+		if op, ok := arg.(rjs.SetOption); ok {
+			args = append(args, op.Value()...)
+			continue
+		}
+		args = append(args, arg)
+	}
+	if name, args, err = rjs.CommandBuilder(inv.Command, args...); err != nil {
+		return "", nil, err
+	}
+	return name, args[1:], nil
+}
+
+// expectedVersion returns the version argument of the scripts running a
+// versioned write, empty if any version is accepted
+func expectedVersion(inv *Invocation) string {
+	if inv.ifVersion == nil {
+		return ""
+	}
+	return strconv.FormatInt(*inv.ifVersion, 10)
+}
+
+// writeReply returns the reply of the write of inv from the one of the script
+// running it
+func writeReply(inv *Invocation, res interface{}) (interface{}, error) {
+	if inv.versionPath != "" {
+		reply, ok := res.([]interface{})
+		if !ok || len(reply) < 2 {
+			return nil, fmt.Errorf("error: unexpected versioned reply %v", res)
+		}
+		if reply[0] != int64(1) {
+			actual, _ := reply[1].(int64)
+			return nil, &VersionConflictError{Key: inv.Key, Expected: *inv.ifVersion, Actual: actual}
+		}
+		res = reply[1]
+	}
+	switch inv.Command {
+	case rjs.ReJSONCommandNUMINCRBY, rjs.ReJSONCommandNUMMULTBY, rjs.ReJSONCommandARRPOP:
+		// as returned by the commands of both clients
+		return bulkReply(res, nil)
+	}
+	return res, nil
+}